@@ -0,0 +1,128 @@
+// Package blob stores binary objects, such as cover images, under
+// slash-separated keys like "covers/12/small.jpg".
+//
+// Store is the interface the server depends on; FileStore keeps the objects
+// in a directory of the local filesystem. Other backends, e.g. an object
+// storage service, only need to implement Store.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for a key that holds no object.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for a key that is empty, absolute or leaves the
+// store with "..".
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Store is a blob storage backend.
+type Store interface {
+	// Put stores the content of r under key, replacing any previous object.
+	// Readers never see a partly written object.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens the object stored under key. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, Info, error)
+	// Delete removes the object stored under key. Deleting a missing object
+	// is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Info describes a stored object.
+type Info struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// FileStore is a Store backed by a local directory.
+type FileStore struct {
+	root string
+}
+
+// NewFileStore returns a FileStore rooted at dir, creating the directory
+// when it does not exist yet.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{root: dir}, nil
+}
+
+// path maps a key to a file below the root.
+func (s *FileStore) path(key string) (string, error) {
+	clean := path.Clean(key)
+	if key == "" || path.IsAbs(key) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+func (s *FileStore) Put(ctx context.Context, key string, r io.Reader) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it into place
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, Info, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, Info{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Info{}, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, Info{}, err
+	}
+	return f, Info{Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,25 @@
+package main
+
+import "context"
+
+// runAccrueFines is the accrue-fines subcommand. It charges every overdue
+// loan the fines it came to since it was last charged, following the fee
+// schedule of the borrower's role:
+//
+//	app accrue-fines --config configs/app.yaml
+//
+// Run daily, e.g. from cron, it charges one day of fines at a time. Patron
+// accounts and borrowing accrue the fines of their patron as they go.
+func runAccrueFines(args []string) {
+	j := newJob(args, "ACCRUE-FINES: ")
+	j.parse(args)
+
+	dbClient := j.connect()
+	defer j.close()
+
+	charges, err := dbClient.AccrueFines(context.Background())
+	if err != nil {
+		j.fatalf("Accruing fines failed: %v", err)
+	}
+	j.logger.Printf("%d fines charged", charges)
+}
@@ -0,0 +1,25 @@
+package main
+
+import "context"
+
+// runExpireHolds is the expire-holds subcommand. It expires the holds whose
+// copy was not picked up in time and passes the copies to the next patrons
+// in the queue:
+//
+//	app expire-holds --config configs/app.yaml
+//
+// Borrowing and placing holds expire the holds of their book as they go, so
+// the job only has to catch books nobody asks for, e.g. hourly from cron.
+func runExpireHolds(args []string) {
+	j := newJob(args, "EXPIRE-HOLDS: ")
+	j.parse(args)
+
+	dbClient := j.connect()
+	defer j.close()
+
+	expired, err := dbClient.ExpireHolds(context.Background())
+	if err != nil {
+		j.fatalf("Expiring holds failed: %v", err)
+	}
+	j.logger.Printf("%d holds expired", expired)
+}
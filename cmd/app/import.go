@@ -0,0 +1,63 @@
+package main
+
+import (
+	"app/database/adaptor"
+	"app/importer"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runImport is the import subcommand. It loads a CSV, NDJSON, MARC (ISO 2709)
+// or MARCXML file into the catalog and prints the import report as JSON:
+//
+//	app import --config configs/app.yaml [--format csv|ndjson|marc|marcxml] [--batch-size 500] books.csv
+//
+// The file is read from stdin when it is "-" or missing.
+func runImport(args []string) {
+	j := newJob(args, "IMPORT: ")
+	formatName := j.flags.String("format", "", "csv, ndjson, marc or marcxml, taken from the file extension by default")
+	batchSize := j.flags.Int("batch-size", importer.DefaultBatchSize, "rows written per transaction")
+	j.parse(args)
+
+	var input io.Reader = os.Stdin
+	path := j.flags.Arg(0)
+	if path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			j.fatalf("Unable to open %s: %v", path, err)
+		}
+		defer file.Close()
+		input = file
+
+		if *formatName == "" {
+			*formatName = strings.TrimPrefix(filepath.Ext(path), ".")
+		}
+	}
+
+	format, err := importer.ParseFormat(*formatName)
+	if err != nil {
+		j.fatalf("Invalid format: %v", err)
+	}
+
+	dbClient := j.connect()
+	defer j.close()
+
+	// Edits are recorded in the book history as made by the import job
+	write := func(ctx context.Context, books []adaptor.ImportBook) ([]bool, error) {
+		return dbClient.ImportBooks(ctx, "app import", books)
+	}
+	report, err := importer.Import(context.Background(), input, format, *batchSize, write)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if err != nil {
+		j.fatalf("Import stopped: %v", err)
+	}
+	j.logger.Printf("%d created, %d updated, %d failed", report.Created, report.Updated, report.Failed)
+}
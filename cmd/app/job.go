@@ -0,0 +1,68 @@
+package main
+
+import (
+	"app/database/adaptor"
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// job holds what the subcommands share: a logger, their flags, among them
+// --config, and the database connection once connected.
+type job struct {
+	logger     *log.Logger
+	flags      *flag.FlagSet
+	configPath *string
+	dbConn     *pgx.Conn
+}
+
+// newJob returns the job of a subcommand. args start with the subcommand
+// name; the subcommand adds its own flags before calling parse.
+func newJob(args []string, prefix string) *job {
+	flagSet := flag.NewFlagSet(args[0], flag.ExitOnError)
+	return &job{
+		logger:     log.New(os.Stderr, prefix, log.Ldate|log.Ltime),
+		flags:      flagSet,
+		configPath: flagSet.String("config", "", "configuration files"),
+	}
+}
+
+// parse parses the flags of the subcommand.
+func (j *job) parse(args []string) {
+	j.flags.Parse(args[1:])
+}
+
+// connect loads the configuration and connects to the database. The
+// caller closes the connection with close.
+func (j *job) connect() *adaptor.PostgresClient {
+	config := &appConfig{}
+	if err := loadConfig(config, *j.configPath); err != nil {
+		j.fatalf("loadConfig failed. error: %v", err)
+	}
+
+	dbConn, err := connectDB(config)
+	if err != nil {
+		j.fatalf("Unable to connect to database: %v", err)
+	}
+	j.dbConn = dbConn
+	return adaptor.NewPostgresClient(dbConn)
+}
+
+// close closes the database connection, if any.
+func (j *job) close() {
+	if j.dbConn != nil {
+		j.dbConn.Close(context.Background())
+		j.dbConn = nil
+	}
+}
+
+// fatalf logs like log.Fatalf, closing the database connection before the
+// process exits, which deferred calls would not.
+func (j *job) fatalf(format string, v ...interface{}) {
+	j.logger.Printf(format, v...)
+	j.close()
+	os.Exit(1)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"app/auth"
+	"app/blob"
 	"app/database/adaptor"
 	handler "app/handler"
 	"context"
@@ -12,7 +13,6 @@ import (
 	"strings"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/julienschmidt/httprouter"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
@@ -40,6 +40,8 @@ type appConfig struct {
 	PostgresPort    string `yaml:"postgresPort"`
 	PostgresSSLMode string `yaml:"postgresSSLMode"`
 	PostgresDB      string `yaml:"postgresDB"`
+	// CoverDir is where cover images are stored, data/covers by default
+	CoverDir string `yaml:"coverDir"`
 }
 
 // Obfuscate obfuscates the config
@@ -55,26 +57,262 @@ func (config *appConfig) Validate() error {
 	return nil
 }
 
-func SetupRoutes(router *httprouter.Router, dbc *adaptor.PostgresClient, auth auth.Authenticator, log *log.Logger) {
+func SetupRoutes(router *handler.Router, dbc *adaptor.PostgresClient, covers blob.Store, auth auth.Authenticator, log *log.Logger) {
 	// Book handlers with middleware for Role-based authorization
 	// For Admin Users
 	router.Handler("POST", "/admin/books", handler.JWTAuthMiddleware(
 		handler.Adapt(handler.AddANewBookHandler(dbc, log)),
 	))
 
+	router.Priority("POST", "/admin/books/import", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ImportBooksHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/export/books", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ExportBooksHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/export/loans", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ExportLoansHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/export/marc", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ExportMARCHandler(dbc, log)),
+	))
+
 	router.Handler("PUT", "/admin/books/:book_id", handler.JWTAuthMiddleware(
 		handler.Adapt(handler.UpdateBookHandler(dbc, log)),
 	))
 
+	router.Handler("PATCH", "/admin/books/:book_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.PatchBookHandler(dbc, log)),
+	))
+
 	router.Handler("DELETE", "/admin/books/:book_id", handler.JWTAuthMiddleware(
 		handler.Adapt(handler.DeleteBookHandler(dbc, log)),
 	))
 
+	router.Handler("POST", "/admin/books/:book_id/cover", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.UploadCoverHandler(dbc, covers, log)),
+	))
+
+	router.Handler("GET", "/admin/books/:book_id/history", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.BookHistoryHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/books/:book_id/history/:revision/revert", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.RevertBookHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/books/:book_id/restore", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.RestoreBookHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/books/:book_id/authors", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.AddBookAuthorsHandler(dbc, log)),
+	))
+
+	router.Handler("DELETE", "/admin/books/:book_id/authors/:author_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.RemoveBookAuthorHandler(dbc, log)),
+	))
+
+	// Physical copies
+	router.Handler("POST", "/admin/books/:book_id/copies", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.AddBookCopyHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/books/:book_id/copies", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ListBookCopiesHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/books/:book_id/holds", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ListBookHoldsHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/copies/:copy_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.GetBookCopyHandler(dbc, log)),
+	))
+
+	router.Handler("PUT", "/admin/copies/:copy_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.UpdateBookCopyHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/copies/:copy_id/retire", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.RetireBookCopyHandler(dbc, log)),
+	))
+
+	// Author management
+	router.Handler("POST", "/admin/authors", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.CreateAuthorHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/authors", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ListAuthorsHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/authors/:author_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.GetAuthorHandler(dbc, log)),
+	))
+
+	router.Handler("PUT", "/admin/authors/:author_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.UpdateAuthorHandler(dbc, log)),
+	))
+
+	router.Handler("DELETE", "/admin/authors/:author_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.DeleteAuthorHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/authors/:author_id/merge", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.MergeAuthorsHandler(dbc, log)),
+	))
+
+	// Subject taxonomy
+	router.Handler("POST", "/admin/subjects", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.CreateSubjectHandler(dbc, log)),
+	))
+
+	router.Handler("PUT", "/admin/subjects/:subject_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.UpdateSubjectHandler(dbc, log)),
+	))
+
+	router.Handler("DELETE", "/admin/subjects/:subject_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.DeleteSubjectHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/books/:book_id/subjects", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.AddBookSubjectsHandler(dbc, log)),
+	))
+
+	router.Handler("DELETE", "/admin/books/:book_id/subjects/:subject_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.RemoveBookSubjectHandler(dbc, log)),
+	))
+
+	// Works and their editions
+	router.Handler("PUT", "/admin/works/:work_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.UpdateWorkHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/works/:work_id/editions", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.AttachEditionsHandler(dbc, log)),
+	))
+
+	// Review moderation
+	router.Handler("GET", "/admin/reviews", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ListReviewsHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/reviews/:review_id/hide", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.HideReviewHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/reviews/:review_id/unhide", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.UnhideReviewHandler(dbc, log)),
+	))
+
+	// Branches and transfers of copies between them
+	router.Handler("POST", "/admin/branches", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.AddBranchHandler(dbc, log)),
+	))
+
+	router.Handler("PUT", "/admin/branches/:branch_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.UpdateBranchHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/transfers", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.TransferCopiesHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/transfers", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ListTransfersHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/transfers/:transfer_id/receive", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ReceiveTransferHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/transfers/:transfer_id/cancel", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.CancelTransferHandler(dbc, log)),
+	))
+
+	// Loans and loan policies
+	router.Handler("GET", "/admin/loans", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ListLoansHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/loans/overdue", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ListOverdueLoansHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/borrowing-limits", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ListBorrowingLimitsHandler(dbc, log)),
+	))
+
+	router.Handler("PUT", "/admin/borrowing-limits", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.SetBorrowingLimitHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/loan-policies", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ListLoanPoliciesHandler(dbc, log)),
+	))
+
+	router.Handler("PUT", "/admin/loan-policies", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.SetLoanPolicyHandler(dbc, log)),
+	))
+
+	router.Handler("DELETE", "/admin/loan-policies/:policy_id", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.DeleteLoanPolicyHandler(dbc, log)),
+	))
+
+	// Fines and patron accounts
+	router.Handler("GET", "/admin/users/:user_id/account", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.GetUserAccountHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/users/:user_id/account/waivers", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.WaiveFineHandler(dbc, log)),
+	))
+
+	router.Handler("POST", "/admin/users/:user_id/account/payments", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.RecordPaymentHandler(dbc, log)),
+	))
+
+	router.Handler("GET", "/admin/fee-schedules", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.ListFeeSchedulesHandler(dbc, log)),
+	))
+
+	router.Handler("PUT", "/admin/fee-schedules", handler.JWTAuthMiddleware(
+		handler.Adapt(handler.SetFeeScheduleHandler(dbc, log)),
+	))
+
 	// For all logged-in users
+	router.Handler("GET", "/books", handler.Adapt(handler.ListBooksHandler(dbc, log)))
+	router.Priority("GET", "/books/search", handler.Adapt(handler.SearchBooksHandler(dbc, log)))
+	router.Priority("GET", "/books/isbn/:isbn", handler.Adapt(handler.GetBookByISBNHandler(dbc, log)))
 	router.Handler("GET", "/books/:book_id", handler.Adapt(handler.GetBooksByIDHandler(dbc, log)))
+	router.Handler("GET", "/books/:book_id/reviews", handler.Adapt(handler.ListBookReviewsHandler(dbc, log)))
+	router.Priority("POST", "/books/:book_id/reviews", handler.Adapt(handler.ReviewBookHandler(dbc, log)))
+	router.Handler("DELETE", "/books/:book_id/reviews", handler.Adapt(handler.DeleteReviewHandler(dbc, log)))
+	// Without authentication: img tags send no Authorization header
+	router.GET("/books/:book_id/cover", handler.GetCoverHandler(dbc, covers, log))
+	// Authentication is optional, signed-in callers don't get their loans
+	router.GET("/books/:book_id/recommendations", handler.BookRecommendationsHandler(dbc, log))
+	router.Handler("GET", "/authors/:author_id/books", handler.Adapt(handler.ListAuthorBooksHandler(dbc, log)))
+	router.Handler("GET", "/subjects", handler.Adapt(handler.ListSubjectsHandler(dbc, log)))
+	router.Handler("GET", "/subjects/:subject_id", handler.Adapt(handler.GetSubjectHandler(dbc, log)))
+	router.Handler("GET", "/works", handler.Adapt(handler.ListWorksHandler(dbc, log)))
+	router.Handler("GET", "/works/:work_id", handler.Adapt(handler.GetWorkHandler(dbc, log)))
+	router.Handler("GET", "/branches", handler.Adapt(handler.ListBranchesHandler(dbc, log)))
 	router.Handler("POST", "/books/borrow/:user_id/:book_id", handler.Adapt(handler.BorrowBookHandler(dbc, log)))
 	router.Handler("POST", "/books/return/:user_id/:book_id", handler.Adapt(handler.ReturnBookHandler(dbc, log)))
+	router.Handler("POST", "/loans/:loan_id/renew", handler.Adapt(handler.RenewLoanHandler(dbc, log)))
 	router.Handler("GET", "/users/:user_id/books", handler.Adapt(handler.ViewBorrowedBooksHandler(dbc, log)))
+	router.Handler("GET", "/users/:user_id/loans", handler.Adapt(handler.UserLoansHandler(dbc, log)))
+	router.Handler("GET", "/me/recommendations", handler.Adapt(handler.MyRecommendationsHandler(dbc, log)))
+	router.Priority("POST", "/books/:book_id/holds", handler.Adapt(handler.PlaceHoldHandler(dbc, log)))
+	router.Handler("GET", "/me/holds", handler.Adapt(handler.MyHoldsHandler(dbc, log)))
+	router.Handler("GET", "/me/account", handler.Adapt(handler.MyAccountHandler(dbc, log)))
+	router.Handler("GET", "/holds/:hold_id", handler.Adapt(handler.GetHoldHandler(dbc, log)))
+	router.Handler("DELETE", "/holds/:hold_id", handler.Adapt(handler.CancelHoldHandler(dbc, log)))
 
 	// User handlers
 	router.POST("/login", handler.LoginHandler(dbc, auth, log))
@@ -88,7 +326,11 @@ func ParseConfig(config interface{}, args []string) error {
 	if err := flagSet.Parse(args[1:]); err != nil {
 		return err
 	}
-	commaSeparatedPaths := *configPathStr
+	return loadConfig(config, *configPathStr)
+}
+
+// loadConfig reads the config object from the config file
+func loadConfig(config interface{}, commaSeparatedPaths string) error {
 	configPaths := strings.Split(commaSeparatedPaths, ",")
 
 	var configByte []byte
@@ -102,12 +344,20 @@ func ParseConfig(config interface{}, args []string) error {
 	}
 	err := yaml.Unmarshal(configByte, config)
 	if err != nil {
-		return errors.Errorf("failed to unmarshal config. configPath: %s, error: %v", *configPathStr, err)
+		return errors.Errorf("failed to unmarshal config. configPath: %s, error: %v", commaSeparatedPaths, err)
 	}
 
 	return nil
 }
 
+// connectDB opens the postgres connection described by the config
+func connectDB(config *appConfig) (*pgx.Conn, error) {
+	psqlInfo := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s?sslmode=%s",
+		config.PostgresUser, config.PostgresPass, config.PostgresHost, config.PostgresPort, config.PostgresDB, config.PostgresSSLMode)
+
+	return pgx.Connect(context.Background(), psqlInfo)
+}
+
 // runMain is the main function
 func runMain(args []string) {
 	config := &appConfig{}
@@ -121,23 +371,29 @@ func runMain(args []string) {
 	logger.Printf("Starting %s", config.AppName)
 
 	// Setup database connection
-	// Create a new postgres client
-	psqlInfo := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s?sslmode=%s",
-		config.PostgresUser, config.PostgresPass, config.PostgresHost, config.PostgresPort, config.PostgresDB, config.PostgresSSLMode)
-
-	dbConn, err := pgx.Connect(context.Background(), psqlInfo)
+	dbConn, err := connectDB(config)
 	if err != nil {
 		logger.Fatalf("Unable to connect to database: %v", err)
 	}
 
 	dbClient := adaptor.NewPostgresClient(dbConn)
 
+	// Setup cover image storage on the local filesystem
+	coverDir := config.CoverDir
+	if coverDir == "" {
+		coverDir = "data/covers"
+	}
+	covers, err := blob.NewFileStore(coverDir)
+	if err != nil {
+		logger.Fatalf("Unable to open cover storage %s: %v", coverDir, err)
+	}
+
 	// Setup authentication with Password OR Web3
 	auth := auth.NewAuthenticator("Password")
 
 	router := handler.NewRouter()
 
-	SetupRoutes(router, dbClient, auth, logger)
+	SetupRoutes(router, dbClient, covers, auth, logger)
 
 	server := handler.NewServer(config.Port, router)
 
@@ -149,5 +405,24 @@ func runMain(args []string) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			runImport(os.Args[1:])
+			return
+		case "purge":
+			runPurge(os.Args[1:])
+			return
+		case "recommend":
+			runRecommend(os.Args[1:])
+			return
+		case "expire-holds":
+			runExpireHolds(os.Args[1:])
+			return
+		case "accrue-fines":
+			runAccrueFines(os.Args[1:])
+			return
+		}
+	}
 	runMain(os.Args)
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// runPurge is the purge subcommand. It deletes books that have been archived
+// for longer than the retention period, together with their loan history,
+// and prints the purge report as JSON:
+//
+//	app purge --config configs/app.yaml [--older-than 720h]
+//
+// Books that still have outstanding loans are skipped and listed in the
+// report. The job is meant to run periodically, e.g. from cron.
+func runPurge(args []string) {
+	j := newJob(args, "PURGE: ")
+	olderThan := j.flags.Duration("older-than", 30*24*time.Hour, "purge books archived at least this long ago")
+	j.parse(args)
+
+	if *olderThan < 0 {
+		j.fatalf("Invalid --older-than %v", *olderThan)
+	}
+
+	dbClient := j.connect()
+	defer j.close()
+
+	report, err := dbClient.PurgeArchivedBooks(context.Background(), time.Now().Add(-*olderThan))
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if err != nil {
+		j.fatalf("Purge stopped: %v", err)
+	}
+	j.logger.Printf("%d purged, %d skipped", len(report.Purged), len(report.Skipped))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"app/database/adaptor"
+	"context"
+)
+
+// runRecommend is the recommend subcommand. It recomputes the "patrons who
+// borrowed this also borrowed" recommendations of every book from the loan
+// history:
+//
+//	app recommend --config configs/app.yaml [--min-co-borrowers 1] [--per-book 20]
+//
+// Recommendations are only as fresh as the last run, so the job is meant to
+// run periodically, e.g. nightly from cron.
+func runRecommend(args []string) {
+	j := newJob(args, "RECOMMEND: ")
+	minCoBorrowers := j.flags.Int("min-co-borrowers", 1, "patrons who must have borrowed both books")
+	perBook := j.flags.Int("per-book", 20, "recommendations kept for each book")
+	j.parse(args)
+
+	if *minCoBorrowers < 1 {
+		j.fatalf("Invalid --min-co-borrowers %d", *minCoBorrowers)
+	}
+	if *perBook < 1 {
+		j.fatalf("Invalid --per-book %d", *perBook)
+	}
+
+	dbClient := j.connect()
+	defer j.close()
+
+	stored, err := dbClient.RefreshRecommendations(context.Background(), adaptor.RecommendationOptions{
+		MinCoBorrowers: int32(*minCoBorrowers),
+		PerBook:        int32(*perBook),
+	})
+	if err != nil {
+		j.fatalf("Recommendations failed: %v", err)
+	}
+	j.logger.Printf("%d recommendations stored", stored)
+}
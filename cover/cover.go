@@ -0,0 +1,150 @@
+// Package cover validates uploaded book cover images and renders their
+// thumbnails. Covers may be JPEG, PNG or GIF; thumbnails are always JPEG.
+package cover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"net/http"
+
+	// Register the decoders of the accepted formats
+	_ "image/gif"
+	_ "image/png"
+)
+
+// MaxSize is the largest accepted upload, in bytes.
+const MaxSize = 5 << 20
+
+// MaxPixels bounds the decoded size of an image, so a small file cannot
+// expand into a huge bitmap.
+const MaxPixels = 40_000_000
+
+// Size is a thumbnail size: the longest side of the image in pixels.
+type Size struct {
+	Name    string
+	MaxSide int
+}
+
+// Sizes are the thumbnails rendered for every cover, smallest first.
+var Sizes = []Size{
+	{Name: "small", MaxSide: 120},
+	{Name: "medium", MaxSide: 320},
+	{Name: "large", MaxSide: 800},
+}
+
+// DefaultSize is the thumbnail served when no size is asked for.
+const DefaultSize = "medium"
+
+// ContentType is the media type of every thumbnail.
+const ContentType = "image/jpeg"
+
+var (
+	// ErrUnsupportedType is returned for files that are not JPEG, PNG or GIF.
+	ErrUnsupportedType = errors.New("cover must be a JPEG, PNG or GIF image")
+	// ErrTooLarge is returned for files or images above MaxSize or MaxPixels.
+	ErrTooLarge = errors.New("cover image is too large")
+)
+
+var acceptedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// LookupSize returns the thumbnail size with the given name.
+func LookupSize(name string) (Size, bool) {
+	for _, s := range Sizes {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Size{}, false
+}
+
+// Decode reads and checks an uploaded cover. The type is taken from the
+// content, not from the file name or the declared content type.
+func Decode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxSize {
+		return nil, ErrTooLarge
+	}
+	if !acceptedTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	return img, nil
+}
+
+// Thumbnail scales src, as returned by Flatten, down so that its longest
+// side is at most maxSide, averaging the source pixels behind every
+// thumbnail pixel. Smaller images are kept at their size.
+func Thumbnail(src *image.RGBA, maxSide int) image.Image {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dw, dh := sw, sh
+	if sw >= sh && sw > maxSide {
+		dw, dh = maxSide, max(1, sh*maxSide/sw)
+	} else if sh > sw && sh > maxSide {
+		dw, dh = max(1, sw*maxSide/sh), maxSide
+	}
+	if dw == sw && dh == sh {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r, g, b, a = r+int(p[0]), g+int(p[1]), b+int(p[2]), a+int(p[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// Flatten copies img onto a white RGBA canvas with its origin at 0,0, so
+// transparent areas come out white in the JPEG thumbnails. It is done once
+// per upload, the copy is as large as the image.
+func Flatten(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+	return dst
+}
+
+// Encode writes a thumbnail as JPEG.
+func Encode(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+}
@@ -2,15 +2,46 @@ package adaptor
 
 import (
 	"app/database/db"
+	"app/isbn"
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+var (
+	// ErrNotFound is returned when the requested row does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a change clashes with existing data.
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidInput is returned when a value is rejected by a business rule.
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrNotAvailable is returned when no copy of a book can be borrowed.
+	ErrNotAvailable = errors.New("book not available")
+	// ErrVersionMismatch is returned when a change is made against a version
+	// of a row that is no longer the current one.
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrForbidden is returned when the user may not do what they asked for.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is a Postgres foreign key violation.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
+
 // DBConnection interface
 type DBConnection interface {
 	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
@@ -52,7 +83,7 @@ func (p *PostgresClient) execTx(ctx context.Context, fn func(*db.Queries) error)
 	if err = fn(q); err != nil {
 		p.logger.Printf("failed to execute transaction, error: %v", err)
 		if rberr := tx.Rollback(ctx); rberr != nil {
-			p.logger.Printf("failed to rollback transaction", rberr)
+			p.logger.Printf("failed to rollback transaction, error: %v", rberr)
 		}
 		return err
 	}
@@ -66,6 +97,7 @@ func NewPostgresClient(dbConn DBConnection) *PostgresClient {
 	return &PostgresClient{
 		dbConn:  adapter,
 		queries: db.New(adapter), // Use the adapter here
+		logger:  log.Default(),
 	}
 }
 
@@ -109,87 +141,427 @@ func (a *PgTransactionAdapter) QueryRow(ctx context.Context, sql string, args ..
 	return a.tx.QueryRow(ctx, sql, args...)
 }
 
-func (p *PostgresClient) DeleteBook(ctx context.Context, id int32) error {
-	return p.execTx(ctx, func(q *db.Queries) error {
-		err := q.DeleteBook(ctx, id)
+// DeleteBook archives a book: it leaves the catalog and can no longer be
+// borrowed, but its loans are kept. Archived books are removed for good by
+// PurgeBook.
+func (p *PostgresClient) DeleteBook(ctx context.Context, id int32, version int32) error {
+	n, err := p.queries.ArchiveBook(ctx, db.ArchiveBookParams{ID: id, Version: version})
+	if err != nil {
 		return err
-	})
-}
+	}
+	if n > 0 {
+		return nil
+	}
 
-func (p *PostgresClient) UpdateBook(ctx context.Context, book db.EditBookParams) error {
-	return p.queries.EditBook(ctx, book)
+	// Missing, already archived or changed since version
+	book, err := p.queries.GetBook(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) || book.ArchivedAt.Valid {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return ErrVersionMismatch
 }
 
-func (p *PostgresClient) CreateBook(ctx context.Context, book db.AddBookParams, author db.Author) error {
-	// Add book
-	bookId, err := p.queries.AddBook(ctx, book)
+// UpdateBook edits the details of a book and records the change in its
+// history under changedBy. A non-zero book.Version must be the current
+// version of the book. It returns the new version.
+func (p *PostgresClient) UpdateBook(ctx context.Context, changedBy string, book db.EditBookParams) (int32, error) {
+	var err error
+	book.Isbn, err = normalizeISBN(book.Isbn)
 	if err != nil {
+		return 0, err
+	}
+
+	var version int32
+	err = p.execTx(ctx, func(q *db.Queries) error {
+		var err error
+		_, version, err = editBook(ctx, q, changedBy, book)
 		return err
+	})
+	return version, err
+}
+
+// BookPatch is a partial update of the details of a book. Nil fields are
+// left as they are; an ISBN or published year that is not Valid is removed.
+type BookPatch struct {
+	Title         *string
+	Description   *string
+	ISBN          *pgtype.Text
+	Edition       *string
+	Publisher     *string
+	PublishedYear *pgtype.Int4
+	Language      *string
+}
+
+// PatchBook changes only the fields of a book present in the patch and
+// records the change in its history under changedBy. A non-zero version
+// must be the current version of the book. It returns the new version.
+func (p *PostgresClient) PatchBook(ctx context.Context, changedBy string, bookID int32, version int32, patch BookPatch) (int32, error) {
+	if patch.Title != nil && strings.TrimSpace(*patch.Title) == "" {
+		return 0, fmt.Errorf("title must not be empty: %w", ErrInvalidInput)
+	}
+	if patch.PublishedYear != nil && patch.PublishedYear.Valid && patch.PublishedYear.Int32 <= 0 {
+		return 0, fmt.Errorf("published_year must be positive: %w", ErrInvalidInput)
+	}
+	if patch.ISBN != nil {
+		normalized, err := normalizeISBN(*patch.ISBN)
+		if err != nil {
+			return 0, err
+		}
+		patch.ISBN = &normalized
 	}
 
-	// Add author
-	authorId, err := p.queries.AddAuthor(ctx, db.AddAuthorParams{
-		Name: author.Name,
-		Bio:  author.Bio,
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		current, err := q.GetBook(ctx, bookID)
+		if errors.Is(err, pgx.ErrNoRows) || current.ArchivedAt.Valid {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		book := db.EditBookParams{
+			ID:            bookID,
+			Title:         current.Title,
+			Description:   current.Description,
+			Isbn:          current.Isbn,
+			Edition:       current.Edition,
+			Publisher:     current.Publisher,
+			PublishedYear: current.PublishedYear,
+			Language:      current.Language,
+			Version:       version,
+		}
+		if patch.Title != nil {
+			book.Title = *patch.Title
+		}
+		if patch.Description != nil {
+			book.Description = *patch.Description
+		}
+		if patch.ISBN != nil {
+			book.Isbn = *patch.ISBN
+		}
+		if patch.Edition != nil {
+			book.Edition = *patch.Edition
+		}
+		if patch.Publisher != nil {
+			book.Publisher = *patch.Publisher
+		}
+		if patch.PublishedYear != nil {
+			book.PublishedYear = *patch.PublishedYear
+		}
+		if patch.Language != nil {
+			book.Language = *patch.Language
+		}
+
+		_, version, err = editBook(ctx, q, changedBy, book)
+		return err
 	})
+	return version, err
+}
+
+// CreateBook adds a book with the given number of copies and returns the new
+// book ID. A book with a WorkID is a new edition of that work, the others
+// start a work of their own. The authors are added to the work.
+// Authors with an ID reference existing rows, the others are created.
+func (p *PostgresClient) CreateBook(ctx context.Context, book db.AddBookParams, copies int32, authors []db.Author) (int32, error) {
+	var err error
+	book.Isbn, err = normalizeISBN(book.Isbn)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// Add book author
-	err = p.queries.AddBookAuthor(ctx, db.AddBookAuthorParams{
-		BookID:   bookId,
-		AuthorID: authorId,
+	var bookID int32
+	err = p.execTx(ctx, func(q *db.Queries) error {
+		var err error
+		bookID, err = createBook(ctx, q, book, copies, authors)
+		return err
 	})
-	return err
+	return bookID, err
+}
 
+// createBook adds a book, and its work when it has none, inside a transaction.
+func createBook(ctx context.Context, q *db.Queries, book db.AddBookParams, copies int32, authors []db.Author) (int32, error) {
+	if book.WorkID > 0 {
+		if _, err := q.GetWork(ctx, book.WorkID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return 0, fmt.Errorf("work %d: %w", book.WorkID, ErrNotFound)
+			}
+			return 0, err
+		}
+	} else {
+		var err error
+		book.WorkID, err = q.AddWork(ctx, db.AddWorkParams{Title: book.Title, Description: book.Description})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	bookID, err := q.AddBook(ctx, book)
+	if isUniqueViolation(err) {
+		return 0, fmt.Errorf("isbn %s is already in the catalog: %w", book.Isbn.String, ErrConflict)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if copies > 0 {
+		err = q.AddBookCopies(ctx, db.AddBookCopiesParams{BookID: bookID, Copies: copies})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return bookID, addWorkAuthors(ctx, q, book.WorkID, authors)
 }
 
-func (p *PostgresClient) GetBookByID(ctx context.Context, bookID int32) (db.GetBookWithAuthorsByIDRow, error) {
-	return p.queries.GetBookWithAuthorsByID(ctx, bookID)
+// bookWorkID returns the work a book is an edition of.
+func bookWorkID(ctx context.Context, q *db.Queries, bookID int32) (int32, error) {
+	book, err := q.GetBook(ctx, bookID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return book.WorkID, nil
 }
 
-func (p *PostgresClient) ReturnBook(ctx context.Context, userID int32, bookID int32) error {
-	return p.execTx(ctx, func(q *db.Queries) error {
+// BookDetail is a book together with every one of its authors and subjects,
+// which it shares with the other editions of its work.
+// Isbn10 is set when the book's ISBN has an ISBN-10 form.
+type BookDetail struct {
+	db.GetBookRow
+	Isbn10   string
+	Authors  []db.Author
+	Subjects []db.Subject
+	// Branches holds the copies of the book at each branch
+	Branches []db.ListBookBranchInventoryRow
+}
 
-		err := q.UpdateBookCopiesAddOne(ctx, bookID)
+// GetBookByID returns a book of the catalog; archived books are not found.
+func (p *PostgresClient) GetBookByID(ctx context.Context, bookID int32) (BookDetail, error) {
+	book, err := p.queries.GetBook(ctx, bookID)
+	if errors.Is(err, pgx.ErrNoRows) || book.ArchivedAt.Valid {
+		return BookDetail{}, ErrNotFound
+	}
+	if err != nil {
+		return BookDetail{}, err
+	}
+
+	authors, err := p.queries.ListAuthorsByWorkID(ctx, book.WorkID)
+	if err != nil {
+		return BookDetail{}, err
+	}
+	if authors == nil {
+		authors = []db.Author{}
+	}
+
+	subjects, err := p.queries.ListSubjectsByWorkID(ctx, book.WorkID)
+	if err != nil {
+		return BookDetail{}, err
+	}
+	if subjects == nil {
+		subjects = []db.Subject{}
+	}
+
+	branches, err := p.queries.ListBookBranchInventory(ctx, book.ID)
+	if err != nil {
+		return BookDetail{}, err
+	}
+
+	detail := BookDetail{GetBookRow: book, Authors: authors, Subjects: subjects, Branches: branches}
+	if book.Isbn.Valid {
+		detail.Isbn10, _ = isbn.To10(book.Isbn.String)
+	}
+	return detail, nil
+}
+
+// AddBookAuthors links more authors to the work of an existing book, and so
+// to all of its editions.
+func (p *PostgresClient) AddBookAuthors(ctx context.Context, bookID int32, authors []db.Author) error {
+	return p.execTx(ctx, func(q *db.Queries) error {
+		workID, err := bookWorkID(ctx, q, bookID)
 		if err != nil {
 			return err
 		}
 
-		err = q.UpdateReturnedBook(ctx, db.UpdateReturnedBookParams{UserID: userID, BookID: bookID})
+		return addWorkAuthors(ctx, q, workID, authors)
+	})
+}
+
+// RemoveBookAuthor unlinks an author from the work of a book. The author
+// itself is kept.
+func (p *PostgresClient) RemoveBookAuthor(ctx context.Context, bookID int32, authorID int32) error {
+	return p.execTx(ctx, func(q *db.Queries) error {
+		workID, err := bookWorkID(ctx, q, bookID)
 		if err != nil {
 			return err
 		}
 
-		return err
+		n, err := q.RemoveWorkAuthor(ctx, db.RemoveWorkAuthorParams{WorkID: workID, AuthorID: authorID})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return nil
 	})
 }
 
-func (p *PostgresClient) BorrowBook(ctx context.Context, userID int32, bookID int32) error {
+// addWorkAuthors links authors to a work inside a transaction.
+// Authors with an ID must already exist, authors without one are looked up by
+// normalized name and only created when no such author exists yet.
+func addWorkAuthors(ctx context.Context, q *db.Queries, workID int32, authors []db.Author) error {
+	for _, author := range authors {
+		authorID := author.ID
+		if authorID > 0 {
+			if _, err := q.GetAuthor(ctx, authorID); err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					return fmt.Errorf("author %d: %w", authorID, ErrNotFound)
+				}
+				return err
+			}
+		} else {
+			var err error
+			authorID, err = q.GetOrCreateAuthor(ctx, db.GetOrCreateAuthorParams{
+				Name: author.Name,
+				Bio:  author.Bio,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		err := q.AddWorkAuthor(ctx, db.AddWorkAuthorParams{
+			WorkID:   workID,
+			AuthorID: authorID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReturnBook closes the oldest outstanding loan of the book by the user and
+// puts the copy back on the shelf, or sets it aside for the next hold. A
+// copy returned at a branch, when branchID is not zero, is shelved at that
+// branch.
+func (p *PostgresClient) ReturnBook(ctx context.Context, userID int32, bookID int32, branchID int32) error {
 	return p.execTx(ctx, func(q *db.Queries) error {
-		// check number of copy first
-		numCopy, err := q.GetAvailableCopies(ctx, bookID)
+		if err := checkBranch(ctx, q, branchID); err != nil {
+			return err
+		}
+
+		loan, err := q.GetActiveLoan(ctx, db.GetActiveLoanParams{UserID: userID, BookID: bookID})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("no outstanding loan: %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = q.UpdateReturnedBook(ctx, loan.ID)
+		if err != nil {
+			return err
+		}
+
+		if !loan.CopyID.Valid {
+			return nil
+		}
+		err = q.ShelveCopy(ctx, db.ShelveCopyParams{
+			ID:       loan.CopyID.Int32,
+			BranchID: pgtype.Int4{Int32: branchID, Valid: branchID != 0},
+		})
 		if err != nil {
 			return err
 		}
+		return allocateHeldCopies(ctx, q, bookID)
+	})
+}
+
+// BorrowBook lends the user the copy set aside for their hold or else one
+// available copy of the book, from the given branch or, when branchID is
+// zero, from any branch. The loan is due back after the period of the loan
+// policy for the user's role and the book. Patrons at the borrowing limits
+// of their role or owing more fines than their fee schedule allows cannot
+// borrow: BorrowBook then fails with a BorrowError.
+func (p *PostgresClient) BorrowBook(ctx context.Context, userID int32, bookID int32, branchID int32) (db.BorrowedBook, error) {
+	var loan db.BorrowedBook
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		if err := checkBranch(ctx, q, branchID); err != nil {
+			return err
+		}
+
+		// Borrows of the same user wait for each other from here on
+		if _, err := q.LockUser(ctx, userID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("user %d: %w", userID, ErrNotFound)
+			}
+			return err
+		}
+		if err := checkBorrowingLimits(ctx, q, userID, bookID); err != nil {
+			return err
+		}
+		if err := checkBalance(ctx, q, userID); err != nil {
+			return err
+		}
 
-		if numCopy == 0 {
-			return errors.New("book not available")
+		if _, err := expireHolds(ctx, q, pgtype.Int4{Int32: bookID, Valid: true}); err != nil {
+			return err
+		}
+
+		var copy db.PickAvailableCopyRow
+		hold, err := q.GetReadyHoldForUpdate(ctx, db.GetReadyHoldForUpdateParams{UserID: userID, BookID: bookID})
+		switch {
+		case err == nil:
+			if branchID != 0 && hold.BranchID != branchID {
+				return fmt.Errorf("the copy on hold is at branch %d: %w", hold.BranchID, ErrNotAvailable)
+			}
+			err = q.CloseHold(ctx, db.CloseHoldParams{ID: hold.ID, Status: HoldFulfilled})
+			if err != nil {
+				return err
+			}
+			copy = db.PickAvailableCopyRow{ID: hold.CopyID.Int32, BranchID: hold.BranchID}
+		case errors.Is(err, pgx.ErrNoRows):
+			// Lock an available copy, concurrent borrowers skip it
+			copy, err = q.PickAvailableCopy(ctx, db.PickAvailableCopyParams{
+				BookID:   bookID,
+				BranchID: pgtype.Int4{Int32: branchID, Valid: branchID != 0},
+			})
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotAvailable
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return err
 		}
 
-		err = q.BorrowBook(ctx, bookID)
+		err = q.SetCopyStatus(ctx, db.SetCopyStatusParams{ID: copy.ID, Status: CopyOnLoan})
 		if err != nil {
 			return err
 		}
 
-		err = q.InsertBorrowedBook(ctx, db.InsertBorrowedBookParams{UserID: userID, BookID: bookID})
+		terms, err := loanTerms(ctx, q, userID, bookID)
 		if err != nil {
 			return err
 		}
 
+		loan, err = q.InsertBorrowedBook(ctx, db.InsertBorrowedBookParams{
+			UserID:   userID,
+			BookID:   bookID,
+			CopyID:   pgtype.Int4{Int32: copy.ID, Valid: true},
+			BranchID: pgtype.Int4{Int32: copy.BranchID, Valid: true},
+			LoanDays: terms.LoanDays,
+		})
 		return err
 	})
+	return loan, err
 }
 
 func (p *PostgresClient) ListBorrowedBooks(ctx context.Context, userID int32) ([]db.ListBorrowedBooksRow, error) {
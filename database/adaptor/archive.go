@@ -0,0 +1,95 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// RestoreBook brings an archived book back into the catalog.
+func (p *PostgresClient) RestoreBook(ctx context.Context, id int32) error {
+	n, err := p.queries.RestoreBook(ctx, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// Missing or not archived
+		return ErrNotFound
+	}
+	return nil
+}
+
+// PurgeBook deletes an archived book with its copies and loan history.
+// Books that are still on loan are refused with ErrConflict, books that are
+// not archived with ErrNotFound.
+func (p *PostgresClient) PurgeBook(ctx context.Context, id int32) error {
+	return p.execTx(ctx, func(q *db.Queries) error {
+		book, err := q.GetBook(ctx, id)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if err != nil || !book.ArchivedAt.Valid {
+			return ErrNotFound
+		}
+
+		loans, err := q.CountActiveLoansByBook(ctx, id)
+		if err != nil {
+			return err
+		}
+		if loans > 0 {
+			return fmt.Errorf("book %d still has %d outstanding loans: %w", id, loans, ErrConflict)
+		}
+
+		if err := q.DeleteBookLoans(ctx, id); err != nil {
+			return err
+		}
+		if _, err := q.DeleteBook(ctx, id); err != nil {
+			return err
+		}
+		// The work goes with its last edition
+		return q.DeleteEmptyWorks(ctx, []int32{book.WorkID})
+	})
+}
+
+// PurgeReport lists what a purge run did.
+type PurgeReport struct {
+	Purged  []int32      `json:"purged"`
+	Skipped []PurgeError `json:"skipped"`
+}
+
+// PurgeError explains why a book was left in the archive.
+type PurgeError struct {
+	BookID int32  `json:"book_id"`
+	Error  string `json:"error"`
+}
+
+// PurgeArchivedBooks purges every book archived before the given time, one
+// transaction per book. Books that cannot be purged yet are skipped and
+// reported; only database failures stop the run.
+func (p *PostgresClient) PurgeArchivedBooks(ctx context.Context, archivedBefore time.Time) (PurgeReport, error) {
+	report := PurgeReport{Purged: []int32{}, Skipped: []PurgeError{}}
+
+	ids, err := p.queries.ListArchivedBookIDs(ctx, pgtype.Timestamp{Time: archivedBefore, Valid: true})
+	if err != nil {
+		return report, err
+	}
+
+	for _, id := range ids {
+		err := p.PurgeBook(ctx, id)
+		switch {
+		case err == nil:
+			report.Purged = append(report.Purged, id)
+		case errors.Is(err, ErrConflict), errors.Is(err, ErrNotFound):
+			// On loan, or restored since it was listed
+			report.Skipped = append(report.Skipped, PurgeError{BookID: id, Error: err.Error()})
+		default:
+			return report, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,142 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// CreateAuthor adds an author. It fails with ErrConflict when an author with
+// the same normalized name already exists.
+func (p *PostgresClient) CreateAuthor(ctx context.Context, name string, bio string) (db.Author, error) {
+	id, err := p.queries.AddAuthor(ctx, db.AddAuthorParams{Name: name, Bio: bio})
+	if isUniqueViolation(err) {
+		return db.Author{}, fmt.Errorf("author %q already exists: %w", name, ErrConflict)
+	}
+	if err != nil {
+		return db.Author{}, err
+	}
+	return db.Author{ID: id, Name: name, Bio: bio}, nil
+}
+
+func (p *PostgresClient) GetAuthor(ctx context.Context, id int32) (db.Author, error) {
+	author, err := p.queries.GetAuthor(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.Author{}, ErrNotFound
+	}
+	return author, err
+}
+
+// ListAuthors returns one page of authors ordered by ID, optionally limited to
+// names starting with namePrefix, and the cursor of the next page.
+func (p *PostgresClient) ListAuthors(ctx context.Context, namePrefix string, pageCursor string, limit int32) ([]db.Author, string, error) {
+	params := db.ListAuthorsParams{}
+	if namePrefix != "" {
+		params.NamePrefix = pgtype.Text{String: escapeLike(namePrefix), Valid: true}
+	}
+	if pageCursor != "" {
+		c, err := decodeCursor(pageCursor)
+		if err != nil {
+			return nil, "", err
+		}
+		params.AfterID = c.ID
+	}
+
+	limit = pageSize(limit)
+	params.PageSize = limit + 1
+
+	authors, err := p.queries.ListAuthors(ctx, params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if int32(len(authors)) > limit {
+		authors = authors[:limit]
+		next = encodeCursor(cursor{ID: authors[len(authors)-1].ID})
+	}
+	return authors, next, nil
+}
+
+func (p *PostgresClient) UpdateAuthor(ctx context.Context, author db.Author) error {
+	n, err := p.queries.UpdateAuthor(ctx, db.UpdateAuthorParams{ID: author.ID, Name: author.Name, Bio: author.Bio})
+	if isUniqueViolation(err) {
+		return fmt.Errorf("author %q already exists: %w", author.Name, ErrConflict)
+	}
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteAuthor removes an author that is no longer linked to any work.
+func (p *PostgresClient) DeleteAuthor(ctx context.Context, id int32) error {
+	return p.execTx(ctx, func(q *db.Queries) error {
+		count, err := q.CountWorksByAuthor(ctx, id)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("author still has %d works: %w", count, ErrConflict)
+		}
+
+		n, err := q.DeleteAuthor(ctx, id)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// MergeAuthors moves every work of the duplicate authors onto the canonical
+// author and deletes the duplicates.
+func (p *PostgresClient) MergeAuthors(ctx context.Context, canonicalID int32, duplicateIDs []int32) error {
+	seen := map[int32]bool{}
+	var ids []int32
+	for _, id := range duplicateIDs {
+		if id == canonicalID {
+			return fmt.Errorf("cannot merge author %d into itself: %w", id, ErrConflict)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return p.execTx(ctx, func(q *db.Queries) error {
+		if _, err := q.GetAuthor(ctx, canonicalID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("author %d: %w", canonicalID, ErrNotFound)
+			}
+			return err
+		}
+
+		err := q.MoveAuthorWorks(ctx, db.MoveAuthorWorksParams{CanonicalID: canonicalID, DuplicateIds: ids})
+		if err != nil {
+			return err
+		}
+
+		// Deleting the duplicates also drops their now redundant work links
+		n, err := q.DeleteAuthors(ctx, ids)
+		if err != nil {
+			return err
+		}
+		if n != int64(len(ids)) {
+			return fmt.Errorf("some duplicate authors do not exist: %w", ErrNotFound)
+		}
+		return nil
+	})
+}
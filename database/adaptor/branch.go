@@ -0,0 +1,216 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Transfer statuses
+const (
+	TransferInTransit = "in_transit"
+	TransferReceived  = "received"
+	TransferCancelled = "cancelled"
+)
+
+// checkBranch makes sure a branch exists; zero stands for any branch.
+func checkBranch(ctx context.Context, q *db.Queries, branchID int32) error {
+	if branchID == 0 {
+		return nil
+	}
+	_, err := q.GetBranch(ctx, branchID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("branch %d: %w", branchID, ErrNotFound)
+	}
+	return err
+}
+
+func validBranch(branch db.Branch) error {
+	if strings.TrimSpace(branch.Code) == "" || strings.TrimSpace(branch.Name) == "" {
+		return fmt.Errorf("branch code and name are required: %w", ErrInvalidInput)
+	}
+	return nil
+}
+
+// AddBranch opens a branch. Branch codes are unique.
+func (p *PostgresClient) AddBranch(ctx context.Context, branch db.AddBranchParams) (db.Branch, error) {
+	if err := validBranch(db.Branch{Code: branch.Code, Name: branch.Name}); err != nil {
+		return db.Branch{}, err
+	}
+
+	added, err := p.queries.AddBranch(ctx, branch)
+	if isUniqueViolation(err) {
+		return db.Branch{}, fmt.Errorf("branch code %q already exists: %w", branch.Code, ErrConflict)
+	}
+	return added, err
+}
+
+func (p *PostgresClient) ListBranches(ctx context.Context) ([]db.Branch, error) {
+	return p.queries.ListBranches(ctx)
+}
+
+// UpdateBranch changes the code, name and address of a branch.
+func (p *PostgresClient) UpdateBranch(ctx context.Context, branch db.UpdateBranchParams) error {
+	if err := validBranch(db.Branch{Code: branch.Code, Name: branch.Name}); err != nil {
+		return err
+	}
+
+	n, err := p.queries.UpdateBranch(ctx, branch)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("branch code %q already exists: %w", branch.Code, ErrConflict)
+	}
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TransferCopies sends available copies to another branch. The copies are
+// in transit, and cannot be borrowed, until the transfer is received or
+// cancelled.
+func (p *PostgresClient) TransferCopies(ctx context.Context, requestedBy string, copyIDs []int32, toBranchID int32) ([]db.CopyTransfer, error) {
+	if len(copyIDs) == 0 {
+		return nil, fmt.Errorf("no copies to transfer: %w", ErrInvalidInput)
+	}
+
+	transfers := make([]db.CopyTransfer, 0, len(copyIDs))
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		if toBranchID == 0 {
+			return fmt.Errorf("destination branch is required: %w", ErrInvalidInput)
+		}
+		if err := checkBranch(ctx, q, toBranchID); err != nil {
+			return err
+		}
+
+		for _, copyID := range copyIDs {
+			copy, err := q.GetBookCopyForUpdate(ctx, copyID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("copy %d: %w", copyID, ErrNotFound)
+			}
+			if err != nil {
+				return err
+			}
+			if copy.BranchID == toBranchID {
+				return fmt.Errorf("copy %d is already at branch %d: %w", copyID, toBranchID, ErrInvalidInput)
+			}
+			if copy.Status != CopyAvailable {
+				return fmt.Errorf("copy %d is %s: %w", copyID, copy.Status, ErrConflict)
+			}
+
+			err = q.SetCopyStatus(ctx, db.SetCopyStatusParams{ID: copyID, Status: CopyInTransit})
+			if err != nil {
+				return err
+			}
+
+			transfer, err := q.AddCopyTransfer(ctx, db.AddCopyTransferParams{
+				CopyID:       copyID,
+				FromBranchID: copy.BranchID,
+				ToBranchID:   toBranchID,
+				RequestedBy:  requestedBy,
+			})
+			if err != nil {
+				return err
+			}
+			transfers = append(transfers, transfer)
+		}
+		return nil
+	})
+	return transfers, err
+}
+
+// ReceiveTransfer shelves a copy in transit at the branch it was sent to.
+func (p *PostgresClient) ReceiveTransfer(ctx context.Context, transferID int32) (db.CopyTransfer, error) {
+	return p.completeTransfer(ctx, transferID, TransferReceived)
+}
+
+// CancelTransfer puts a copy in transit back on the shelf of the branch it
+// was sent from.
+func (p *PostgresClient) CancelTransfer(ctx context.Context, transferID int32) (db.CopyTransfer, error) {
+	return p.completeTransfer(ctx, transferID, TransferCancelled)
+}
+
+func (p *PostgresClient) completeTransfer(ctx context.Context, transferID int32, status string) (db.CopyTransfer, error) {
+	var completed db.CopyTransfer
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		transfer, err := q.GetCopyTransferForUpdate(ctx, transferID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if transfer.Status != TransferInTransit {
+			return fmt.Errorf("transfer is %s: %w", transfer.Status, ErrConflict)
+		}
+
+		branchID := transfer.FromBranchID
+		if status == TransferReceived {
+			branchID = transfer.ToBranchID
+		}
+		err = q.ShelveCopy(ctx, db.ShelveCopyParams{
+			ID:       transfer.CopyID,
+			BranchID: pgtype.Int4{Int32: branchID, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		completed, err = q.CompleteCopyTransfer(ctx, db.CompleteCopyTransferParams{ID: transferID, Status: status})
+		if err != nil {
+			return err
+		}
+
+		copy, err := q.GetBookCopyForUpdate(ctx, transfer.CopyID)
+		if err != nil {
+			return err
+		}
+		return allocateHeldCopies(ctx, q, copy.BookID)
+	})
+	return completed, err
+}
+
+// ListTransfers returns one page of the transfers, optionally only those
+// with a status or from or to a branch, and the cursor of the next page.
+func (p *PostgresClient) ListTransfers(ctx context.Context, status string, branchID int32, pageCursor string, limit int32) ([]db.CopyTransfer, string, error) {
+	params := db.ListCopyTransfersParams{}
+	switch status {
+	case "":
+	case TransferInTransit, TransferReceived, TransferCancelled:
+		params.Status = pgtype.Text{String: status, Valid: true}
+	default:
+		return nil, "", fmt.Errorf("transfer status %q: %w", status, ErrInvalidInput)
+	}
+	if branchID != 0 {
+		params.BranchID = pgtype.Int4{Int32: branchID, Valid: true}
+	}
+	if pageCursor != "" {
+		c, err := decodeCursor(pageCursor)
+		if err != nil {
+			return nil, "", err
+		}
+		params.AfterID = c.ID
+	}
+
+	limit = pageSize(limit)
+	params.PageSize = limit + 1
+
+	transfers, err := p.queries.ListCopyTransfers(ctx, params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if int32(len(transfers)) > limit {
+		transfers = transfers[:limit]
+		next = encodeCursor(cursor{ID: transfers[len(transfers)-1].ID})
+	}
+	return transfers, next, nil
+}
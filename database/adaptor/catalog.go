@@ -0,0 +1,120 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Sort orders supported by ListBooks. A leading "-" means descending.
+const (
+	SortByID        = "id"
+	SortByIDDesc    = "-id"
+	SortByTitle     = "title"
+	SortByTitleDesc = "-title"
+)
+
+var ErrInvalidSort = errors.New("invalid sort order")
+
+// ListBooksOptions are the filters, sort order and page position of a catalog listing.
+// SubjectID also matches the books of every descendant subject. BranchID
+// limits the copy counts and AvailableOnly to the copies of one branch.
+type ListBooksOptions struct {
+	AuthorID      int32
+	AvailableOnly bool
+	BranchID      int32
+	TitlePrefix   string
+	SubjectID     int32
+	Sort          string
+	Cursor        string
+	Limit         int32
+}
+
+// ListBooks returns one page of the catalog and the cursor of the next page.
+// The returned cursor is empty when there are no more books.
+func (p *PostgresClient) ListBooks(ctx context.Context, opts ListBooksOptions) ([]db.ListBooksRow, string, error) {
+	params := db.ListBooksParams{
+		AvailableOnly: opts.AvailableOnly,
+		SortOrder:     opts.Sort,
+	}
+	switch opts.Sort {
+	case "":
+		params.SortOrder = SortByID
+	case SortByID, SortByIDDesc, SortByTitle, SortByTitleDesc:
+	default:
+		return nil, "", ErrInvalidSort
+	}
+
+	if opts.AuthorID > 0 {
+		params.AuthorID = pgtype.Int4{Int32: opts.AuthorID, Valid: true}
+	}
+	if opts.BranchID > 0 {
+		params.BranchID = pgtype.Int4{Int32: opts.BranchID, Valid: true}
+	}
+	if opts.SubjectID > 0 {
+		params.SubjectID = pgtype.Int4{Int32: opts.SubjectID, Valid: true}
+	}
+	if opts.TitlePrefix != "" {
+		params.TitlePrefix = pgtype.Text{String: escapeLike(opts.TitlePrefix), Valid: true}
+	}
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		params.CursorID = pgtype.Int4{Int32: c.ID, Valid: true}
+		params.CursorTitle = pgtype.Text{String: c.Title, Valid: true}
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	limit := pageSize(opts.Limit)
+	params.PageSize = limit + 1
+
+	books, err := p.queries.ListBooks(ctx, params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if int32(len(books)) > limit {
+		books = books[:limit]
+		last := books[len(books)-1]
+		next = encodeCursor(cursor{ID: last.ID, Title: last.Title})
+	}
+	return books, next, nil
+}
+
+// escapeLike escapes the LIKE wildcards so user input is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// SearchBooks runs a ranked full-text search over titles, descriptions and
+// author names. The query accepts web search syntax ("quoted phrases", -not, or).
+// The returned offset is zero when there are no more results.
+func (p *PostgresClient) SearchBooks(ctx context.Context, query string, limit int32, offset int32) ([]db.SearchBooksRow, int32, error) {
+	if offset < 0 {
+		offset = 0
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	limit = pageSize(limit)
+	results, err := p.queries.SearchBooks(ctx, db.SearchBooksParams{
+		Query:      query,
+		PageSize:   limit + 1,
+		PageOffset: offset,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var next int32
+	if int32(len(results)) > limit {
+		results = results[:limit]
+		next = offset + limit
+	}
+	return results, next, nil
+}
@@ -0,0 +1,188 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Copy statuses
+const (
+	CopyAvailable = "available"
+	CopyOnLoan    = "on_loan"
+	CopyOnHold    = "on_hold"
+	CopyInTransit = "in_transit"
+	CopyLost      = "lost"
+	CopyDamaged   = "damaged"
+	CopyRetired   = "retired"
+)
+
+// Copy conditions
+const (
+	ConditionNew  = "new"
+	ConditionGood = "good"
+	ConditionFair = "fair"
+	ConditionPoor = "poor"
+)
+
+// CopyDetail is a copy together with its outstanding loan, if any.
+type CopyDetail struct {
+	db.BookCopy
+	Loan *db.BorrowedBook
+}
+
+func validCondition(condition string) bool {
+	switch condition {
+	case ConditionNew, ConditionGood, ConditionFair, ConditionPoor:
+		return true
+	}
+	return false
+}
+
+// AddBookCopy adds a physical copy of a book. A copy without a barcode gets a
+// generated one, a copy without an acquired date is acquired today and a
+// copy without a branch is shelved at the main branch. The copy is set aside
+// for the next hold on the book, if any. Archived books take no copies and
+// are not found.
+func (p *PostgresClient) AddBookCopy(ctx context.Context, copy db.AddBookCopyParams) (db.BookCopy, error) {
+	if copy.Condition == "" {
+		copy.Condition = ConditionGood
+	}
+	if !validCondition(copy.Condition) {
+		return db.BookCopy{}, fmt.Errorf("condition %q: %w", copy.Condition, ErrInvalidInput)
+	}
+
+	if copy.BranchID.Valid {
+		if err := checkBranch(ctx, p.queries, copy.BranchID.Int32); err != nil {
+			return db.BookCopy{}, err
+		}
+	}
+
+	var added db.BookCopy
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		// Locked so that the book is not archived while the copy is added
+		book, err := lockBook(ctx, q, copy.BookID)
+		if err == nil && book.ArchivedAt.Valid {
+			err = ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("book %d: %w", copy.BookID, err)
+		}
+
+		added, err = q.AddBookCopy(ctx, copy)
+		if isUniqueViolation(err) {
+			return fmt.Errorf("barcode %q already exists: %w", copy.Barcode.String, ErrConflict)
+		}
+		if err != nil {
+			return err
+		}
+		return allocateHeldCopies(ctx, q, copy.BookID)
+	})
+	return added, err
+}
+
+func (p *PostgresClient) ListBookCopies(ctx context.Context, bookID int32) ([]db.BookCopy, error) {
+	if _, err := p.queries.GetBook(ctx, bookID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return p.queries.ListBookCopies(ctx, bookID)
+}
+
+// GetBookCopy returns a copy and, when it is on loan, the loan.
+func (p *PostgresClient) GetBookCopy(ctx context.Context, copyID int32) (CopyDetail, error) {
+	copy, err := p.queries.GetBookCopy(ctx, copyID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return CopyDetail{}, ErrNotFound
+	}
+	if err != nil {
+		return CopyDetail{}, err
+	}
+
+	detail := CopyDetail{BookCopy: copy}
+	loan, err := p.queries.GetCopyActiveLoan(ctx, pgtype.Int4{Int32: copyID, Valid: true})
+	if err == nil {
+		detail.Loan = &loan
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return CopyDetail{}, err
+	}
+	return detail, nil
+}
+
+// UpdateBookCopy changes the condition and shelf location of a copy, and
+// optionally marks it available, lost or damaged. An empty status or
+// condition keeps the current one. Copies on loan, on hold, in transit or
+// retired cannot change status here: they change through returns, holds,
+// transfers and retirement. A copy made available again may be set aside
+// for the next hold on the book.
+func (p *PostgresClient) UpdateBookCopy(ctx context.Context, copy db.UpdateBookCopyParams) error {
+	return p.execTx(ctx, func(q *db.Queries) error {
+		current, err := q.GetBookCopyForUpdate(ctx, copy.ID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if copy.Condition == "" {
+			copy.Condition = current.Condition
+		}
+		if !validCondition(copy.Condition) {
+			return fmt.Errorf("condition %q: %w", copy.Condition, ErrInvalidInput)
+		}
+
+		if copy.Status == "" {
+			copy.Status = current.Status
+		}
+		if copy.Status != current.Status {
+			switch {
+			case current.Status == CopyOnLoan || current.Status == CopyOnHold ||
+				current.Status == CopyInTransit || current.Status == CopyRetired:
+				return fmt.Errorf("copy is %s: %w", current.Status, ErrConflict)
+			case copy.Status != CopyAvailable && copy.Status != CopyLost && copy.Status != CopyDamaged:
+				return fmt.Errorf("status %q: %w", copy.Status, ErrInvalidInput)
+			}
+		}
+
+		if err := q.UpdateBookCopy(ctx, copy); err != nil {
+			return err
+		}
+		if copy.Status == CopyAvailable && current.Status != CopyAvailable {
+			return allocateHeldCopies(ctx, q, current.BookID)
+		}
+		return nil
+	})
+}
+
+// RetireBookCopy takes a copy out of circulation for good. The row is kept so
+// the loans of the copy keep pointing at it.
+func (p *PostgresClient) RetireBookCopy(ctx context.Context, copyID int32) error {
+	return p.execTx(ctx, func(q *db.Queries) error {
+		current, err := q.GetBookCopyForUpdate(ctx, copyID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		switch current.Status {
+		case CopyRetired:
+			return nil
+		case CopyOnLoan:
+			return fmt.Errorf("copy is on loan: %w", ErrConflict)
+		case CopyOnHold:
+			return fmt.Errorf("copy is on hold: %w", ErrConflict)
+		case CopyInTransit:
+			return fmt.Errorf("copy is in transit: %w", ErrConflict)
+		}
+		return q.RetireBookCopy(ctx, copyID)
+	})
+}
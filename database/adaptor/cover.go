@@ -0,0 +1,25 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// SetBookCover records that a new cover of the book was stored at
+// updatedAt. The images themselves are kept in blob storage.
+func (p *PostgresClient) SetBookCover(ctx context.Context, bookID int32, updatedAt time.Time) error {
+	n, err := p.queries.SetBookCover(ctx, db.SetBookCoverParams{
+		ID:             bookID,
+		CoverUpdatedAt: pgtype.Timestamp{Time: updatedAt, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
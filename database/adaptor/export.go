@@ -0,0 +1,63 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// CatalogBook is a book with the authors of its work, as exported.
+type CatalogBook struct {
+	db.Book
+	Authors []db.Author
+}
+
+// ListBooksForExport returns up to limit books with an ID above afterID,
+// restricted to ids unless it is empty.
+func (p *PostgresClient) ListBooksForExport(ctx context.Context, ids []int32, afterID int32, limit int32) ([]CatalogBook, error) {
+	if ids == nil {
+		ids = []int32{}
+	}
+	books, err := p.queries.ListBooksForExport(ctx, db.ListBooksForExportParams{
+		Ids:      ids,
+		AfterID:  afterID,
+		PageSize: limit,
+	})
+	if err != nil || len(books) == 0 {
+		return nil, err
+	}
+
+	workIDs := make([]int32, len(books))
+	for i, book := range books {
+		workIDs[i] = book.WorkID
+	}
+	authors, err := p.queries.ListAuthorsByWorkIDs(ctx, workIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byWork := make(map[int32][]db.Author, len(books))
+	for _, a := range authors {
+		byWork[a.WorkID] = append(byWork[a.WorkID], db.Author{ID: a.ID, Name: a.Name, Bio: a.Bio})
+	}
+
+	result := make([]CatalogBook, len(books))
+	for i, book := range books {
+		result[i] = CatalogBook{Book: book, Authors: byWork[book.WorkID]}
+	}
+	return result, nil
+}
+
+// ExportBooks returns up to limit catalog rows with an ID above afterID,
+// in ID order.
+func (p *PostgresClient) ExportBooks(ctx context.Context, afterID int32, limit int32) ([]db.ExportBooksRow, error) {
+	return p.queries.ExportBooks(ctx, db.ExportBooksParams{AfterID: afterID, PageSize: limit})
+}
+
+// ExportLoans returns up to limit loans with an ID above afterID, in ID
+// order: all of them, or those borrowed or returned at or after since when
+// it is valid.
+func (p *PostgresClient) ExportLoans(ctx context.Context, since pgtype.Timestamp, afterID int32, limit int32) ([]db.ExportLoansRow, error) {
+	return p.queries.ExportLoans(ctx, db.ExportLoansParams{Since: since, AfterID: afterID, PageSize: limit})
+}
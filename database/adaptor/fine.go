@@ -0,0 +1,230 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Ledger accounts. Every account transaction debits one and credits another.
+const (
+	// AccountPatron is what patrons owe the library
+	AccountPatron = "patron"
+	// AccountFines is the income from fines
+	AccountFines = "fines"
+	// AccountWaived is the fines the library let go
+	AccountWaived = "waived"
+	// AccountCash is the money patrons paid
+	AccountCash = "cash"
+)
+
+// Account transaction kinds
+const (
+	TransactionCharge  = "charge"
+	TransactionWaiver  = "waiver"
+	TransactionPayment = "payment"
+)
+
+// Account is the balance of a patron and one page of their account
+// transactions, newest first.
+type Account struct {
+	UserID       int32                   `json:"user_id"`
+	BalanceCents int32                   `json:"balance_cents"`
+	Transactions []db.AccountTransaction `json:"transactions"`
+	NextCursor   string                  `json:"next_cursor,omitempty"`
+}
+
+// accrueFines charges the overdue loans of one user or, when userID is not
+// valid, of every user. The loans are locked first, so that an accrual
+// running at the same time does not charge them twice.
+func accrueFines(ctx context.Context, q *db.Queries, userID pgtype.Int4) (int64, error) {
+	if err := q.LockOverdueLoans(ctx, userID); err != nil {
+		return 0, err
+	}
+	return q.AccrueFines(ctx, userID)
+}
+
+// AccrueFines charges every overdue loan the fines it came to since it was
+// last charged and returns the number of charges made.
+func (p *PostgresClient) AccrueFines(ctx context.Context) (int64, error) {
+	var charges int64
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		var err error
+		charges, err = accrueFines(ctx, q, pgtype.Int4{})
+		return err
+	})
+	return charges, err
+}
+
+// checkBalance fails with a BorrowError when the user owes more than the
+// fee schedule of their role lets patrons borrow with. The user's fines are
+// accrued first.
+func checkBalance(ctx context.Context, q *db.Queries, userID int32) error {
+	if _, err := accrueFines(ctx, q, pgtype.Int4{Int32: userID, Valid: true}); err != nil {
+		return err
+	}
+
+	schedule, err := q.GetUserFeeSchedule(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !schedule.BlockBalanceCents.Valid) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	balance, err := q.GetAccountBalance(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if balance > schedule.BlockBalanceCents.Int32 {
+		return &BorrowError{
+			Code:    CodeFinesOwed,
+			Message: fmt.Sprintf("%d cents of fines owed, the limit is %d", balance, schedule.BlockBalanceCents.Int32),
+		}
+	}
+	return nil
+}
+
+// GetAccount accrues the fines of a user and returns their balance and one
+// page of their account transactions, with the cursor of the next page.
+func (p *PostgresClient) GetAccount(ctx context.Context, userID int32, pageCursor string, limit int32) (Account, error) {
+	params := db.ListAccountTransactionsParams{UserID: userID}
+	if pageCursor != "" {
+		c, err := decodeCursor(pageCursor)
+		if err != nil {
+			return Account{}, err
+		}
+		params.BeforeID = c.ID
+	}
+	limit = pageSize(limit)
+	params.PageSize = limit + 1
+
+	account := Account{UserID: userID}
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		if _, err := q.GetUser(ctx, userID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("user %d: %w", userID, ErrNotFound)
+			}
+			return err
+		}
+		if _, err := accrueFines(ctx, q, pgtype.Int4{Int32: userID, Valid: true}); err != nil {
+			return err
+		}
+
+		var err error
+		account.BalanceCents, err = q.GetAccountBalance(ctx, userID)
+		if err != nil {
+			return err
+		}
+		account.Transactions, err = q.ListAccountTransactions(ctx, params)
+		return err
+	})
+	if err != nil {
+		return Account{}, err
+	}
+
+	if int32(len(account.Transactions)) > limit {
+		account.Transactions = account.Transactions[:limit]
+		account.NextCursor = encodeCursor(cursor{ID: account.Transactions[limit-1].ID})
+	}
+	if account.Transactions == nil {
+		account.Transactions = []db.AccountTransaction{}
+	}
+	return account, nil
+}
+
+// settle records a waiver or a payment crediting the patron account. It
+// cannot settle more than the patron owes.
+func (p *PostgresClient) settle(ctx context.Context, entry db.AddAccountTransactionParams) (db.AccountTransaction, error) {
+	if entry.AmountCents <= 0 {
+		return db.AccountTransaction{}, fmt.Errorf("amount_cents must be positive: %w", ErrInvalidInput)
+	}
+
+	var added db.AccountTransaction
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		if _, err := q.GetUser(ctx, entry.UserID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("user %d: %w", entry.UserID, ErrNotFound)
+			}
+			return err
+		}
+		// The overdue loans are locked in ID order before the loan of the
+		// entry, as every accrual does, so that the two cannot deadlock
+		if _, err := accrueFines(ctx, q, pgtype.Int4{Int32: entry.UserID, Valid: true}); err != nil {
+			return err
+		}
+		if entry.LoanID.Valid {
+			loan, err := q.GetLoanForUpdate(ctx, entry.LoanID.Int32)
+			if errors.Is(err, pgx.ErrNoRows) || (err == nil && loan.UserID != entry.UserID) {
+				return fmt.Errorf("loan %d of user %d: %w", entry.LoanID.Int32, entry.UserID, ErrNotFound)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		balance, err := q.GetAccountBalance(ctx, entry.UserID)
+		if err != nil {
+			return err
+		}
+		if entry.AmountCents > balance {
+			return fmt.Errorf("%d cents exceed the balance of %d cents: %w", entry.AmountCents, balance, ErrInvalidInput)
+		}
+
+		added, err = q.AddAccountTransaction(ctx, entry)
+		return err
+	})
+	return added, err
+}
+
+// WaiveFine lets a patron off some of what they owe, optionally for one
+// loan. recordedBy is the email of the admin.
+func (p *PostgresClient) WaiveFine(ctx context.Context, recordedBy string, userID int32, loanID int32, amountCents int32, memo string) (db.AccountTransaction, error) {
+	return p.settle(ctx, db.AddAccountTransactionParams{
+		UserID:        userID,
+		LoanID:        pgtype.Int4{Int32: loanID, Valid: loanID != 0},
+		Kind:          TransactionWaiver,
+		DebitAccount:  AccountWaived,
+		CreditAccount: AccountPatron,
+		AmountCents:   amountCents,
+		Memo:          memo,
+		RecordedBy:    recordedBy,
+	})
+}
+
+// RecordPayment records money a patron paid towards what they owe.
+// recordedBy is the email of the admin.
+func (p *PostgresClient) RecordPayment(ctx context.Context, recordedBy string, userID int32, amountCents int32, memo string) (db.AccountTransaction, error) {
+	return p.settle(ctx, db.AddAccountTransactionParams{
+		UserID:        userID,
+		Kind:          TransactionPayment,
+		DebitAccount:  AccountCash,
+		CreditAccount: AccountPatron,
+		AmountCents:   amountCents,
+		Memo:          memo,
+		RecordedBy:    recordedBy,
+	})
+}
+
+func (p *PostgresClient) ListFeeSchedules(ctx context.Context) ([]db.FeeSchedule, error) {
+	return p.queries.ListFeeSchedules(ctx)
+}
+
+// SetFeeSchedule sets the overdue fines of a role. Charges already made
+// stand, later accruals charge each loan up to its fine under the new
+// schedule.
+func (p *PostgresClient) SetFeeSchedule(ctx context.Context, schedule db.UpsertFeeScheduleParams) (db.FeeSchedule, error) {
+	switch {
+	case schedule.Role != RoleAdmin && schedule.Role != RoleUser:
+		return db.FeeSchedule{}, fmt.Errorf("role %q: %w", schedule.Role, ErrInvalidInput)
+	case schedule.DailyFineCents < 0, schedule.GraceDays < 0,
+		schedule.MaxFineCents.Valid && schedule.MaxFineCents.Int32 < 0,
+		schedule.BlockBalanceCents.Valid && schedule.BlockBalanceCents.Int32 < 0:
+		return db.FeeSchedule{}, fmt.Errorf("fees and days must not be negative: %w", ErrInvalidInput)
+	}
+	return p.queries.UpsertFeeSchedule(ctx, schedule)
+}
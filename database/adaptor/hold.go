@@ -0,0 +1,192 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Hold statuses
+const (
+	HoldWaiting   = "waiting"
+	HoldReady     = "ready"
+	HoldFulfilled = "fulfilled"
+	HoldCancelled = "cancelled"
+	HoldExpired   = "expired"
+)
+
+// HoldPickupDays is how long a copy set aside for a hold waits for the
+// patron before it passes to the next hold.
+const HoldPickupDays = 3
+
+// allocateHeldCopies sets the available copies of the book aside for the
+// waiting holds, first placed first.
+func allocateHeldCopies(ctx context.Context, q *db.Queries, bookID int32) error {
+	for {
+		hold, err := q.NextWaitingHold(ctx, bookID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		copy, err := q.PickAvailableCopy(ctx, db.PickAvailableCopyParams{BookID: bookID})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = q.SetCopyStatus(ctx, db.SetCopyStatusParams{ID: copy.ID, Status: CopyOnHold})
+		if err != nil {
+			return err
+		}
+		err = q.ReadyHold(ctx, db.ReadyHoldParams{
+			ID:         hold.ID,
+			CopyID:     pgtype.Int4{Int32: copy.ID, Valid: true},
+			PickupDays: HoldPickupDays,
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// releaseCopy puts a copy that was set aside for a hold back on the shelf,
+// where the next hold in the queue gets it.
+func releaseCopy(ctx context.Context, q *db.Queries, bookID int32, copyID pgtype.Int4) error {
+	if !copyID.Valid {
+		return nil
+	}
+	if err := q.ShelveCopy(ctx, db.ShelveCopyParams{ID: copyID.Int32}); err != nil {
+		return err
+	}
+	return allocateHeldCopies(ctx, q, bookID)
+}
+
+// expireHolds expires the ready holds not picked up in time, of one book or,
+// when bookID is not valid, of every book.
+func expireHolds(ctx context.Context, q *db.Queries, bookID pgtype.Int4) (int, error) {
+	expired, err := q.ExpireHolds(ctx, bookID)
+	if err != nil {
+		return 0, err
+	}
+	for _, hold := range expired {
+		if err := releaseCopy(ctx, q, hold.BookID, hold.CopyID); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+// ExpireHolds expires the ready holds of every book not picked up in time
+// and passes their copies to the next holds.
+func (p *PostgresClient) ExpireHolds(ctx context.Context) (int, error) {
+	var expired int
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		var err error
+		expired, err = expireHolds(ctx, q, pgtype.Int4{})
+		return err
+	})
+	return expired, err
+}
+
+// PlaceHold queues the user for a copy of the book. When a copy is available
+// it is set aside for the user right away.
+func (p *PostgresClient) PlaceHold(ctx context.Context, userID int32, bookID int32) (db.ListHoldsRow, error) {
+	var holdID int32
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		book, err := q.GetBook(ctx, bookID)
+		if errors.Is(err, pgx.ErrNoRows) || book.ArchivedAt.Valid {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = q.GetActiveLoan(ctx, db.GetActiveLoanParams{UserID: userID, BookID: bookID})
+		if err == nil {
+			return fmt.Errorf("book %d is on loan to the user: %w", bookID, ErrConflict)
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		if _, err := expireHolds(ctx, q, pgtype.Int4{Int32: bookID, Valid: true}); err != nil {
+			return err
+		}
+
+		holdID, err = q.AddHold(ctx, db.AddHoldParams{BookID: bookID, UserID: userID})
+		if isUniqueViolation(err) {
+			return fmt.Errorf("book %d is already on hold for the user: %w", bookID, ErrConflict)
+		}
+		if err != nil {
+			return err
+		}
+		return allocateHeldCopies(ctx, q, bookID)
+	})
+	if err != nil {
+		return db.ListHoldsRow{}, err
+	}
+	return p.GetHold(ctx, holdID)
+}
+
+// GetHold returns an open hold with its place in the queue.
+func (p *PostgresClient) GetHold(ctx context.Context, holdID int32) (db.ListHoldsRow, error) {
+	holds, err := p.queries.ListHolds(ctx, db.ListHoldsParams{ID: pgtype.Int4{Int32: holdID, Valid: true}})
+	if err != nil {
+		return db.ListHoldsRow{}, err
+	}
+	if len(holds) == 0 {
+		return db.ListHoldsRow{}, ErrNotFound
+	}
+	return holds[0], nil
+}
+
+// ListUserHolds returns the open holds of a user, oldest first.
+func (p *PostgresClient) ListUserHolds(ctx context.Context, userID int32) ([]db.ListHoldsRow, error) {
+	return p.queries.ListHolds(ctx, db.ListHoldsParams{UserID: pgtype.Int4{Int32: userID, Valid: true}})
+}
+
+// ListBookHolds returns the queue of open holds for a book, first in line
+// first.
+func (p *PostgresClient) ListBookHolds(ctx context.Context, bookID int32) ([]db.ListHoldsRow, error) {
+	if _, err := p.queries.GetBook(ctx, bookID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return p.queries.ListHolds(ctx, db.ListHoldsParams{BookID: pgtype.Int4{Int32: bookID, Valid: true}})
+}
+
+// CancelHold cancels an open hold of the user or, when userID is zero, of
+// anyone. A copy set aside for the hold passes to the next hold.
+func (p *PostgresClient) CancelHold(ctx context.Context, holdID int32, userID int32) error {
+	return p.execTx(ctx, func(q *db.Queries) error {
+		hold, err := q.GetHoldForUpdate(ctx, holdID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if userID != 0 && hold.UserID != userID {
+			return fmt.Errorf("hold %d belongs to another patron: %w", holdID, ErrForbidden)
+		}
+		if hold.Status != HoldWaiting && hold.Status != HoldReady {
+			return fmt.Errorf("hold is %s: %w", hold.Status, ErrConflict)
+		}
+
+		if err := q.CloseHold(ctx, db.CloseHoldParams{ID: holdID, Status: HoldCancelled}); err != nil {
+			return err
+		}
+		return releaseCopy(ctx, q, hold.BookID, hold.CopyID)
+	})
+}
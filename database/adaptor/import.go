@@ -0,0 +1,83 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ImportBook is one validated row of a bulk catalog import.
+type ImportBook struct {
+	Book db.AddBookParams
+	// Copies are only added when the book is new, so a file can be
+	// imported again without doubling the stock.
+	Copies  int32
+	Authors []db.Author
+}
+
+// ImportBooks upserts a batch of books in one transaction. Books are matched
+// on ISBN and authors on their normalized name; edits of existing books are
+// recorded in their history under changedBy. A book matching an archived
+// book fails the batch with ErrConflict, it has to be restored first. It
+// reports, for every book of the batch, whether it was created rather than
+// updated.
+func (p *PostgresClient) ImportBooks(ctx context.Context, changedBy string, books []ImportBook) ([]bool, error) {
+	created := make([]bool, len(books))
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		for i, book := range books {
+			var err error
+			book.Book.Isbn, err = normalizeISBN(book.Book.Isbn)
+			if err != nil {
+				return err
+			}
+
+			if book.Book.Isbn.Valid {
+				id, err := q.GetBookIDByISBN(ctx, book.Book.Isbn)
+				if err == nil {
+					existing, err := q.GetBook(ctx, id)
+					if err != nil {
+						return fmt.Errorf("book %q: %w", book.Book.Title, err)
+					}
+					if existing.ArchivedAt.Valid {
+						return fmt.Errorf("book %q: isbn %s belongs to archived book %d: %w",
+							book.Book.Title, book.Book.Isbn.String, id, ErrConflict)
+					}
+
+					previous, _, err := editBook(ctx, q, changedBy, db.EditBookParams{
+						ID:            id,
+						Title:         book.Book.Title,
+						Description:   book.Book.Description,
+						Isbn:          book.Book.Isbn,
+						Edition:       book.Book.Edition,
+						Publisher:     book.Book.Publisher,
+						PublishedYear: book.Book.PublishedYear,
+						Language:      book.Book.Language,
+					})
+					if err != nil {
+						return fmt.Errorf("book %q: %w", book.Book.Title, err)
+					}
+					if err := addWorkAuthors(ctx, q, previous.WorkID, book.Authors); err != nil {
+						return err
+					}
+					continue
+				}
+				if !errors.Is(err, pgx.ErrNoRows) {
+					return fmt.Errorf("book %q: %w", book.Book.Title, err)
+				}
+			}
+
+			if _, err := createBook(ctx, q, book.Book, book.Copies, book.Authors); err != nil {
+				return fmt.Errorf("book %q: %w", book.Book.Title, err)
+			}
+			created[i] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
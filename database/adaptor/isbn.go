@@ -0,0 +1,45 @@
+package adaptor
+
+import (
+	"app/isbn"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// normalizeISBN validates an optional ISBN and stores it as ISBN-13.
+// An empty ISBN is the same as none.
+func normalizeISBN(value pgtype.Text) (pgtype.Text, error) {
+	if !value.Valid || value.String == "" {
+		return pgtype.Text{}, nil
+	}
+	normalized, err := isbn.Normalize(value.String)
+	if err != nil {
+		return pgtype.Text{}, fmt.Errorf("isbn %q: %w", value.String, ErrInvalidInput)
+	}
+	return pgtype.Text{String: normalized, Valid: true}, nil
+}
+
+// GetBookByISBN looks a book up by its ISBN-10 or ISBN-13.
+func (p *PostgresClient) GetBookByISBN(ctx context.Context, value string) (BookDetail, error) {
+	normalized, err := normalizeISBN(pgtype.Text{String: value, Valid: true})
+	if err != nil {
+		return BookDetail{}, err
+	}
+	if !normalized.Valid {
+		return BookDetail{}, fmt.Errorf("isbn is required: %w", ErrInvalidInput)
+	}
+
+	bookID, err := p.queries.GetBookIDByISBN(ctx, normalized)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return BookDetail{}, ErrNotFound
+	}
+	if err != nil {
+		return BookDetail{}, err
+	}
+
+	return p.GetBookByID(ctx, bookID)
+}
@@ -0,0 +1,274 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// DefaultLoanDays is the loan period of roles without a loan policy.
+const DefaultLoanDays = 14
+
+// DefaultMaxRenewals is how often a loan may be renewed under a loan policy
+// that does not say, and under no policy.
+const DefaultMaxRenewals = 2
+
+// User roles
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Codes of BorrowError
+const (
+	CodeLoanLimit  = "loan_limit_reached"
+	CodeTitleLimit = "title_limit_reached"
+	CodeFinesOwed  = "fines_owed"
+)
+
+// BorrowError is returned when a patron may not borrow a book. Code tells
+// why in a form clients can act on. It wraps ErrForbidden.
+type BorrowError struct {
+	Code    string
+	Message string
+}
+
+func (e *BorrowError) Error() string {
+	return e.Message
+}
+
+func (e *BorrowError) Unwrap() error {
+	return ErrForbidden
+}
+
+// loanTerms returns the loan period of a book for a user and how often the
+// loan may be renewed: the terms of the policy for the user's role and the
+// book, else for the role.
+func loanTerms(ctx context.Context, q *db.Queries, userID int32, bookID int32) (db.GetLoanTermsRow, error) {
+	terms, err := q.GetLoanTerms(ctx, db.GetLoanTermsParams{
+		UserID: userID,
+		BookID: pgtype.Int4{Int32: bookID, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.GetLoanTermsRow{LoanDays: DefaultLoanDays, MaxRenewals: DefaultMaxRenewals}, nil
+	}
+	return terms, err
+}
+
+// checkBorrowingLimits fails with a BorrowError when one more loan of the
+// book would take the user over the borrowing limits of their role. The
+// caller holds the lock on the user, so that concurrent borrows are counted.
+func checkBorrowingLimits(ctx context.Context, q *db.Queries, userID int32, bookID int32) error {
+	limit, err := q.GetUserBorrowingLimit(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	active, err := q.CountActiveLoans(ctx, db.CountActiveLoansParams{UserID: userID, BookID: bookID})
+	if err != nil {
+		return err
+	}
+	if active.Loans >= limit.MaxLoans {
+		return &BorrowError{
+			Code:    CodeLoanLimit,
+			Message: fmt.Sprintf("%d books on loan, the limit is %d", active.Loans, limit.MaxLoans),
+		}
+	}
+	if active.TitleLoans >= limit.MaxCopiesPerTitle {
+		return &BorrowError{
+			Code:    CodeTitleLimit,
+			Message: fmt.Sprintf("%d copies of book %d on loan, the limit is %d", active.TitleLoans, bookID, limit.MaxCopiesPerTitle),
+		}
+	}
+	return nil
+}
+
+func (p *PostgresClient) ListBorrowingLimits(ctx context.Context) ([]db.BorrowingLimit, error) {
+	return p.queries.ListBorrowingLimits(ctx)
+}
+
+// SetBorrowingLimit sets how much patrons of a role may have on loan at a
+// time. Loans already made are kept.
+func (p *PostgresClient) SetBorrowingLimit(ctx context.Context, limit db.UpsertBorrowingLimitParams) (db.BorrowingLimit, error) {
+	if limit.Role != RoleAdmin && limit.Role != RoleUser {
+		return db.BorrowingLimit{}, fmt.Errorf("role %q: %w", limit.Role, ErrInvalidInput)
+	}
+	if limit.MaxLoans <= 0 || limit.MaxCopiesPerTitle <= 0 {
+		return db.BorrowingLimit{}, fmt.Errorf("limits must be positive: %w", ErrInvalidInput)
+	}
+	return p.queries.UpsertBorrowingLimit(ctx, limit)
+}
+
+func (p *PostgresClient) ListLoanPolicies(ctx context.Context) ([]db.LoanPolicy, error) {
+	return p.queries.ListLoanPolicies(ctx)
+}
+
+// SetLoanPolicy sets the loan period of a role or, with a valid BookID, of
+// one book for a role.
+func (p *PostgresClient) SetLoanPolicy(ctx context.Context, policy db.UpsertLoanPolicyParams) (db.LoanPolicy, error) {
+	if policy.Role != RoleAdmin && policy.Role != RoleUser {
+		return db.LoanPolicy{}, fmt.Errorf("role %q: %w", policy.Role, ErrInvalidInput)
+	}
+	if policy.LoanDays <= 0 {
+		return db.LoanPolicy{}, fmt.Errorf("loan_days must be positive: %w", ErrInvalidInput)
+	}
+	if policy.MaxRenewals < 0 {
+		return db.LoanPolicy{}, fmt.Errorf("max_renewals must not be negative: %w", ErrInvalidInput)
+	}
+
+	set, err := p.queries.UpsertLoanPolicy(ctx, policy)
+	if isForeignKeyViolation(err) {
+		return db.LoanPolicy{}, fmt.Errorf("book %d: %w", policy.BookID.Int32, ErrNotFound)
+	}
+	return set, err
+}
+
+// DeleteLoanPolicy removes a loan policy. Loans already made keep their due
+// date.
+func (p *PostgresClient) DeleteLoanPolicy(ctx context.Context, id int32) error {
+	n, err := p.queries.DeleteLoanPolicy(ctx, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListOverdueLoans returns one page of the outstanding loans past their due
+// date, most overdue first, optionally only those made at a branch.
+func (p *PostgresClient) ListOverdueLoans(ctx context.Context, branchID int32, limit int32, offset int32) ([]db.ListOverdueLoansRow, error) {
+	return p.queries.ListOverdueLoans(ctx, db.ListOverdueLoansParams{
+		BranchID:   pgtype.Int4{Int32: branchID, Valid: branchID != 0},
+		PageSize:   pageSize(limit),
+		PageOffset: offset,
+	})
+}
+
+// RenewOptions tell who renews a loan.
+type RenewOptions struct {
+	// UserID is the borrower the loan must belong to, zero for any
+	UserID int32
+	// Override allows renewing an overdue loan
+	Override bool
+}
+
+// RenewLoan extends an outstanding loan to one loan period from now and
+// counts the renewal. A loan cannot be renewed more often than its policy
+// allows, while another patron waits for the book, or, unless overridden,
+// once it is overdue.
+func (p *PostgresClient) RenewLoan(ctx context.Context, loanID int32, opts RenewOptions) (db.BorrowedBook, error) {
+	var renewed db.BorrowedBook
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		loan, err := q.GetLoanForUpdate(ctx, loanID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("loan %d: %w", loanID, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		if opts.UserID != 0 && loan.UserID != opts.UserID {
+			return fmt.Errorf("loan %d belongs to another patron: %w", loanID, ErrForbidden)
+		}
+		if loan.ReturnedAt.Valid {
+			return fmt.Errorf("loan %d was returned: %w", loanID, ErrConflict)
+		}
+		if loan.Overdue && !opts.Override {
+			return fmt.Errorf("loan %d is overdue: %w", loanID, ErrConflict)
+		}
+
+		terms, err := loanTerms(ctx, q, loan.UserID, loan.BookID)
+		if err != nil {
+			return err
+		}
+		if loan.Renewals >= terms.MaxRenewals {
+			return fmt.Errorf("loan %d was renewed %d times already: %w", loanID, loan.Renewals, ErrConflict)
+		}
+
+		waiting, err := q.HasWaitingHolds(ctx, loan.BookID)
+		if err != nil {
+			return err
+		}
+		if waiting {
+			return fmt.Errorf("other patrons are waiting for book %d: %w", loan.BookID, ErrConflict)
+		}
+
+		renewed, err = q.RenewLoan(ctx, db.RenewLoanParams{ID: loanID, LoanDays: terms.LoanDays})
+		return err
+	})
+	return renewed, err
+}
+
+// Loan statuses of ListLoansOptions
+const (
+	LoanActive   = "active"
+	LoanReturned = "returned"
+	LoanOverdue  = "overdue"
+)
+
+// ListLoansOptions filter the loan history. Zero values do not filter.
+type ListLoansOptions struct {
+	UserID int32
+	BookID int32
+	// Status is LoanActive, LoanReturned or LoanOverdue
+	Status string
+	// BorrowedFrom and BorrowedBefore bound when the loans were made
+	BorrowedFrom   time.Time
+	BorrowedBefore time.Time
+	Cursor         string
+	Limit          int32
+}
+
+// ListLoans returns one page of the loan history, newest first, and the
+// cursor of the next page. The returned cursor is empty when there are no
+// more loans.
+func (p *PostgresClient) ListLoans(ctx context.Context, opts ListLoansOptions) ([]db.ListLoansRow, string, error) {
+	params := db.ListLoansParams{
+		UserID: pgtype.Int4{Int32: opts.UserID, Valid: opts.UserID != 0},
+		BookID: pgtype.Int4{Int32: opts.BookID, Valid: opts.BookID != 0},
+	}
+	switch opts.Status {
+	case "":
+	case LoanActive, LoanReturned, LoanOverdue:
+		params.Status = pgtype.Text{String: opts.Status, Valid: true}
+	default:
+		return nil, "", fmt.Errorf("loan status %q: %w", opts.Status, ErrInvalidInput)
+	}
+	if !opts.BorrowedFrom.IsZero() {
+		params.BorrowedFrom = pgtype.Timestamp{Time: opts.BorrowedFrom, Valid: true}
+	}
+	if !opts.BorrowedBefore.IsZero() {
+		params.BorrowedBefore = pgtype.Timestamp{Time: opts.BorrowedBefore, Valid: true}
+	}
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		params.BeforeID = c.ID
+	}
+
+	limit := pageSize(opts.Limit)
+	params.PageSize = limit + 1
+
+	loans, err := p.queries.ListLoans(ctx, params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if int32(len(loans)) > limit {
+		loans = loans[:limit]
+		next = encodeCursor(cursor{ID: loans[limit-1].ID})
+	}
+	return loans, next, nil
+}
@@ -0,0 +1,51 @@
+package adaptor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	// DefaultPageSize is used when the caller does not ask for a page size.
+	DefaultPageSize = 20
+	// MaxPageSize caps the number of rows returned in a single page.
+	MaxPageSize = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the position of the last row of a page. It is handed to clients
+// as an opaque base64 string so the sort keys can change without breaking them.
+type cursor struct {
+	ID    int32  `json:"id"`
+	Title string `json:"title,omitempty"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// pageSize clamps a requested page size into [1, MaxPageSize].
+func pageSize(limit int32) int32 {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return limit
+}
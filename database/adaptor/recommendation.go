@@ -0,0 +1,96 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// RecommendationOptions tune how recommendations are computed.
+type RecommendationOptions struct {
+	// MinCoBorrowers is the number of patrons who must have borrowed both
+	// books before one is recommended for the other
+	MinCoBorrowers int32
+	// PerBook is the number of recommendations kept for each book
+	PerBook int32
+}
+
+// Recommendation is a book recommended from loan history. Score is higher
+// for books more often borrowed by the same patrons.
+type Recommendation struct {
+	ID          int32   `json:"id"`
+	Title       string  `json:"title"`
+	Score       float64 `json:"score"`
+	CoBorrowers int32   `json:"co_borrowers"`
+}
+
+// RefreshRecommendations recomputes the recommendations of every book from
+// the loan history and returns how many were stored. Readers see either the
+// previous or the new recommendations, never a mix.
+func (p *PostgresClient) RefreshRecommendations(ctx context.Context, opts RecommendationOptions) (int64, error) {
+	if opts.MinCoBorrowers < 1 || opts.PerBook < 1 {
+		return 0, ErrInvalidInput
+	}
+
+	var stored int64
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		if err := q.ClearRecommendations(ctx); err != nil {
+			return err
+		}
+		var err error
+		stored, err = q.ComputeRecommendations(ctx, db.ComputeRecommendationsParams{
+			MinCoBorrowers: opts.MinCoBorrowers,
+			PerBook:        opts.PerBook,
+		})
+		return err
+	})
+	return stored, err
+}
+
+// BookRecommendations returns the books most often borrowed together with a
+// book. When userID is not zero, books the user has on loan are left out.
+func (p *PostgresClient) BookRecommendations(ctx context.Context, bookID int32, userID int32, limit int32) ([]Recommendation, error) {
+	book, err := p.queries.GetBook(ctx, bookID)
+	if errors.Is(err, pgx.ErrNoRows) || book.ArchivedAt.Valid {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.queries.ListBookRecommendations(ctx, db.ListBookRecommendationsParams{
+		BookID:   bookID,
+		UserID:   pgtype.Int4{Int32: userID, Valid: userID != 0},
+		PageSize: pageSize(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recommendations := make([]Recommendation, len(rows))
+	for i, row := range rows {
+		recommendations[i] = Recommendation(row)
+	}
+	return recommendations, nil
+}
+
+// UserRecommendations returns books recommended from everything the user
+// has borrowed, leaving out the books they borrowed before or have on loan.
+func (p *PostgresClient) UserRecommendations(ctx context.Context, userID int32, limit int32) ([]Recommendation, error) {
+	rows, err := p.queries.ListUserRecommendations(ctx, db.ListUserRecommendationsParams{
+		UserID:   userID,
+		PageSize: pageSize(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recommendations := make([]Recommendation, len(rows))
+	for i, row := range rows {
+		recommendations[i] = Recommendation(row)
+	}
+	return recommendations, nil
+}
@@ -0,0 +1,133 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ReviewBook adds or replaces the review of a book by a user. Only users
+// who have borrowed the book, now or in the past, may review it.
+func (p *PostgresClient) ReviewBook(ctx context.Context, userID int32, bookID int32, rating int32, body string) (db.Review, error) {
+	if rating < 1 || rating > 5 {
+		return db.Review{}, fmt.Errorf("rating must be between 1 and 5, got %d: %w", rating, ErrInvalidInput)
+	}
+
+	var review db.Review
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		book, err := q.GetBook(ctx, bookID)
+		if errors.Is(err, pgx.ErrNoRows) || book.ArchivedAt.Valid {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		borrowed, err := q.HasBorrowedBook(ctx, db.HasBorrowedBookParams{UserID: userID, BookID: bookID})
+		if err != nil {
+			return err
+		}
+		if !borrowed {
+			return fmt.Errorf("only patrons who borrowed the book can review it: %w", ErrForbidden)
+		}
+
+		review, err = q.UpsertReview(ctx, db.UpsertReviewParams{UserID: userID, BookID: bookID, Rating: rating, Body: body})
+		return err
+	})
+	return review, err
+}
+
+// DeleteReview removes the review of a book by a user.
+func (p *PostgresClient) DeleteReview(ctx context.Context, userID int32, bookID int32) error {
+	n, err := p.queries.DeleteReview(ctx, db.DeleteReviewParams{UserID: userID, BookID: bookID})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListBookReviews returns one page of the visible reviews of a book, newest
+// first, and the cursor of the next page.
+func (p *PostgresClient) ListBookReviews(ctx context.Context, bookID int32, pageCursor string, limit int32) ([]db.ListBookReviewsRow, string, error) {
+	params := db.ListBookReviewsParams{BookID: bookID}
+	if pageCursor != "" {
+		c, err := decodeCursor(pageCursor)
+		if err != nil {
+			return nil, "", err
+		}
+		params.BeforeID = pgtype.Int4{Int32: c.ID, Valid: true}
+	}
+
+	limit = pageSize(limit)
+	params.PageSize = limit + 1
+
+	reviews, err := p.queries.ListBookReviews(ctx, params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if int32(len(reviews)) > limit {
+		reviews = reviews[:limit]
+		next = encodeCursor(cursor{ID: reviews[len(reviews)-1].ID})
+	}
+	return reviews, next, nil
+}
+
+// ListReviews returns one page of all reviews for moderation, newest first,
+// optionally only the hidden or only the visible ones.
+func (p *PostgresClient) ListReviews(ctx context.Context, hidden pgtype.Bool, pageCursor string, limit int32) ([]db.Review, string, error) {
+	params := db.ListReviewsParams{Hidden: hidden}
+	if pageCursor != "" {
+		c, err := decodeCursor(pageCursor)
+		if err != nil {
+			return nil, "", err
+		}
+		params.BeforeID = pgtype.Int4{Int32: c.ID, Valid: true}
+	}
+
+	limit = pageSize(limit)
+	params.PageSize = limit + 1
+
+	reviews, err := p.queries.ListReviews(ctx, params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if int32(len(reviews)) > limit {
+		reviews = reviews[:limit]
+		next = encodeCursor(cursor{ID: reviews[len(reviews)-1].ID})
+	}
+	return reviews, next, nil
+}
+
+// HideReview takes a review out of the listings and the book's rating.
+func (p *PostgresClient) HideReview(ctx context.Context, id int32, reason string) error {
+	n, err := p.queries.HideReview(ctx, db.HideReviewParams{ID: id, HiddenReason: reason})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresClient) UnhideReview(ctx context.Context, id int32) error {
+	n, err := p.queries.UnhideReview(ctx, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
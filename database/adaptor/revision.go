@@ -0,0 +1,231 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// BookRevision is one recorded edit of a book.
+type BookRevision struct {
+	Revision  int32                  `json:"revision"`
+	ChangedBy string                 `json:"changed_by"`
+	ChangedAt pgtype.Timestamp       `json:"changed_at"`
+	Changes   map[string]FieldChange `json:"changes"`
+}
+
+// FieldChange is the value of a field before and after an edit.
+type FieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// bookFields are the details of a book that are versioned, under the names
+// used in the revision diffs.
+type bookFields struct {
+	Title         string  `json:"title"`
+	Description   string  `json:"description"`
+	Isbn          *string `json:"isbn"`
+	Edition       string  `json:"edition"`
+	Publisher     string  `json:"publisher"`
+	PublishedYear *int32  `json:"published_year"`
+	Language      string  `json:"language"`
+}
+
+func fieldsOfBook(book db.GetBookRow) bookFields {
+	f := bookFields{
+		Title:       book.Title,
+		Description: book.Description,
+		Edition:     book.Edition,
+		Publisher:   book.Publisher,
+		Language:    book.Language,
+	}
+	if book.Isbn.Valid {
+		f.Isbn = &book.Isbn.String
+	}
+	if book.PublishedYear.Valid {
+		f.PublishedYear = &book.PublishedYear.Int32
+	}
+	return f
+}
+
+func (f bookFields) editParams(id int32) db.EditBookParams {
+	book := db.EditBookParams{
+		ID:          id,
+		Title:       f.Title,
+		Description: f.Description,
+		Edition:     f.Edition,
+		Publisher:   f.Publisher,
+		Language:    f.Language,
+	}
+	if f.Isbn != nil {
+		book.Isbn = pgtype.Text{String: *f.Isbn, Valid: true}
+	}
+	if f.PublishedYear != nil {
+		book.PublishedYear = pgtype.Int4{Int32: *f.PublishedYear, Valid: true}
+	}
+	return book
+}
+
+// fieldValues returns the JSON value of every versioned field.
+func (f bookFields) fieldValues() map[string]json.RawMessage {
+	b, _ := json.Marshal(f)
+	var values map[string]json.RawMessage
+	json.Unmarshal(b, &values)
+	return values
+}
+
+// diffFields lists the fields whose value differs between old and new.
+func diffFields(old, new bookFields) map[string]FieldChange {
+	oldValues, newValues := old.fieldValues(), new.fieldValues()
+	changes := map[string]FieldChange{}
+	for name, value := range newValues {
+		if !bytes.Equal(oldValues[name], value) {
+			changes[name] = FieldChange{Old: oldValues[name], New: value}
+		}
+	}
+	return changes
+}
+
+// lockBook locks a book for the rest of the transaction and returns it as
+// it is now, not as it was when the transaction started.
+func lockBook(ctx context.Context, q *db.Queries, bookID int32) (db.GetBookRow, error) {
+	if _, err := q.LockBook(ctx, bookID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.GetBookRow{}, ErrNotFound
+		}
+		return db.GetBookRow{}, err
+	}
+	return q.GetBook(ctx, bookID)
+}
+
+// editBook updates the details of a book inside a transaction and records
+// the edit as a new revision, unless nothing changed. A non-zero
+// book.Version must be the current version. It returns the book as it was
+// before the edit and its new version. The ISBN must already be normalized.
+func editBook(ctx context.Context, q *db.Queries, changedBy string, book db.EditBookParams) (db.GetBookRow, int32, error) {
+	current, err := lockBook(ctx, q, book.ID)
+	if err != nil {
+		return db.GetBookRow{}, 0, err
+	}
+
+	version, err := q.EditBook(ctx, book)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.GetBookRow{}, 0, ErrVersionMismatch
+	}
+	if isUniqueViolation(err) {
+		return db.GetBookRow{}, 0, fmt.Errorf("isbn %s is already in the catalog: %w", book.Isbn.String, ErrConflict)
+	}
+	if err != nil {
+		return db.GetBookRow{}, 0, err
+	}
+
+	edited := current
+	edited.Title, edited.Description, edited.Isbn = book.Title, book.Description, book.Isbn
+	edited.Edition, edited.Publisher = book.Edition, book.Publisher
+	edited.PublishedYear, edited.Language = book.PublishedYear, book.Language
+
+	changes := diffFields(fieldsOfBook(current), fieldsOfBook(edited))
+	if len(changes) == 0 {
+		return current, version, nil
+	}
+	diff, err := json.Marshal(changes)
+	if err != nil {
+		return db.GetBookRow{}, 0, err
+	}
+	_, err = q.AddBookRevision(ctx, db.AddBookRevisionParams{BookID: book.ID, ChangedBy: changedBy, Changes: diff})
+	return current, version, err
+}
+
+// BookHistory returns the revisions of a book, newest first.
+func (p *PostgresClient) BookHistory(ctx context.Context, bookID int32) ([]BookRevision, error) {
+	if _, err := p.queries.GetBook(ctx, bookID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := p.queries.ListBookRevisions(ctx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	return toBookRevisions(rows)
+}
+
+func toBookRevisions(rows []db.BookRevision) ([]BookRevision, error) {
+	revisions := make([]BookRevision, len(rows))
+	for i, row := range rows {
+		revisions[i] = BookRevision{Revision: row.Revision, ChangedBy: row.ChangedBy, ChangedAt: row.ChangedAt}
+		if err := json.Unmarshal(row.Changes, &revisions[i].Changes); err != nil {
+			return nil, fmt.Errorf("revision %d of book %d: %w", row.Revision, row.BookID, err)
+		}
+	}
+	return revisions, nil
+}
+
+// RevertBook sets the details of a book back to what they were right after
+// the given revision, or to what they were when the book was added for
+// revision 0. The revert is recorded as a revision of its own. A non-zero
+// version must be the current version. It returns the new version.
+func (p *PostgresClient) RevertBook(ctx context.Context, changedBy string, bookID int32, revision int32, version int32) (int32, error) {
+	var reverted int32
+	err := p.execTx(ctx, func(q *db.Queries) error {
+		current, err := lockBook(ctx, q, bookID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := q.ListBookRevisions(ctx, bookID)
+		if err != nil {
+			return err
+		}
+		if revision < 0 || (revision > 0 && !hasRevision(rows, revision)) {
+			return fmt.Errorf("revision %d of book %d: %w", revision, bookID, ErrNotFound)
+		}
+		revisions, err := toBookRevisions(rows)
+		if err != nil {
+			return err
+		}
+
+		// Undo the later revisions, newest first
+		values := fieldsOfBook(current).fieldValues()
+		for _, r := range revisions {
+			if r.Revision <= revision {
+				break
+			}
+			for name, change := range r.Changes {
+				values[name] = change.Old
+			}
+		}
+		b, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		var fields bookFields
+		if err := json.Unmarshal(b, &fields); err != nil {
+			return err
+		}
+
+		book := fields.editParams(bookID)
+		book.Version = version
+		_, reverted, err = editBook(ctx, q, changedBy, book)
+		return err
+	})
+	return reverted, err
+}
+
+func hasRevision(rows []db.BookRevision, revision int32) bool {
+	for _, row := range rows {
+		if row.Revision == revision {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// SubjectNode is a subject with its child subjects.
+type SubjectNode struct {
+	db.Subject
+	Children []*SubjectNode
+}
+
+// parentID maps the top level, parent 0, to NULL.
+func parentID(id int32) pgtype.Int4 {
+	return pgtype.Int4{Int32: id, Valid: id > 0}
+}
+
+// CreateSubject adds a subject under parent, or at the top level when parent
+// is 0. Sibling subjects cannot share a name.
+func (p *PostgresClient) CreateSubject(ctx context.Context, name string, parent int32) (db.Subject, error) {
+	subject, err := p.queries.CreateSubject(ctx, db.CreateSubjectParams{Name: name, ParentID: parentID(parent)})
+	if isUniqueViolation(err) {
+		return db.Subject{}, fmt.Errorf("subject %q already exists here: %w", name, ErrConflict)
+	}
+	if isForeignKeyViolation(err) {
+		return db.Subject{}, fmt.Errorf("parent subject %d: %w", parent, ErrNotFound)
+	}
+	return subject, err
+}
+
+func (p *PostgresClient) GetSubject(ctx context.Context, id int32) (db.Subject, error) {
+	subject, err := p.queries.GetSubject(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.Subject{}, ErrNotFound
+	}
+	return subject, err
+}
+
+// SubjectTree returns the top level subjects with all of their descendants.
+func (p *PostgresClient) SubjectTree(ctx context.Context) ([]*SubjectNode, error) {
+	subjects, err := p.queries.ListSubjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int32]*SubjectNode, len(subjects))
+	for _, s := range subjects {
+		nodes[s.ID] = &SubjectNode{Subject: s, Children: []*SubjectNode{}}
+	}
+
+	roots := []*SubjectNode{}
+	// Subjects are ordered by ID, so children keep that order too
+	for _, s := range subjects {
+		node := nodes[s.ID]
+		if parent, ok := nodes[s.ParentID.Int32]; s.ParentID.Valid && ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	return roots, nil
+}
+
+// UpdateSubject renames a subject and moves it, with its descendants, under
+// another parent. A subject cannot be moved under one of its descendants.
+func (p *PostgresClient) UpdateSubject(ctx context.Context, id int32, name string, parent int32) error {
+	return p.execTx(ctx, func(q *db.Queries) error {
+		if parent > 0 {
+			inSubtree, err := q.IsSubjectInSubtree(ctx, db.IsSubjectInSubtreeParams{RootID: id, SubjectID: parent})
+			if err != nil {
+				return err
+			}
+			if inSubtree {
+				return fmt.Errorf("subject %d cannot be moved under its own descendant %d: %w", id, parent, ErrConflict)
+			}
+		}
+
+		n, err := q.UpdateSubject(ctx, db.UpdateSubjectParams{ID: id, Name: name, ParentID: parentID(parent)})
+		if isUniqueViolation(err) {
+			return fmt.Errorf("subject %q already exists here: %w", name, ErrConflict)
+		}
+		if isForeignKeyViolation(err) {
+			return fmt.Errorf("parent subject %d: %w", parent, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteSubject removes a subject that has neither child subjects nor works.
+func (p *PostgresClient) DeleteSubject(ctx context.Context, id int32) error {
+	return p.execTx(ctx, func(q *db.Queries) error {
+		children, err := q.CountSubjectChildren(ctx, parentID(id))
+		if err != nil {
+			return err
+		}
+		if children > 0 {
+			return fmt.Errorf("subject still has %d child subjects: %w", children, ErrConflict)
+		}
+
+		works, err := q.CountWorksBySubject(ctx, id)
+		if err != nil {
+			return err
+		}
+		if works > 0 {
+			return fmt.Errorf("subject still has %d works: %w", works, ErrConflict)
+		}
+
+		n, err := q.DeleteSubject(ctx, id)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// AddBookSubjects files the work of a book, with all of its editions, under
+// more subjects.
+func (p *PostgresClient) AddBookSubjects(ctx context.Context, bookID int32, subjectIDs []int32) error {
+	return p.execTx(ctx, func(q *db.Queries) error {
+		workID, err := bookWorkID(ctx, q, bookID)
+		if err != nil {
+			return err
+		}
+
+		for _, subjectID := range subjectIDs {
+			err := q.AddWorkSubject(ctx, db.AddWorkSubjectParams{WorkID: workID, SubjectID: subjectID})
+			if isForeignKeyViolation(err) {
+				return fmt.Errorf("subject %d: %w", subjectID, ErrNotFound)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveBookSubject takes the work of a book out of a subject.
+func (p *PostgresClient) RemoveBookSubject(ctx context.Context, bookID int32, subjectID int32) error {
+	return p.execTx(ctx, func(q *db.Queries) error {
+		workID, err := bookWorkID(ctx, q, bookID)
+		if err != nil {
+			return err
+		}
+
+		n, err := q.RemoveWorkSubject(ctx, db.RemoveWorkSubjectParams{WorkID: workID, SubjectID: subjectID})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
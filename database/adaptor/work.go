@@ -0,0 +1,149 @@
+package adaptor
+
+import (
+	"app/database/db"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// WorkDetail is a work with its authors, its subjects and every edition of
+// it in the catalog.
+type WorkDetail struct {
+	db.Work
+	Authors  []db.Author
+	Subjects []db.Subject
+	Editions []db.ListEditionsByWorkIDsRow
+}
+
+func (p *PostgresClient) GetWork(ctx context.Context, id int32) (WorkDetail, error) {
+	work, err := p.queries.GetWork(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return WorkDetail{}, ErrNotFound
+	}
+	if err != nil {
+		return WorkDetail{}, err
+	}
+
+	authors, err := p.queries.ListAuthorsByWorkID(ctx, id)
+	if err != nil {
+		return WorkDetail{}, err
+	}
+	subjects, err := p.queries.ListSubjectsByWorkID(ctx, id)
+	if err != nil {
+		return WorkDetail{}, err
+	}
+	editions, err := p.queries.ListEditionsByWorkIDs(ctx, []int32{id})
+	if err != nil {
+		return WorkDetail{}, err
+	}
+
+	return WorkDetail{Work: work, Authors: authors, Subjects: subjects, Editions: editions}, nil
+}
+
+// ListWorks returns one page of works ordered by ID, with their authors and
+// editions, optionally limited to titles starting with titlePrefix, and the
+// cursor of the next page. Subjects are left out.
+func (p *PostgresClient) ListWorks(ctx context.Context, titlePrefix string, pageCursor string, limit int32) ([]WorkDetail, string, error) {
+	params := db.ListWorksParams{}
+	if titlePrefix != "" {
+		params.TitlePrefix = pgtype.Text{String: escapeLike(titlePrefix), Valid: true}
+	}
+	if pageCursor != "" {
+		c, err := decodeCursor(pageCursor)
+		if err != nil {
+			return nil, "", err
+		}
+		params.AfterID = c.ID
+	}
+
+	limit = pageSize(limit)
+	params.PageSize = limit + 1
+
+	works, err := p.queries.ListWorks(ctx, params)
+	if err != nil || len(works) == 0 {
+		return nil, "", err
+	}
+
+	var next string
+	if int32(len(works)) > limit {
+		works = works[:limit]
+		next = encodeCursor(cursor{ID: works[len(works)-1].ID})
+	}
+
+	ids := make([]int32, len(works))
+	for i, work := range works {
+		ids[i] = work.ID
+	}
+	authors, err := p.queries.ListAuthorsByWorkIDs(ctx, ids)
+	if err != nil {
+		return nil, "", err
+	}
+	editions, err := p.queries.ListEditionsByWorkIDs(ctx, ids)
+	if err != nil {
+		return nil, "", err
+	}
+
+	byWork := make(map[int32]*WorkDetail, len(works))
+	result := make([]WorkDetail, len(works))
+	for i, work := range works {
+		result[i] = WorkDetail{Work: work}
+		byWork[work.ID] = &result[i]
+	}
+	for _, a := range authors {
+		w := byWork[a.WorkID]
+		w.Authors = append(w.Authors, db.Author{ID: a.ID, Name: a.Name, Bio: a.Bio})
+	}
+	for _, e := range editions {
+		w := byWork[e.WorkID]
+		w.Editions = append(w.Editions, e)
+	}
+	return result, next, nil
+}
+
+func (p *PostgresClient) UpdateWork(ctx context.Context, work db.Work) error {
+	n, err := p.queries.UpdateWork(ctx, db.UpdateWorkParams{ID: work.ID, Title: work.Title, Description: work.Description})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AttachEditions makes books editions of a work, e.g. when two printings
+// were catalogued as separate works. The authors and subjects of the works
+// they leave are added to the work, and works left without editions are
+// deleted.
+func (p *PostgresClient) AttachEditions(ctx context.Context, workID int32, bookIDs []int32) error {
+	return p.execTx(ctx, func(q *db.Queries) error {
+		if _, err := q.GetWork(ctx, workID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		previous, err := q.MoveEditionsToWork(ctx, db.MoveEditionsToWorkParams{BookIds: bookIDs, WorkID: workID})
+		if err != nil {
+			return err
+		}
+		if len(previous) != len(bookIDs) {
+			return fmt.Errorf("%d of %d books do not exist: %w", len(bookIDs)-len(previous), len(bookIDs), ErrInvalidInput)
+		}
+
+		err = q.CopyWorkAuthors(ctx, db.CopyWorkAuthorsParams{WorkID: workID, SourceIds: previous})
+		if err != nil {
+			return err
+		}
+		err = q.CopyWorkSubjects(ctx, db.CopyWorkSubjectsParams{WorkID: workID, SourceIds: previous})
+		if err != nil {
+			return err
+		}
+		return q.DeleteEmptyWorks(ctx, previous)
+	})
+}
@@ -11,6 +11,84 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const accrueFines = `-- name: AccrueFines :execrows
+WITH fines AS (
+    SELECT bb.id AS loan_id, bb.user_id,
+           LEAST(f.max_fine_cents, f.daily_fine_cents * GREATEST(
+               (COALESCE(bb.returned_at, CURRENT_TIMESTAMP)::date - bb.due_at::date) - f.grace_days, 0)) AS fine
+    FROM borrowed_books bb
+    JOIN users u ON u.id = bb.user_id
+    JOIN fee_schedules f ON f.role = u.role
+    WHERE bb.due_at < COALESCE(bb.returned_at, CURRENT_TIMESTAMP)
+      AND ($1::int IS NULL OR bb.user_id = $1::int)
+), charged AS (
+    SELECT t.loan_id, SUM(t.amount_cents) AS amount
+    FROM account_transactions t
+    WHERE t.kind = 'charge' AND t.loan_id IN (SELECT loan_id FROM fines)
+    GROUP BY t.loan_id
+)
+INSERT INTO account_transactions (user_id, loan_id, kind, debit_account, credit_account, amount_cents, memo)
+SELECT fines.user_id, fines.loan_id, 'charge', 'patron', 'fines', fines.fine - COALESCE(charged.amount, 0), 'Overdue fine'
+FROM fines
+LEFT JOIN charged ON charged.loan_id = fines.loan_id
+WHERE fines.fine > COALESCE(charged.amount, 0)
+`
+
+// Charges each loan kept past its due date what its fine comes to by now,
+// less what it was charged before, so that running it daily charges one
+// day at a time. The fine of a returned loan stops growing.
+func (q *Queries) AccrueFines(ctx context.Context, userID pgtype.Int4) (int64, error) {
+	result, err := q.db.Exec(ctx, accrueFines, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const addAccountTransaction = `-- name: AddAccountTransaction :one
+INSERT INTO account_transactions (user_id, loan_id, kind, debit_account, credit_account, amount_cents, memo, recorded_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, user_id, loan_id, kind, debit_account, credit_account, amount_cents, memo, recorded_by, created_at
+`
+
+type AddAccountTransactionParams struct {
+	UserID        int32
+	LoanID        pgtype.Int4
+	Kind          string
+	DebitAccount  string
+	CreditAccount string
+	AmountCents   int32
+	Memo          string
+	RecordedBy    string
+}
+
+func (q *Queries) AddAccountTransaction(ctx context.Context, arg AddAccountTransactionParams) (AccountTransaction, error) {
+	row := q.db.QueryRow(ctx, addAccountTransaction,
+		arg.UserID,
+		arg.LoanID,
+		arg.Kind,
+		arg.DebitAccount,
+		arg.CreditAccount,
+		arg.AmountCents,
+		arg.Memo,
+		arg.RecordedBy,
+	)
+	var i AccountTransaction
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.LoanID,
+		&i.Kind,
+		&i.DebitAccount,
+		&i.CreditAccount,
+		&i.AmountCents,
+		&i.Memo,
+		&i.RecordedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const addAuthor = `-- name: AddAuthor :one
 INSERT INTO authors (name, bio) 
 VALUES ($1, $2)
@@ -30,51 +108,511 @@ func (q *Queries) AddAuthor(ctx context.Context, arg AddAuthorParams) (int32, er
 }
 
 const addBook = `-- name: AddBook :one
-INSERT INTO books (title, description, num_copy) 
-VALUES ($1, $2, $3)
+INSERT INTO books (title, description, isbn, work_id, edition, publisher, published_year, language) 
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 RETURNING id
 `
 
 type AddBookParams struct {
+	Title         string
+	Description   string
+	Isbn          pgtype.Text
+	WorkID        int32
+	Edition       string
+	Publisher     string
+	PublishedYear pgtype.Int4
+	Language      string
+}
+
+// Usecase: add a new book, an edition of a work
+func (q *Queries) AddBook(ctx context.Context, arg AddBookParams) (int32, error) {
+	row := q.db.QueryRow(ctx, addBook,
+		arg.Title,
+		arg.Description,
+		arg.Isbn,
+		arg.WorkID,
+		arg.Edition,
+		arg.Publisher,
+		arg.PublishedYear,
+		arg.Language,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const addBookCopies = `-- name: AddBookCopies :exec
+INSERT INTO book_copies (book_id)
+SELECT $1::int
+FROM generate_series(1, $2::int)
+`
+
+type AddBookCopiesParams struct {
+	BookID int32
+	Copies int32
+}
+
+func (q *Queries) AddBookCopies(ctx context.Context, arg AddBookCopiesParams) error {
+	_, err := q.db.Exec(ctx, addBookCopies, arg.BookID, arg.Copies)
+	return err
+}
+
+const addBookCopy = `-- name: AddBookCopy :one
+INSERT INTO book_copies (book_id, barcode, condition, shelf_location, acquired_at, branch_id)
+VALUES (
+    $1::int,
+    COALESCE($2::text, next_copy_barcode()),
+    $3::text,
+    $4::text,
+    COALESCE($5::date, CURRENT_DATE),
+    COALESCE($6::int, default_branch_id())
+)
+RETURNING id, book_id, barcode, status, condition, shelf_location, acquired_at, retired_at, branch_id
+`
+
+type AddBookCopyParams struct {
+	BookID        int32
+	Barcode       pgtype.Text
+	Condition     string
+	ShelfLocation string
+	AcquiredAt    pgtype.Date
+	BranchID      pgtype.Int4
+}
+
+// Usecase: manage physical copies
+// A copy added without a barcode gets a generated one
+func (q *Queries) AddBookCopy(ctx context.Context, arg AddBookCopyParams) (BookCopy, error) {
+	row := q.db.QueryRow(ctx, addBookCopy,
+		arg.BookID,
+		arg.Barcode,
+		arg.Condition,
+		arg.ShelfLocation,
+		arg.AcquiredAt,
+		arg.BranchID,
+	)
+	var i BookCopy
+	err := row.Scan(
+		&i.ID,
+		&i.BookID,
+		&i.Barcode,
+		&i.Status,
+		&i.Condition,
+		&i.ShelfLocation,
+		&i.AcquiredAt,
+		&i.RetiredAt,
+		&i.BranchID,
+	)
+	return i, err
+}
+
+const addBookRevision = `-- name: AddBookRevision :one
+INSERT INTO book_revisions (book_id, revision, changed_by, changes)
+SELECT $1::int, COALESCE(MAX(revision), 0) + 1, $2::text, $3::jsonb
+FROM book_revisions
+WHERE book_id = $1::int
+RETURNING id, book_id, revision, changed_by, changed_at, changes
+`
+
+type AddBookRevisionParams struct {
+	BookID    int32
+	ChangedBy string
+	Changes   []byte
+}
+
+// Usecase: edit history, written in the same transaction as EditBook
+func (q *Queries) AddBookRevision(ctx context.Context, arg AddBookRevisionParams) (BookRevision, error) {
+	row := q.db.QueryRow(ctx, addBookRevision, arg.BookID, arg.ChangedBy, arg.Changes)
+	var i BookRevision
+	err := row.Scan(
+		&i.ID,
+		&i.BookID,
+		&i.Revision,
+		&i.ChangedBy,
+		&i.ChangedAt,
+		&i.Changes,
+	)
+	return i, err
+}
+
+const addBranch = `-- name: AddBranch :one
+INSERT INTO branches (code, name, address)
+VALUES ($1, $2, $3)
+RETURNING id, code, name, address
+`
+
+type AddBranchParams struct {
+	Code    string
+	Name    string
+	Address string
+}
+
+// Usecase: branches
+func (q *Queries) AddBranch(ctx context.Context, arg AddBranchParams) (Branch, error) {
+	row := q.db.QueryRow(ctx, addBranch, arg.Code, arg.Name, arg.Address)
+	var i Branch
+	err := row.Scan(
+		&i.ID,
+		&i.Code,
+		&i.Name,
+		&i.Address,
+	)
+	return i, err
+}
+
+const addCopyTransfer = `-- name: AddCopyTransfer :one
+INSERT INTO copy_transfers (copy_id, from_branch_id, to_branch_id, requested_by)
+VALUES ($1, $2, $3, $4)
+RETURNING id, copy_id, from_branch_id, to_branch_id, status, requested_by, shipped_at, completed_at
+`
+
+type AddCopyTransferParams struct {
+	CopyID       int32
+	FromBranchID int32
+	ToBranchID   int32
+	RequestedBy  string
+}
+
+// Usecase: move copies between branches
+func (q *Queries) AddCopyTransfer(ctx context.Context, arg AddCopyTransferParams) (CopyTransfer, error) {
+	row := q.db.QueryRow(ctx, addCopyTransfer,
+		arg.CopyID,
+		arg.FromBranchID,
+		arg.ToBranchID,
+		arg.RequestedBy,
+	)
+	var i CopyTransfer
+	err := row.Scan(
+		&i.ID,
+		&i.CopyID,
+		&i.FromBranchID,
+		&i.ToBranchID,
+		&i.Status,
+		&i.RequestedBy,
+		&i.ShippedAt,
+		&i.CompletedAt,
+	)
+	return i, err
+}
+
+const addHold = `-- name: AddHold :one
+INSERT INTO holds (book_id, user_id)
+VALUES ($1, $2)
+RETURNING id
+`
+
+type AddHoldParams struct {
+	BookID int32
+	UserID int32
+}
+
+// Usecase: holds queue patrons for books
+func (q *Queries) AddHold(ctx context.Context, arg AddHoldParams) (int32, error) {
+	row := q.db.QueryRow(ctx, addHold, arg.BookID, arg.UserID)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const addWork = `-- name: AddWork :one
+INSERT INTO works (title, description)
+VALUES ($1, $2)
+RETURNING id
+`
+
+type AddWorkParams struct {
 	Title       string
 	Description string
-	NumCopy     int32
 }
 
-// Usecase: add a new book
-func (q *Queries) AddBook(ctx context.Context, arg AddBookParams) (int32, error) {
-	row := q.db.QueryRow(ctx, addBook, arg.Title, arg.Description, arg.NumCopy)
+// Usecase: works group the editions of the same book
+func (q *Queries) AddWork(ctx context.Context, arg AddWorkParams) (int32, error) {
+	row := q.db.QueryRow(ctx, addWork, arg.Title, arg.Description)
 	var id int32
 	err := row.Scan(&id)
 	return id, err
 }
 
-const addBookAuthor = `-- name: AddBookAuthor :exec
-INSERT INTO book_authors (book_id, author_id) 
+const addWorkAuthor = `-- name: AddWorkAuthor :exec
+INSERT INTO work_authors (work_id, author_id) 
 VALUES ($1, $2)
+ON CONFLICT (work_id, author_id) DO NOTHING
 `
 
-type AddBookAuthorParams struct {
-	BookID   int32
+type AddWorkAuthorParams struct {
+	WorkID   int32
 	AuthorID int32
 }
 
-func (q *Queries) AddBookAuthor(ctx context.Context, arg AddBookAuthorParams) error {
-	_, err := q.db.Exec(ctx, addBookAuthor, arg.BookID, arg.AuthorID)
+func (q *Queries) AddWorkAuthor(ctx context.Context, arg AddWorkAuthorParams) error {
+	_, err := q.db.Exec(ctx, addWorkAuthor, arg.WorkID, arg.AuthorID)
+	return err
+}
+
+const addWorkSubject = `-- name: AddWorkSubject :exec
+INSERT INTO work_subjects (work_id, subject_id)
+VALUES ($1, $2)
+ON CONFLICT (work_id, subject_id) DO NOTHING
+`
+
+type AddWorkSubjectParams struct {
+	WorkID    int32
+	SubjectID int32
+}
+
+func (q *Queries) AddWorkSubject(ctx context.Context, arg AddWorkSubjectParams) error {
+	_, err := q.db.Exec(ctx, addWorkSubject, arg.WorkID, arg.SubjectID)
+	return err
+}
+
+const archiveBook = `-- name: ArchiveBook :execrows
+UPDATE books
+SET archived_at = CURRENT_TIMESTAMP, version = version + 1
+WHERE id = $1 AND archived_at IS NULL AND ($2::int = 0 OR version = $2::int)
+`
+
+type ArchiveBookParams struct {
+	ID      int32
+	Version int32
+}
+
+// Usercase: delete a book, it is archived rather than removed
+// A non-zero $2 must be the current version
+func (q *Queries) ArchiveBook(ctx context.Context, arg ArchiveBookParams) (int64, error) {
+	result, err := q.db.Exec(ctx, archiveBook, arg.ID, arg.Version)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const clearRecommendations = `-- name: ClearRecommendations :exec
+DELETE FROM book_recommendations
+`
+
+// Usecase: recommendations, see the recommend job
+func (q *Queries) ClearRecommendations(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, clearRecommendations)
+	return err
+}
+
+const closeHold = `-- name: CloseHold :exec
+UPDATE holds
+SET status = $2, closed_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type CloseHoldParams struct {
+	ID     int32
+	Status string
+}
+
+func (q *Queries) CloseHold(ctx context.Context, arg CloseHoldParams) error {
+	_, err := q.db.Exec(ctx, closeHold, arg.ID, arg.Status)
+	return err
+}
+
+const completeCopyTransfer = `-- name: CompleteCopyTransfer :one
+UPDATE copy_transfers
+SET status = $2, completed_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, copy_id, from_branch_id, to_branch_id, status, requested_by, shipped_at, completed_at
+`
+
+type CompleteCopyTransferParams struct {
+	ID     int32
+	Status string
+}
+
+func (q *Queries) CompleteCopyTransfer(ctx context.Context, arg CompleteCopyTransferParams) (CopyTransfer, error) {
+	row := q.db.QueryRow(ctx, completeCopyTransfer, arg.ID, arg.Status)
+	var i CopyTransfer
+	err := row.Scan(
+		&i.ID,
+		&i.CopyID,
+		&i.FromBranchID,
+		&i.ToBranchID,
+		&i.Status,
+		&i.RequestedBy,
+		&i.ShippedAt,
+		&i.CompletedAt,
+	)
+	return i, err
+}
+
+const computeRecommendations = `-- name: ComputeRecommendations :execrows
+WITH borrowers AS (
+    SELECT DISTINCT user_id, book_id FROM borrowed_books
+), counts AS (
+    SELECT book_id, count(*) AS n FROM borrowers GROUP BY book_id
+), pairs AS (
+    SELECT a.book_id, b.book_id AS recommended_book_id, count(*) AS co_borrowers
+    FROM borrowers a
+    JOIN borrowers b ON b.user_id = a.user_id AND b.book_id <> a.book_id
+    GROUP BY a.book_id, b.book_id
+    HAVING count(*) >= $1::int
+), ranked AS (
+    SELECT p.book_id, p.recommended_book_id, p.co_borrowers,
+           p.co_borrowers / sqrt(ca.n * cb.n) AS score,
+           row_number() OVER (PARTITION BY p.book_id
+                              ORDER BY p.co_borrowers / sqrt(ca.n * cb.n) DESC, p.recommended_book_id) AS rank
+    FROM pairs p
+    JOIN counts ca ON ca.book_id = p.book_id
+    JOIN counts cb ON cb.book_id = p.recommended_book_id
+)
+INSERT INTO book_recommendations (book_id, recommended_book_id, score, co_borrowers)
+SELECT book_id, recommended_book_id, score, co_borrowers
+FROM ranked
+WHERE rank <= $2::int
+`
+
+type ComputeRecommendationsParams struct {
+	MinCoBorrowers int32
+	PerBook        int32
+}
+
+// Scores every pair of books borrowed by the same patrons and keeps the
+// per_book best of each book
+func (q *Queries) ComputeRecommendations(ctx context.Context, arg ComputeRecommendationsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, computeRecommendations, arg.MinCoBorrowers, arg.PerBook)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const copyWorkAuthors = `-- name: CopyWorkAuthors :exec
+INSERT INTO work_authors (work_id, author_id)
+SELECT $1::int, author_id
+FROM work_authors
+WHERE work_id = ANY($2::int[])
+ON CONFLICT (work_id, author_id) DO NOTHING
+`
+
+type CopyWorkAuthorsParams struct {
+	WorkID    int32
+	SourceIds []int32
+}
+
+func (q *Queries) CopyWorkAuthors(ctx context.Context, arg CopyWorkAuthorsParams) error {
+	_, err := q.db.Exec(ctx, copyWorkAuthors, arg.WorkID, arg.SourceIds)
 	return err
 }
 
-const borrowBook = `-- name: BorrowBook :exec
-UPDATE books 
-SET num_copy = num_copy - 1 
-WHERE id = $1 AND num_copy > 0
+const copyWorkSubjects = `-- name: CopyWorkSubjects :exec
+INSERT INTO work_subjects (work_id, subject_id)
+SELECT $1::int, subject_id
+FROM work_subjects
+WHERE work_id = ANY($2::int[])
+ON CONFLICT (work_id, subject_id) DO NOTHING
 `
 
-func (q *Queries) BorrowBook(ctx context.Context, id int32) error {
-	_, err := q.db.Exec(ctx, borrowBook, id)
+type CopyWorkSubjectsParams struct {
+	WorkID    int32
+	SourceIds []int32
+}
+
+func (q *Queries) CopyWorkSubjects(ctx context.Context, arg CopyWorkSubjectsParams) error {
+	_, err := q.db.Exec(ctx, copyWorkSubjects, arg.WorkID, arg.SourceIds)
 	return err
 }
 
+const countActiveLoans = `-- name: CountActiveLoans :one
+SELECT count(*)::int AS loans,
+       count(*) FILTER (WHERE b.work_id = (SELECT work_id FROM books WHERE id = $1::int))::int AS title_loans
+FROM borrowed_books bb
+JOIN books b ON b.id = bb.book_id
+WHERE bb.user_id = $2::int AND bb.returned_at IS NULL
+`
+
+type CountActiveLoansParams struct {
+	BookID int32
+	UserID int32
+}
+
+type CountActiveLoansRow struct {
+	Loans      int32
+	TitleLoans int32
+}
+
+// title_loans counts the loans of every edition of the book's work
+func (q *Queries) CountActiveLoans(ctx context.Context, arg CountActiveLoansParams) (CountActiveLoansRow, error) {
+	row := q.db.QueryRow(ctx, countActiveLoans, arg.BookID, arg.UserID)
+	var i CountActiveLoansRow
+	err := row.Scan(&i.Loans, &i.TitleLoans)
+	return i, err
+}
+
+const countActiveLoansByBook = `-- name: CountActiveLoansByBook :one
+SELECT count(*)
+FROM borrowed_books
+WHERE book_id = $1 AND returned_at IS NULL
+`
+
+func (q *Queries) CountActiveLoansByBook(ctx context.Context, bookID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countActiveLoansByBook, bookID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countSubjectChildren = `-- name: CountSubjectChildren :one
+SELECT count(*)
+FROM subjects
+WHERE parent_id = $1
+`
+
+func (q *Queries) CountSubjectChildren(ctx context.Context, parentID pgtype.Int4) (int64, error) {
+	row := q.db.QueryRow(ctx, countSubjectChildren, parentID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countWorksByAuthor = `-- name: CountWorksByAuthor :one
+SELECT count(*)
+FROM work_authors
+WHERE author_id = $1
+`
+
+func (q *Queries) CountWorksByAuthor(ctx context.Context, authorID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countWorksByAuthor, authorID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countWorksBySubject = `-- name: CountWorksBySubject :one
+SELECT count(*)
+FROM work_subjects
+WHERE subject_id = $1
+`
+
+func (q *Queries) CountWorksBySubject(ctx context.Context, subjectID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countWorksBySubject, subjectID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createSubject = `-- name: CreateSubject :one
+INSERT INTO subjects (name, parent_id)
+VALUES ($1, $2)
+RETURNING id, name, parent_id
+`
+
+type CreateSubjectParams struct {
+	Name     string
+	ParentID pgtype.Int4
+}
+
+// Usecase: subject taxonomy
+func (q *Queries) CreateSubject(ctx context.Context, arg CreateSubjectParams) (Subject, error) {
+	row := q.db.QueryRow(ctx, createSubject, arg.Name, arg.ParentID)
+	var i Subject
+	err := row.Scan(&i.ID, &i.Name, &i.ParentID)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (name, email, role, password_hash, nonce) 
 VALUES ($1, $2, $3, $4, $5)
@@ -114,150 +652,2501 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 	return i, err
 }
 
-const deleteBook = `-- name: DeleteBook :exec
-DELETE FROM books
+const deleteAuthor = `-- name: DeleteAuthor :execrows
+DELETE FROM authors
 WHERE id = $1
 `
 
-// Usercase: delete a book
-func (q *Queries) DeleteBook(ctx context.Context, id int32) error {
-	_, err := q.db.Exec(ctx, deleteBook, id)
-	return err
+func (q *Queries) DeleteAuthor(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteAuthor, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
-const editBook = `-- name: EditBook :exec
-UPDATE books
-SET title = $2, description = $3, num_copy = $4
-WHERE id = $1
+const deleteAuthors = `-- name: DeleteAuthors :execrows
+DELETE FROM authors
+WHERE id = ANY($1::int[])
 `
 
-type EditBookParams struct {
-	ID          int32
-	Title       string
-	Description string
-	NumCopy     int32
+func (q *Queries) DeleteAuthors(ctx context.Context, ids []int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteAuthors, ids)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
-// Usercase: edit book details
-func (q *Queries) EditBook(ctx context.Context, arg EditBookParams) error {
-	_, err := q.db.Exec(ctx, editBook,
-		arg.ID,
-		arg.Title,
-		arg.Description,
-		arg.NumCopy,
-	)
+const deleteBook = `-- name: DeleteBook :execrows
+DELETE FROM books
+WHERE id = $1 AND archived_at IS NOT NULL
+`
+
+// Only archived books are ever deleted
+func (q *Queries) DeleteBook(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteBook, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteBookLoans = `-- name: DeleteBookLoans :exec
+DELETE FROM borrowed_books
+WHERE book_id = $1
+`
+
+func (q *Queries) DeleteBookLoans(ctx context.Context, bookID int32) error {
+	_, err := q.db.Exec(ctx, deleteBookLoans, bookID)
+	return err
+}
+
+const deleteEmptyWorks = `-- name: DeleteEmptyWorks :exec
+DELETE FROM works w
+WHERE w.id = ANY($1::int[])
+  AND NOT EXISTS (SELECT 1 FROM books b WHERE b.work_id = w.id)
+`
+
+// Works without editions left are removed with their authors and subjects
+func (q *Queries) DeleteEmptyWorks(ctx context.Context, ids []int32) error {
+	_, err := q.db.Exec(ctx, deleteEmptyWorks, ids)
 	return err
 }
 
-const getAvailableCopies = `-- name: GetAvailableCopies :one
-SELECT num_copy 
-FROM books 
+const deleteLoanPolicy = `-- name: DeleteLoanPolicy :execrows
+DELETE FROM loan_policies
 WHERE id = $1
 `
 
-// Usercase: borrow a book
-func (q *Queries) GetAvailableCopies(ctx context.Context, id int32) (int32, error) {
-	row := q.db.QueryRow(ctx, getAvailableCopies, id)
-	var num_copy int32
-	err := row.Scan(&num_copy)
-	return num_copy, err
+func (q *Queries) DeleteLoanPolicy(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteLoanPolicy, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
-const getBookWithAuthorsByID = `-- name: GetBookWithAuthorsByID :one
-SELECT b.id, b.title, b.description, b.num_copy, a.name AS author_name 
-FROM books b
-JOIN book_authors ba ON b.id = ba.book_id
-JOIN authors a ON ba.author_id = a.id
-WHERE b.id = $1
+const deleteReview = `-- name: DeleteReview :execrows
+DELETE FROM reviews
+WHERE user_id = $1 AND book_id = $2
 `
 
-type GetBookWithAuthorsByIDRow struct {
-	ID          int32
-	Title       string
-	Description string
-	NumCopy     int32
-	AuthorName  string
+type DeleteReviewParams struct {
+	UserID int32
+	BookID int32
 }
 
-// Usercase: get book with ID with their authors (So user can borrow)
-func (q *Queries) GetBookWithAuthorsByID(ctx context.Context, id int32) (GetBookWithAuthorsByIDRow, error) {
-	row := q.db.QueryRow(ctx, getBookWithAuthorsByID, id)
-	var i GetBookWithAuthorsByIDRow
-	err := row.Scan(
-		&i.ID,
-		&i.Title,
-		&i.Description,
-		&i.NumCopy,
-		&i.AuthorName,
-	)
-	return i, err
+func (q *Queries) DeleteReview(ctx context.Context, arg DeleteReviewParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteReview, arg.UserID, arg.BookID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
-const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, name, role, password_hash, nonce
-FROM users 
-WHERE email = $1
+const deleteSubject = `-- name: DeleteSubject :execrows
+DELETE FROM subjects
+WHERE id = $1
 `
 
-func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
-	row := q.db.QueryRow(ctx, getUserByEmail, email)
-	var i User
-	err := row.Scan(
+func (q *Queries) DeleteSubject(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteSubject, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const editBook = `-- name: EditBook :one
+UPDATE books
+SET title = $2, description = $3, isbn = $4, edition = $5, publisher = $6, published_year = $7, language = $8,
+    version = version + CASE
+        WHEN (title, description, isbn, edition, publisher, published_year, language)
+             IS DISTINCT FROM ($2, $3, $4, $5, $6, $7, $8) THEN 1
+        ELSE 0
+    END
+WHERE id = $1 AND ($9::int = 0 OR version = $9::int)
+RETURNING version
+`
+
+type EditBookParams struct {
+	ID            int32
+	Title         string
+	Description   string
+	Isbn          pgtype.Text
+	Edition       string
+	Publisher     string
+	PublishedYear pgtype.Int4
+	Language      string
+	Version       int32
+}
+
+// Usercase: edit book details
+// The version only moves when a field changes; a non-zero $9 must be the
+// current version, otherwise no row is returned
+func (q *Queries) EditBook(ctx context.Context, arg EditBookParams) (int32, error) {
+	row := q.db.QueryRow(ctx, editBook,
+		arg.ID,
+		arg.Title,
+		arg.Description,
+		arg.Isbn,
+		arg.Edition,
+		arg.Publisher,
+		arg.PublishedYear,
+		arg.Language,
+		arg.Version,
+	)
+	var version int32
+	err := row.Scan(&version)
+	return version, err
+}
+
+const expireHolds = `-- name: ExpireHolds :many
+UPDATE holds
+SET status = 'expired', closed_at = CURRENT_TIMESTAMP
+WHERE status = 'ready' AND expires_at < CURRENT_TIMESTAMP
+  AND ($1::int IS NULL OR book_id = $1::int)
+RETURNING id, book_id, copy_id
+`
+
+type ExpireHoldsRow struct {
+	ID     int32
+	BookID int32
+	CopyID pgtype.Int4
+}
+
+// Usecase: ready holds not picked up in time expire and release their copy
+func (q *Queries) ExpireHolds(ctx context.Context, bookID pgtype.Int4) ([]ExpireHoldsRow, error) {
+	rows, err := q.db.Query(ctx, expireHolds, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExpireHoldsRow
+	for rows.Next() {
+		var i ExpireHoldsRow
+		if err := rows.Scan(&i.ID, &i.BookID, &i.CopyID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const exportBooks = `-- name: ExportBooks :many
+SELECT b.id, b.title, b.description, b.isbn, b.work_id, b.edition, b.publisher, b.published_year, b.language,
+       COALESCE((SELECT string_agg(a.name, '; ' ORDER BY a.id)
+                 FROM work_authors wa
+                 JOIN authors a ON a.id = wa.author_id
+                 WHERE wa.work_id = b.work_id), '')::text AS authors,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status = 'available')::int AS available_copies,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status <> 'retired')::int AS total_copies
+FROM books b
+WHERE b.archived_at IS NULL
+  AND b.id > $1::int
+ORDER BY b.id
+LIMIT $2::int
+`
+
+type ExportBooksParams struct {
+	AfterID  int32
+	PageSize int32
+}
+
+type ExportBooksRow struct {
+	ID              int32
+	Title           string
+	Description     string
+	Isbn            pgtype.Text
+	WorkID          int32
+	Edition         string
+	Publisher       string
+	PublishedYear   pgtype.Int4
+	Language        string
+	Authors         string
+	AvailableCopies int32
+	TotalCopies     int32
+}
+
+// Usecase: nightly catalog dump, read a page at a time
+func (q *Queries) ExportBooks(ctx context.Context, arg ExportBooksParams) ([]ExportBooksRow, error) {
+	rows, err := q.db.Query(ctx, exportBooks, arg.AfterID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExportBooksRow
+	for rows.Next() {
+		var i ExportBooksRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Description,
+			&i.Isbn,
+			&i.WorkID,
+			&i.Edition,
+			&i.Publisher,
+			&i.PublishedYear,
+			&i.Language,
+			&i.Authors,
+			&i.AvailableCopies,
+			&i.TotalCopies,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const exportLoans = `-- name: ExportLoans :many
+SELECT bb.id, bb.user_id, bb.book_id, b.title, bb.copy_id, c.barcode, bb.borrowed_at, bb.returned_at
+FROM borrowed_books bb
+JOIN books b ON b.id = bb.book_id
+LEFT JOIN book_copies c ON c.id = bb.copy_id
+WHERE ($1::timestamp IS NULL
+       OR bb.borrowed_at >= $1::timestamp
+       OR bb.returned_at >= $1::timestamp)
+  AND bb.id > $2::int
+ORDER BY bb.id
+LIMIT $3::int
+`
+
+type ExportLoansParams struct {
+	Since    pgtype.Timestamp
+	AfterID  int32
+	PageSize int32
+}
+
+type ExportLoansRow struct {
+	ID         int32
+	UserID     int32
+	BookID     int32
+	Title      string
+	CopyID     pgtype.Int4
+	Barcode    pgtype.Text
+	BorrowedAt pgtype.Timestamp
+	ReturnedAt pgtype.Timestamp
+}
+
+// Usecase: nightly circulation dump, read a page at a time
+// Loans borrowed or returned since the given time, or all of them
+func (q *Queries) ExportLoans(ctx context.Context, arg ExportLoansParams) ([]ExportLoansRow, error) {
+	rows, err := q.db.Query(ctx, exportLoans, arg.Since, arg.AfterID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExportLoansRow
+	for rows.Next() {
+		var i ExportLoansRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.BookID,
+			&i.Title,
+			&i.CopyID,
+			&i.Barcode,
+			&i.BorrowedAt,
+			&i.ReturnedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAccountBalance = `-- name: GetAccountBalance :one
+SELECT COALESCE(SUM(CASE WHEN debit_account = 'patron' THEN amount_cents ELSE -amount_cents END), 0)::int AS balance
+FROM account_transactions
+WHERE user_id = $1 AND 'patron' IN (debit_account, credit_account)
+`
+
+func (q *Queries) GetAccountBalance(ctx context.Context, userID int32) (int32, error) {
+	row := q.db.QueryRow(ctx, getAccountBalance, userID)
+	var balance int32
+	err := row.Scan(&balance)
+	return balance, err
+}
+
+const getActiveLoan = `-- name: GetActiveLoan :one
+SELECT id, copy_id
+FROM borrowed_books
+WHERE user_id = $1 AND book_id = $2 AND returned_at IS NULL
+ORDER BY borrowed_at, id
+LIMIT 1
+FOR UPDATE
+`
+
+type GetActiveLoanParams struct {
+	UserID int32
+	BookID int32
+}
+
+type GetActiveLoanRow struct {
+	ID     int32
+	CopyID pgtype.Int4
+}
+
+// Usercase: return a book
+func (q *Queries) GetActiveLoan(ctx context.Context, arg GetActiveLoanParams) (GetActiveLoanRow, error) {
+	row := q.db.QueryRow(ctx, getActiveLoan, arg.UserID, arg.BookID)
+	var i GetActiveLoanRow
+	err := row.Scan(&i.ID, &i.CopyID)
+	return i, err
+}
+
+const getAuthor = `-- name: GetAuthor :one
+SELECT id, name, bio
+FROM authors
+WHERE id = $1
+`
+
+func (q *Queries) GetAuthor(ctx context.Context, id int32) (Author, error) {
+	row := q.db.QueryRow(ctx, getAuthor, id)
+	var i Author
+	err := row.Scan(&i.ID, &i.Name, &i.Bio)
+	return i, err
+}
+
+const getBook = `-- name: GetBook :one
+SELECT b.id, b.title, b.description, b.isbn, b.work_id, b.edition, b.publisher, b.published_year, b.language, b.archived_at,
+       b.cover_updated_at, b.version,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status = 'available')::int AS available_copies,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status <> 'retired')::int AS total_copies,
+       (SELECT count(*) FROM reviews r WHERE r.book_id = b.id AND r.hidden_at IS NULL)::int AS rating_count,
+       (SELECT COALESCE(avg(r.rating), 0) FROM reviews r WHERE r.book_id = b.id AND r.hidden_at IS NULL)::float8 AS rating_average
+FROM books b
+WHERE b.id = $1
+`
+
+type GetBookRow struct {
+	ID              int32
+	Title           string
+	Description     string
+	Isbn            pgtype.Text
+	WorkID          int32
+	Edition         string
+	Publisher       string
+	PublishedYear   pgtype.Int4
+	Language        string
+	ArchivedAt      pgtype.Timestamp
+	CoverUpdatedAt  pgtype.Timestamp
+	Version         int32
+	AvailableCopies int32
+	TotalCopies     int32
+	RatingCount     int32
+	RatingAverage   float64
+}
+
+// Usercase: get book with ID with their authors (So user can borrow)
+func (q *Queries) GetBook(ctx context.Context, id int32) (GetBookRow, error) {
+	row := q.db.QueryRow(ctx, getBook, id)
+	var i GetBookRow
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Description,
+		&i.Isbn,
+		&i.WorkID,
+		&i.Edition,
+		&i.Publisher,
+		&i.PublishedYear,
+		&i.Language,
+		&i.ArchivedAt,
+		&i.CoverUpdatedAt,
+		&i.Version,
+		&i.AvailableCopies,
+		&i.TotalCopies,
+		&i.RatingCount,
+		&i.RatingAverage,
+	)
+	return i, err
+}
+
+const getBookCopy = `-- name: GetBookCopy :one
+SELECT id, book_id, barcode, status, condition, shelf_location, acquired_at, retired_at, branch_id
+FROM book_copies
+WHERE id = $1
+`
+
+func (q *Queries) GetBookCopy(ctx context.Context, id int32) (BookCopy, error) {
+	row := q.db.QueryRow(ctx, getBookCopy, id)
+	var i BookCopy
+	err := row.Scan(
+		&i.ID,
+		&i.BookID,
+		&i.Barcode,
+		&i.Status,
+		&i.Condition,
+		&i.ShelfLocation,
+		&i.AcquiredAt,
+		&i.RetiredAt,
+		&i.BranchID,
+	)
+	return i, err
+}
+
+const getBookCopyForUpdate = `-- name: GetBookCopyForUpdate :one
+SELECT id, book_id, barcode, status, condition, shelf_location, acquired_at, retired_at, branch_id
+FROM book_copies
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetBookCopyForUpdate(ctx context.Context, id int32) (BookCopy, error) {
+	row := q.db.QueryRow(ctx, getBookCopyForUpdate, id)
+	var i BookCopy
+	err := row.Scan(
+		&i.ID,
+		&i.BookID,
+		&i.Barcode,
+		&i.Status,
+		&i.Condition,
+		&i.ShelfLocation,
+		&i.AcquiredAt,
+		&i.RetiredAt,
+		&i.BranchID,
+	)
+	return i, err
+}
+
+const getBookIDByISBN = `-- name: GetBookIDByISBN :one
+SELECT id
+FROM books
+WHERE isbn = $1
+`
+
+// Usecase: resolve a scanned or catalog ISBN to a book
+func (q *Queries) GetBookIDByISBN(ctx context.Context, isbn pgtype.Text) (int32, error) {
+	row := q.db.QueryRow(ctx, getBookIDByISBN, isbn)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getBranch = `-- name: GetBranch :one
+SELECT id, code, name, address
+FROM branches
+WHERE id = $1
+`
+
+func (q *Queries) GetBranch(ctx context.Context, id int32) (Branch, error) {
+	row := q.db.QueryRow(ctx, getBranch, id)
+	var i Branch
+	err := row.Scan(
+		&i.ID,
+		&i.Code,
+		&i.Name,
+		&i.Address,
+	)
+	return i, err
+}
+
+const getCopyActiveLoan = `-- name: GetCopyActiveLoan :one
+SELECT id, user_id, book_id, borrowed_at, returned_at, copy_id, branch_id, due_at, renewals
+FROM borrowed_books
+WHERE copy_id = $1 AND returned_at IS NULL
+`
+
+func (q *Queries) GetCopyActiveLoan(ctx context.Context, copyID pgtype.Int4) (BorrowedBook, error) {
+	row := q.db.QueryRow(ctx, getCopyActiveLoan, copyID)
+	var i BorrowedBook
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.BookID,
+		&i.BorrowedAt,
+		&i.ReturnedAt,
+		&i.CopyID,
+		&i.BranchID,
+		&i.DueAt,
+		&i.Renewals,
+	)
+	return i, err
+}
+
+const getCopyTransferForUpdate = `-- name: GetCopyTransferForUpdate :one
+SELECT id, copy_id, from_branch_id, to_branch_id, status, requested_by, shipped_at, completed_at
+FROM copy_transfers
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetCopyTransferForUpdate(ctx context.Context, id int32) (CopyTransfer, error) {
+	row := q.db.QueryRow(ctx, getCopyTransferForUpdate, id)
+	var i CopyTransfer
+	err := row.Scan(
+		&i.ID,
+		&i.CopyID,
+		&i.FromBranchID,
+		&i.ToBranchID,
+		&i.Status,
+		&i.RequestedBy,
+		&i.ShippedAt,
+		&i.CompletedAt,
+	)
+	return i, err
+}
+
+const getHoldForUpdate = `-- name: GetHoldForUpdate :one
+SELECT id, book_id, user_id, status, copy_id, placed_at, ready_at, expires_at, closed_at
+FROM holds
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetHoldForUpdate(ctx context.Context, id int32) (Hold, error) {
+	row := q.db.QueryRow(ctx, getHoldForUpdate, id)
+	var i Hold
+	err := row.Scan(
+		&i.ID,
+		&i.BookID,
+		&i.UserID,
+		&i.Status,
+		&i.CopyID,
+		&i.PlacedAt,
+		&i.ReadyAt,
+		&i.ExpiresAt,
+		&i.ClosedAt,
+	)
+	return i, err
+}
+
+const getLoanForUpdate = `-- name: GetLoanForUpdate :one
+SELECT id, user_id, book_id, returned_at, renewals, due_at < CURRENT_TIMESTAMP AS overdue
+FROM borrowed_books
+WHERE id = $1
+FOR UPDATE
+`
+
+type GetLoanForUpdateRow struct {
+	ID         int32
+	UserID     int32
+	BookID     int32
+	ReturnedAt pgtype.Timestamp
+	Renewals   int32
+	Overdue    bool
+}
+
+func (q *Queries) GetLoanForUpdate(ctx context.Context, id int32) (GetLoanForUpdateRow, error) {
+	row := q.db.QueryRow(ctx, getLoanForUpdate, id)
+	var i GetLoanForUpdateRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.BookID,
+		&i.ReturnedAt,
+		&i.Renewals,
+		&i.Overdue,
+	)
+	return i, err
+}
+
+const getLoanTerms = `-- name: GetLoanTerms :one
+SELECT p.loan_days, p.max_renewals
+FROM loan_policies p
+JOIN users u ON u.role = p.role
+WHERE u.id = $1 AND (p.book_id = $2 OR p.book_id IS NULL)
+ORDER BY p.book_id NULLS LAST
+LIMIT 1
+`
+
+type GetLoanTermsParams struct {
+	UserID int32
+	BookID pgtype.Int4
+}
+
+type GetLoanTermsRow struct {
+	LoanDays    int32
+	MaxRenewals int32
+}
+
+// The most specific policy for the borrower's role sets the loan period
+// and how often the loan may be renewed
+func (q *Queries) GetLoanTerms(ctx context.Context, arg GetLoanTermsParams) (GetLoanTermsRow, error) {
+	row := q.db.QueryRow(ctx, getLoanTerms, arg.UserID, arg.BookID)
+	var i GetLoanTermsRow
+	err := row.Scan(&i.LoanDays, &i.MaxRenewals)
+	return i, err
+}
+
+const getOrCreateAuthor = `-- name: GetOrCreateAuthor :one
+INSERT INTO authors (name, bio)
+VALUES ($1, $2)
+ON CONFLICT ((author_name_key(name))) DO UPDATE
+SET bio = CASE WHEN authors.bio = '' THEN EXCLUDED.bio ELSE authors.bio END
+RETURNING id
+`
+
+type GetOrCreateAuthorParams struct {
+	Name string
+	Bio  string
+}
+
+// Usecase: reuse an author whose normalized name already exists
+// An empty bio is filled in, an existing one is kept
+func (q *Queries) GetOrCreateAuthor(ctx context.Context, arg GetOrCreateAuthorParams) (int32, error) {
+	row := q.db.QueryRow(ctx, getOrCreateAuthor, arg.Name, arg.Bio)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getReadyHoldForUpdate = `-- name: GetReadyHoldForUpdate :one
+SELECT h.id, h.copy_id, c.branch_id
+FROM holds h
+JOIN book_copies c ON c.id = h.copy_id
+WHERE h.user_id = $1 AND h.book_id = $2 AND h.status = 'ready'
+FOR UPDATE OF h
+`
+
+type GetReadyHoldForUpdateParams struct {
+	UserID int32
+	BookID int32
+}
+
+type GetReadyHoldForUpdateRow struct {
+	ID       int32
+	CopyID   pgtype.Int4
+	BranchID int32
+}
+
+func (q *Queries) GetReadyHoldForUpdate(ctx context.Context, arg GetReadyHoldForUpdateParams) (GetReadyHoldForUpdateRow, error) {
+	row := q.db.QueryRow(ctx, getReadyHoldForUpdate, arg.UserID, arg.BookID)
+	var i GetReadyHoldForUpdateRow
+	err := row.Scan(&i.ID, &i.CopyID, &i.BranchID)
+	return i, err
+}
+
+const getSubject = `-- name: GetSubject :one
+SELECT id, name, parent_id
+FROM subjects
+WHERE id = $1
+`
+
+func (q *Queries) GetSubject(ctx context.Context, id int32) (Subject, error) {
+	row := q.db.QueryRow(ctx, getSubject, id)
+	var i Subject
+	err := row.Scan(&i.ID, &i.Name, &i.ParentID)
+	return i, err
+}
+
+const getUser = `-- name: GetUser :one
+SELECT id, email, name, role, password_hash, nonce
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUser(ctx context.Context, id int32) (User, error) {
+	row := q.db.QueryRow(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Name,
+		&i.Role,
+		&i.PasswordHash,
+		&i.Nonce,
+	)
+	return i, err
+}
+
+const getUserBorrowingLimit = `-- name: GetUserBorrowingLimit :one
+SELECT l.id, l.role, l.max_loans, l.max_copies_per_title
+FROM borrowing_limits l
+JOIN users u ON u.role = l.role
+WHERE u.id = $1
+`
+
+func (q *Queries) GetUserBorrowingLimit(ctx context.Context, userID int32) (BorrowingLimit, error) {
+	row := q.db.QueryRow(ctx, getUserBorrowingLimit, userID)
+	var i BorrowingLimit
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.MaxLoans,
+		&i.MaxCopiesPerTitle,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT id, email, name, role, password_hash, nonce
+FROM users 
+WHERE email = $1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Name,
+		&i.Role,
+		&i.PasswordHash,
+		&i.Nonce,
+	)
+	return i, err
+}
+
+const getUserFeeSchedule = `-- name: GetUserFeeSchedule :one
+SELECT f.id, f.role, f.daily_fine_cents, f.grace_days, f.max_fine_cents, f.block_balance_cents
+FROM fee_schedules f
+JOIN users u ON u.role = f.role
+WHERE u.id = $1
+`
+
+func (q *Queries) GetUserFeeSchedule(ctx context.Context, userID int32) (FeeSchedule, error) {
+	row := q.db.QueryRow(ctx, getUserFeeSchedule, userID)
+	var i FeeSchedule
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.DailyFineCents,
+		&i.GraceDays,
+		&i.MaxFineCents,
+		&i.BlockBalanceCents,
+	)
+	return i, err
+}
+
+const getWork = `-- name: GetWork :one
+SELECT id, title, description
+FROM works
+WHERE id = $1
+`
+
+func (q *Queries) GetWork(ctx context.Context, id int32) (Work, error) {
+	row := q.db.QueryRow(ctx, getWork, id)
+	var i Work
+	err := row.Scan(&i.ID, &i.Title, &i.Description)
+	return i, err
+}
+
+const hasBorrowedBook = `-- name: HasBorrowedBook :one
+SELECT EXISTS (
+    SELECT 1 FROM borrowed_books
+    WHERE user_id = $1 AND book_id = $2
+)::bool AS borrowed
+`
+
+type HasBorrowedBookParams struct {
+	UserID int32
+	BookID int32
+}
+
+// Usecase: patron reviews
+func (q *Queries) HasBorrowedBook(ctx context.Context, arg HasBorrowedBookParams) (bool, error) {
+	row := q.db.QueryRow(ctx, hasBorrowedBook, arg.UserID, arg.BookID)
+	var borrowed bool
+	err := row.Scan(&borrowed)
+	return borrowed, err
+}
+
+const hasWaitingHolds = `-- name: HasWaitingHolds :one
+SELECT EXISTS (
+    SELECT 1 FROM holds
+    WHERE book_id = $1 AND status = 'waiting'
+)::bool AS waiting
+`
+
+// Usecase: a loan is not renewed while patrons wait for the book
+func (q *Queries) HasWaitingHolds(ctx context.Context, bookID int32) (bool, error) {
+	row := q.db.QueryRow(ctx, hasWaitingHolds, bookID)
+	var waiting bool
+	err := row.Scan(&waiting)
+	return waiting, err
+}
+
+const hideReview = `-- name: HideReview :execrows
+UPDATE reviews
+SET hidden_at = CURRENT_TIMESTAMP, hidden_reason = $2
+WHERE id = $1
+`
+
+type HideReviewParams struct {
+	ID           int32
+	HiddenReason string
+}
+
+func (q *Queries) HideReview(ctx context.Context, arg HideReviewParams) (int64, error) {
+	result, err := q.db.Exec(ctx, hideReview, arg.ID, arg.HiddenReason)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const insertBorrowedBook = `-- name: InsertBorrowedBook :one
+INSERT INTO borrowed_books (user_id, book_id, copy_id, branch_id, due_at) 
+VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + make_interval(days => $5::int))
+RETURNING id, user_id, book_id, borrowed_at, returned_at, copy_id, branch_id, due_at, renewals
+`
+
+type InsertBorrowedBookParams struct {
+	UserID   int32
+	BookID   int32
+	CopyID   pgtype.Int4
+	BranchID pgtype.Int4
+	LoanDays int32
+}
+
+func (q *Queries) InsertBorrowedBook(ctx context.Context, arg InsertBorrowedBookParams) (BorrowedBook, error) {
+	row := q.db.QueryRow(ctx, insertBorrowedBook,
+		arg.UserID,
+		arg.BookID,
+		arg.CopyID,
+		arg.BranchID,
+		arg.LoanDays,
+	)
+	var i BorrowedBook
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.BookID,
+		&i.BorrowedAt,
+		&i.ReturnedAt,
+		&i.CopyID,
+		&i.BranchID,
+		&i.DueAt,
+		&i.Renewals,
+	)
+	return i, err
+}
+
+const isSubjectInSubtree = `-- name: IsSubjectInSubtree :one
+WITH RECURSIVE subtree AS (
+    SELECT s.id FROM subjects s WHERE s.id = $1::int
+    UNION ALL
+    SELECT s.id FROM subjects s JOIN subtree t ON s.parent_id = t.id
+)
+SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2::int)::bool AS in_subtree
+`
+
+type IsSubjectInSubtreeParams struct {
+	RootID    int32
+	SubjectID int32
+}
+
+// Moving a subject under one of its own descendants would make a cycle
+func (q *Queries) IsSubjectInSubtree(ctx context.Context, arg IsSubjectInSubtreeParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isSubjectInSubtree, arg.RootID, arg.SubjectID)
+	var in_subtree bool
+	err := row.Scan(&in_subtree)
+	return in_subtree, err
+}
+
+const listAccountTransactions = `-- name: ListAccountTransactions :many
+SELECT id, user_id, loan_id, kind, debit_account, credit_account, amount_cents, memo, recorded_by, created_at
+FROM account_transactions
+WHERE user_id = $1::int
+  AND ($2::int = 0 OR id < $2::int)
+ORDER BY id DESC
+LIMIT $3::int
+`
+
+type ListAccountTransactionsParams struct {
+	UserID   int32
+	BeforeID int32
+	PageSize int32
+}
+
+// Newest first
+func (q *Queries) ListAccountTransactions(ctx context.Context, arg ListAccountTransactionsParams) ([]AccountTransaction, error) {
+	rows, err := q.db.Query(ctx, listAccountTransactions, arg.UserID, arg.BeforeID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AccountTransaction
+	for rows.Next() {
+		var i AccountTransaction
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.LoanID,
+			&i.Kind,
+			&i.DebitAccount,
+			&i.CreditAccount,
+			&i.AmountCents,
+			&i.Memo,
+			&i.RecordedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listArchivedBookIDs = `-- name: ListArchivedBookIDs :many
+SELECT id
+FROM books
+WHERE archived_at < $1::timestamp
+ORDER BY id
+`
+
+// Usecase: purge books archived before the given time
+func (q *Queries) ListArchivedBookIDs(ctx context.Context, archivedBefore pgtype.Timestamp) ([]int32, error) {
+	rows, err := q.db.Query(ctx, listArchivedBookIDs, archivedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuthors = `-- name: ListAuthors :many
+SELECT id, name, bio
+FROM authors
+WHERE ($1::text IS NULL OR author_name_key(name) LIKE author_name_key($1::text) || '%')
+  AND id > $2::int
+ORDER BY id
+LIMIT $3::int
+`
+
+type ListAuthorsParams struct {
+	NamePrefix pgtype.Text
+	AfterID    int32
+	PageSize   int32
+}
+
+// Usecase: author management
+func (q *Queries) ListAuthors(ctx context.Context, arg ListAuthorsParams) ([]Author, error) {
+	rows, err := q.db.Query(ctx, listAuthors, arg.NamePrefix, arg.AfterID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Author
+	for rows.Next() {
+		var i Author
+		if err := rows.Scan(&i.ID, &i.Name, &i.Bio); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuthorsByWorkID = `-- name: ListAuthorsByWorkID :many
+SELECT a.id, a.name, a.bio
+FROM authors a
+JOIN work_authors wa ON a.id = wa.author_id
+WHERE wa.work_id = $1
+ORDER BY a.id
+`
+
+func (q *Queries) ListAuthorsByWorkID(ctx context.Context, workID int32) ([]Author, error) {
+	rows, err := q.db.Query(ctx, listAuthorsByWorkID, workID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Author
+	for rows.Next() {
+		var i Author
+		if err := rows.Scan(&i.ID, &i.Name, &i.Bio); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuthorsByWorkIDs = `-- name: ListAuthorsByWorkIDs :many
+SELECT wa.work_id, a.id, a.name, a.bio
+FROM work_authors wa
+JOIN authors a ON a.id = wa.author_id
+WHERE wa.work_id = ANY($1::int[])
+ORDER BY wa.work_id, a.id
+`
+
+type ListAuthorsByWorkIDsRow struct {
+	WorkID int32
+	ID     int32
+	Name   string
+	Bio    string
+}
+
+func (q *Queries) ListAuthorsByWorkIDs(ctx context.Context, workIds []int32) ([]ListAuthorsByWorkIDsRow, error) {
+	rows, err := q.db.Query(ctx, listAuthorsByWorkIDs, workIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListAuthorsByWorkIDsRow
+	for rows.Next() {
+		var i ListAuthorsByWorkIDsRow
+		if err := rows.Scan(
+			&i.WorkID,
+			&i.ID,
+			&i.Name,
+			&i.Bio,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBookBranchInventory = `-- name: ListBookBranchInventory :many
+SELECT br.id AS branch_id, br.code, br.name,
+       count(c.id) FILTER (WHERE c.status = 'available')::int AS available_copies,
+       count(c.id) FILTER (WHERE c.status = 'in_transit')::int AS in_transit_copies,
+       count(c.id) FILTER (WHERE c.status <> 'retired')::int AS total_copies
+FROM branches br
+LEFT JOIN book_copies c ON c.branch_id = br.id AND c.book_id = $1
+GROUP BY br.id
+ORDER BY br.id
+`
+
+type ListBookBranchInventoryRow struct {
+	BranchID        int32
+	Code            string
+	Name            string
+	AvailableCopies int32
+	InTransitCopies int32
+	TotalCopies     int32
+}
+
+// Usecase: per-branch inventory of a book, every branch is listed
+func (q *Queries) ListBookBranchInventory(ctx context.Context, bookID int32) ([]ListBookBranchInventoryRow, error) {
+	rows, err := q.db.Query(ctx, listBookBranchInventory, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListBookBranchInventoryRow
+	for rows.Next() {
+		var i ListBookBranchInventoryRow
+		if err := rows.Scan(
+			&i.BranchID,
+			&i.Code,
+			&i.Name,
+			&i.AvailableCopies,
+			&i.InTransitCopies,
+			&i.TotalCopies,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBookCopies = `-- name: ListBookCopies :many
+SELECT id, book_id, barcode, status, condition, shelf_location, acquired_at, retired_at, branch_id
+FROM book_copies
+WHERE book_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListBookCopies(ctx context.Context, bookID int32) ([]BookCopy, error) {
+	rows, err := q.db.Query(ctx, listBookCopies, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BookCopy
+	for rows.Next() {
+		var i BookCopy
+		if err := rows.Scan(
+			&i.ID,
+			&i.BookID,
+			&i.Barcode,
+			&i.Status,
+			&i.Condition,
+			&i.ShelfLocation,
+			&i.AcquiredAt,
+			&i.RetiredAt,
+			&i.BranchID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBookRecommendations = `-- name: ListBookRecommendations :many
+SELECT b.id, b.title, r.score, r.co_borrowers
+FROM book_recommendations r
+JOIN books b ON b.id = r.recommended_book_id
+WHERE r.book_id = $1::int
+  AND b.archived_at IS NULL
+  AND NOT EXISTS (
+        SELECT 1 FROM borrowed_books bb
+        WHERE bb.user_id = $2::int AND bb.book_id = b.id AND bb.returned_at IS NULL)
+ORDER BY r.score DESC, b.id
+LIMIT $3::int
+`
+
+type ListBookRecommendationsParams struct {
+	BookID   int32
+	UserID   pgtype.Int4
+	PageSize int32
+}
+
+type ListBookRecommendationsRow struct {
+	ID          int32
+	Title       string
+	Score       float64
+	CoBorrowers int32
+}
+
+// Books the user, if any, has on loan are left out
+func (q *Queries) ListBookRecommendations(ctx context.Context, arg ListBookRecommendationsParams) ([]ListBookRecommendationsRow, error) {
+	rows, err := q.db.Query(ctx, listBookRecommendations, arg.BookID, arg.UserID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListBookRecommendationsRow
+	for rows.Next() {
+		var i ListBookRecommendationsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Score,
+			&i.CoBorrowers,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBookReviews = `-- name: ListBookReviews :many
+SELECT r.id, r.user_id, COALESCE(u.name, '')::text AS user_name, r.rating, r.body, r.created_at, r.updated_at
+FROM reviews r
+JOIN users u ON u.id = r.user_id
+WHERE r.book_id = $1::int
+  AND r.hidden_at IS NULL
+  AND ($2::int IS NULL OR r.id < $2::int)
+ORDER BY r.id DESC
+LIMIT $3::int
+`
+
+type ListBookReviewsParams struct {
+	BookID   int32
+	BeforeID pgtype.Int4
+	PageSize int32
+}
+
+type ListBookReviewsRow struct {
+	ID        int32
+	UserID    int32
+	UserName  string
+	Rating    int32
+	Body      string
+	CreatedAt pgtype.Timestamp
+	UpdatedAt pgtype.Timestamp
+}
+
+// Newest first; before_id is the ID of the last review of the previous page
+func (q *Queries) ListBookReviews(ctx context.Context, arg ListBookReviewsParams) ([]ListBookReviewsRow, error) {
+	rows, err := q.db.Query(ctx, listBookReviews, arg.BookID, arg.BeforeID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListBookReviewsRow
+	for rows.Next() {
+		var i ListBookReviewsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.UserName,
+			&i.Rating,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBookRevisions = `-- name: ListBookRevisions :many
+SELECT id, book_id, revision, changed_by, changed_at, changes
+FROM book_revisions
+WHERE book_id = $1
+ORDER BY revision DESC
+`
+
+func (q *Queries) ListBookRevisions(ctx context.Context, bookID int32) ([]BookRevision, error) {
+	rows, err := q.db.Query(ctx, listBookRevisions, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BookRevision
+	for rows.Next() {
+		var i BookRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.BookID,
+			&i.Revision,
+			&i.ChangedBy,
+			&i.ChangedAt,
+			&i.Changes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBooks = `-- name: ListBooks :many
+WITH RECURSIVE subtree AS (
+    SELECT s.id FROM subjects s WHERE s.id = $1::int
+    UNION ALL
+    SELECT s.id FROM subjects s JOIN subtree t ON s.parent_id = t.id
+)
+SELECT b.id, b.title, b.description, b.work_id,
+       (SELECT count(*) FROM book_copies c
+        WHERE c.book_id = b.id AND c.status = 'available'
+          AND ($2::int IS NULL OR c.branch_id = $2::int))::int AS available_copies,
+       (SELECT count(*) FROM book_copies c
+        WHERE c.book_id = b.id AND c.status <> 'retired'
+          AND ($2::int IS NULL OR c.branch_id = $2::int))::int AS total_copies,
+       (SELECT count(*) FROM reviews r WHERE r.book_id = b.id AND r.hidden_at IS NULL)::int AS rating_count,
+       (SELECT COALESCE(avg(r.rating), 0) FROM reviews r WHERE r.book_id = b.id AND r.hidden_at IS NULL)::float8 AS rating_average
+FROM books b
+WHERE b.archived_at IS NULL
+  AND ($3::int IS NULL OR EXISTS (
+        SELECT 1 FROM work_authors wa
+        WHERE wa.work_id = b.work_id AND wa.author_id = $3::int))
+  AND (NOT $4::bool OR EXISTS (
+        SELECT 1 FROM book_copies c
+        WHERE c.book_id = b.id AND c.status = 'available'
+          AND ($2::int IS NULL OR c.branch_id = $2::int)))
+  AND ($5::text IS NULL OR lower(b.title) LIKE lower($5::text) || '%')
+  AND ($1::int IS NULL OR b.work_id IN (
+        SELECT ws.work_id FROM work_subjects ws JOIN subtree t ON t.id = ws.subject_id))
+  AND ($6::int IS NULL OR CASE $7::text
+        WHEN '-id' THEN b.id < $6::int
+        WHEN 'title' THEN (b.title, b.id) > ($8::text, $6::int)
+        WHEN '-title' THEN (b.title, b.id) < ($8::text, $6::int)
+        ELSE b.id > $6::int
+      END)
+ORDER BY
+  CASE WHEN $7::text = 'title' THEN b.title END ASC,
+  CASE WHEN $7::text = '-title' THEN b.title END DESC,
+  CASE WHEN $7::text IN ('-id', '-title') THEN b.id END DESC,
+  b.id ASC
+LIMIT $9::int
+`
+
+type ListBooksParams struct {
+	SubjectID     pgtype.Int4
+	BranchID      pgtype.Int4
+	AuthorID      pgtype.Int4
+	AvailableOnly bool
+	TitlePrefix   pgtype.Text
+	CursorID      pgtype.Int4
+	SortOrder     string
+	CursorTitle   pgtype.Text
+	PageSize      int32
+}
+
+type ListBooksRow struct {
+	ID              int32
+	Title           string
+	Description     string
+	WorkID          int32
+	AvailableCopies int32
+	TotalCopies     int32
+	RatingCount     int32
+	RatingAverage   float64
+}
+
+// Usecase: browse the catalog page by page
+// Keyset pagination: cursor_id/cursor_title are taken from the last row of the previous page
+// A branch_id counts, and filters on, the copies of that branch only
+func (q *Queries) ListBooks(ctx context.Context, arg ListBooksParams) ([]ListBooksRow, error) {
+	rows, err := q.db.Query(ctx, listBooks,
+		arg.SubjectID,
+		arg.BranchID,
+		arg.AuthorID,
+		arg.AvailableOnly,
+		arg.TitlePrefix,
+		arg.CursorID,
+		arg.SortOrder,
+		arg.CursorTitle,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListBooksRow
+	for rows.Next() {
+		var i ListBooksRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Description,
+			&i.WorkID,
+			&i.AvailableCopies,
+			&i.TotalCopies,
+			&i.RatingCount,
+			&i.RatingAverage,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBooksForExport = `-- name: ListBooksForExport :many
+SELECT id, title, description, isbn, work_id, edition, publisher, published_year, language, archived_at, cover_updated_at, version
+FROM books
+WHERE ((cardinality($1::int[]) = 0 AND archived_at IS NULL) OR id = ANY($1::int[]))
+  AND id > $2::int
+ORDER BY id
+LIMIT $3::int
+`
+
+type ListBooksForExportParams struct {
+	Ids      []int32
+	AfterID  int32
+	PageSize int32
+}
+
+// Usecase: export the catalog, or the selected books, in ID order
+// An empty ids array selects every book that is not archived
+func (q *Queries) ListBooksForExport(ctx context.Context, arg ListBooksForExportParams) ([]Book, error) {
+	rows, err := q.db.Query(ctx, listBooksForExport, arg.Ids, arg.AfterID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Book
+	for rows.Next() {
+		var i Book
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Description,
+			&i.Isbn,
+			&i.WorkID,
+			&i.Edition,
+			&i.Publisher,
+			&i.PublishedYear,
+			&i.Language,
+			&i.ArchivedAt,
+			&i.CoverUpdatedAt,
+			&i.Version,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBorrowedBooks = `-- name: ListBorrowedBooks :many
+SELECT b.id, b.title, b.description, bb.borrowed_at, bb.returned_at, bb.copy_id, c.barcode, bb.due_at,
+       bb.id AS loan_id, bb.renewals
+FROM borrowed_books bb
+JOIN books b ON bb.book_id = b.id
+LEFT JOIN book_copies c ON bb.copy_id = c.id
+WHERE bb.user_id = $1 AND bb.returned_at IS NULL
+`
+
+type ListBorrowedBooksRow struct {
+	ID          int32
+	Title       string
+	Description string
+	BorrowedAt  pgtype.Timestamp
+	ReturnedAt  pgtype.Timestamp
+	CopyID      pgtype.Int4
+	Barcode     pgtype.Text
+	DueAt       pgtype.Timestamp
+	LoanID      int32
+	Renewals    int32
+}
+
+func (q *Queries) ListBorrowedBooks(ctx context.Context, userID int32) ([]ListBorrowedBooksRow, error) {
+	rows, err := q.db.Query(ctx, listBorrowedBooks, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListBorrowedBooksRow
+	for rows.Next() {
+		var i ListBorrowedBooksRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Description,
+			&i.BorrowedAt,
+			&i.ReturnedAt,
+			&i.CopyID,
+			&i.Barcode,
+			&i.DueAt,
+			&i.LoanID,
+			&i.Renewals,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBorrowingLimits = `-- name: ListBorrowingLimits :many
+SELECT id, role, max_loans, max_copies_per_title
+FROM borrowing_limits
+ORDER BY role
+`
+
+// Usecase: borrowing limits
+func (q *Queries) ListBorrowingLimits(ctx context.Context) ([]BorrowingLimit, error) {
+	rows, err := q.db.Query(ctx, listBorrowingLimits)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BorrowingLimit
+	for rows.Next() {
+		var i BorrowingLimit
+		if err := rows.Scan(
+			&i.ID,
+			&i.Role,
+			&i.MaxLoans,
+			&i.MaxCopiesPerTitle,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBranches = `-- name: ListBranches :many
+SELECT id, code, name, address
+FROM branches
+ORDER BY id
+`
+
+func (q *Queries) ListBranches(ctx context.Context) ([]Branch, error) {
+	rows, err := q.db.Query(ctx, listBranches)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Branch
+	for rows.Next() {
+		var i Branch
+		if err := rows.Scan(
+			&i.ID,
+			&i.Code,
+			&i.Name,
+			&i.Address,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCopyTransfers = `-- name: ListCopyTransfers :many
+SELECT id, copy_id, from_branch_id, to_branch_id, status, requested_by, shipped_at, completed_at
+FROM copy_transfers
+WHERE ($1::text IS NULL OR status = $1::text)
+  AND ($2::int IS NULL
+       OR from_branch_id = $2::int OR to_branch_id = $2::int)
+  AND id > $3::int
+ORDER BY id
+LIMIT $4::int
+`
+
+type ListCopyTransfersParams struct {
+	Status   pgtype.Text
+	BranchID pgtype.Int4
+	AfterID  int32
+	PageSize int32
+}
+
+// Transfers from or to a branch, oldest first
+func (q *Queries) ListCopyTransfers(ctx context.Context, arg ListCopyTransfersParams) ([]CopyTransfer, error) {
+	rows, err := q.db.Query(ctx, listCopyTransfers,
+		arg.Status,
+		arg.BranchID,
+		arg.AfterID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CopyTransfer
+	for rows.Next() {
+		var i CopyTransfer
+		if err := rows.Scan(
+			&i.ID,
+			&i.CopyID,
+			&i.FromBranchID,
+			&i.ToBranchID,
+			&i.Status,
+			&i.RequestedBy,
+			&i.ShippedAt,
+			&i.CompletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEditionsByWorkIDs = `-- name: ListEditionsByWorkIDs :many
+SELECT b.id, b.work_id, b.title, b.isbn, b.edition, b.publisher, b.published_year, b.language,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status = 'available')::int AS available_copies,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status <> 'retired')::int AS total_copies
+FROM books b
+WHERE b.work_id = ANY($1::int[])
+  AND b.archived_at IS NULL
+ORDER BY b.work_id, b.published_year NULLS LAST, b.id
+`
+
+type ListEditionsByWorkIDsRow struct {
+	ID              int32
+	WorkID          int32
+	Title           string
+	Isbn            pgtype.Text
+	Edition         string
+	Publisher       string
+	PublishedYear   pgtype.Int4
+	Language        string
+	AvailableCopies int32
+	TotalCopies     int32
+}
+
+func (q *Queries) ListEditionsByWorkIDs(ctx context.Context, workIds []int32) ([]ListEditionsByWorkIDsRow, error) {
+	rows, err := q.db.Query(ctx, listEditionsByWorkIDs, workIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListEditionsByWorkIDsRow
+	for rows.Next() {
+		var i ListEditionsByWorkIDsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.WorkID,
+			&i.Title,
+			&i.Isbn,
+			&i.Edition,
+			&i.Publisher,
+			&i.PublishedYear,
+			&i.Language,
+			&i.AvailableCopies,
+			&i.TotalCopies,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFeeSchedules = `-- name: ListFeeSchedules :many
+SELECT id, role, daily_fine_cents, grace_days, max_fine_cents, block_balance_cents
+FROM fee_schedules
+ORDER BY role
+`
+
+// Usecase: overdue fines
+func (q *Queries) ListFeeSchedules(ctx context.Context) ([]FeeSchedule, error) {
+	rows, err := q.db.Query(ctx, listFeeSchedules)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FeeSchedule
+	for rows.Next() {
+		var i FeeSchedule
+		if err := rows.Scan(
+			&i.ID,
+			&i.Role,
+			&i.DailyFineCents,
+			&i.GraceDays,
+			&i.MaxFineCents,
+			&i.BlockBalanceCents,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listHolds = `-- name: ListHolds :many
+SELECT h.id, h.book_id, b.title, h.user_id, h.status, h.copy_id, c.branch_id,
+       h.placed_at, h.ready_at, h.expires_at,
+       CASE WHEN h.status = 'waiting' THEN (
+           SELECT count(*) FROM holds w
+           WHERE w.book_id = h.book_id AND w.status = 'waiting' AND (w.placed_at, w.id) <= (h.placed_at, h.id)
+       ) ELSE 0 END::int AS position
+FROM holds h
+JOIN books b ON b.id = h.book_id
+LEFT JOIN book_copies c ON c.id = h.copy_id
+WHERE h.status IN ('waiting', 'ready')
+  AND ($1::int IS NULL OR h.id = $1::int)
+  AND ($2::int IS NULL OR h.user_id = $2::int)
+  AND ($3::int IS NULL OR h.book_id = $3::int)
+ORDER BY h.placed_at, h.id
+`
+
+type ListHoldsParams struct {
+	ID     pgtype.Int4
+	UserID pgtype.Int4
+	BookID pgtype.Int4
+}
+
+type ListHoldsRow struct {
+	ID        int32
+	BookID    int32
+	Title     string
+	UserID    int32
+	Status    string
+	CopyID    pgtype.Int4
+	BranchID  pgtype.Int4
+	PlacedAt  pgtype.Timestamp
+	ReadyAt   pgtype.Timestamp
+	ExpiresAt pgtype.Timestamp
+	Position  int32
+}
+
+// Open holds with their place in the queue, 0 once a copy is set aside
+func (q *Queries) ListHolds(ctx context.Context, arg ListHoldsParams) ([]ListHoldsRow, error) {
+	rows, err := q.db.Query(ctx, listHolds, arg.ID, arg.UserID, arg.BookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListHoldsRow
+	for rows.Next() {
+		var i ListHoldsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.BookID,
+			&i.Title,
+			&i.UserID,
+			&i.Status,
+			&i.CopyID,
+			&i.BranchID,
+			&i.PlacedAt,
+			&i.ReadyAt,
+			&i.ExpiresAt,
+			&i.Position,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLoanPolicies = `-- name: ListLoanPolicies :many
+SELECT id, role, book_id, loan_days, max_renewals
+FROM loan_policies
+ORDER BY role, book_id NULLS FIRST
+`
+
+// Usecase: loan policies
+func (q *Queries) ListLoanPolicies(ctx context.Context) ([]LoanPolicy, error) {
+	rows, err := q.db.Query(ctx, listLoanPolicies)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LoanPolicy
+	for rows.Next() {
+		var i LoanPolicy
+		if err := rows.Scan(
+			&i.ID,
+			&i.Role,
+			&i.BookID,
+			&i.LoanDays,
+			&i.MaxRenewals,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLoans = `-- name: ListLoans :many
+SELECT bb.id, bb.user_id, u.name AS user_name, bb.book_id, b.title, bb.copy_id, c.barcode, bb.branch_id,
+       bb.borrowed_at, bb.due_at, bb.returned_at, bb.renewals
+FROM borrowed_books bb
+JOIN books b ON b.id = bb.book_id
+JOIN users u ON u.id = bb.user_id
+LEFT JOIN book_copies c ON c.id = bb.copy_id
+WHERE ($1::int IS NULL OR bb.user_id = $1::int)
+  AND ($2::int IS NULL OR bb.book_id = $2::int)
+  AND ($3::text IS NULL
+       OR ($3::text = 'active' AND bb.returned_at IS NULL)
+       OR ($3::text = 'returned' AND bb.returned_at IS NOT NULL)
+       OR ($3::text = 'overdue' AND bb.returned_at IS NULL AND bb.due_at < CURRENT_TIMESTAMP))
+  AND ($4::timestamp IS NULL OR bb.borrowed_at >= $4::timestamp)
+  AND ($5::timestamp IS NULL OR bb.borrowed_at < $5::timestamp)
+  AND ($6::int = 0 OR bb.id < $6::int)
+ORDER BY bb.id DESC
+LIMIT $7::int
+`
+
+type ListLoansParams struct {
+	UserID         pgtype.Int4
+	BookID         pgtype.Int4
+	Status         pgtype.Text
+	BorrowedFrom   pgtype.Timestamp
+	BorrowedBefore pgtype.Timestamp
+	BeforeID       int32
+	PageSize       int32
+}
+
+type ListLoansRow struct {
+	ID         int32
+	UserID     int32
+	UserName   pgtype.Text
+	BookID     int32
+	Title      string
+	CopyID     pgtype.Int4
+	Barcode    pgtype.Text
+	BranchID   pgtype.Int4
+	BorrowedAt pgtype.Timestamp
+	DueAt      pgtype.Timestamp
+	ReturnedAt pgtype.Timestamp
+	Renewals   int32
+}
+
+// Usecase: loan history, newest first
+// status = active, returned or overdue (active past its due date)
+func (q *Queries) ListLoans(ctx context.Context, arg ListLoansParams) ([]ListLoansRow, error) {
+	rows, err := q.db.Query(ctx, listLoans,
+		arg.UserID,
+		arg.BookID,
+		arg.Status,
+		arg.BorrowedFrom,
+		arg.BorrowedBefore,
+		arg.BeforeID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListLoansRow
+	for rows.Next() {
+		var i ListLoansRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.UserName,
+			&i.BookID,
+			&i.Title,
+			&i.CopyID,
+			&i.Barcode,
+			&i.BranchID,
+			&i.BorrowedAt,
+			&i.DueAt,
+			&i.ReturnedAt,
+			&i.Renewals,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOverdueLoans = `-- name: ListOverdueLoans :many
+SELECT bb.id, bb.book_id, b.title, bb.copy_id, c.barcode, bb.branch_id, bb.borrowed_at, bb.due_at,
+       (CURRENT_DATE - bb.due_at::date)::int AS days_overdue,
+       u.id AS user_id, u.name AS user_name, u.email AS user_email
+FROM borrowed_books bb
+JOIN books b ON b.id = bb.book_id
+JOIN users u ON u.id = bb.user_id
+LEFT JOIN book_copies c ON c.id = bb.copy_id
+WHERE bb.returned_at IS NULL AND bb.due_at < CURRENT_TIMESTAMP
+  AND ($1::int IS NULL OR bb.branch_id = $1::int)
+ORDER BY bb.due_at, bb.id
+LIMIT $2::int OFFSET $3::int
+`
+
+type ListOverdueLoansParams struct {
+	BranchID   pgtype.Int4
+	PageSize   int32
+	PageOffset int32
+}
+
+type ListOverdueLoansRow struct {
+	ID          int32
+	BookID      int32
+	Title       string
+	CopyID      pgtype.Int4
+	Barcode     pgtype.Text
+	BranchID    pgtype.Int4
+	BorrowedAt  pgtype.Timestamp
+	DueAt       pgtype.Timestamp
+	DaysOverdue int32
+	UserID      int32
+	UserName    pgtype.Text
+	UserEmail   string
+}
+
+// Usecase: loans past their due date, most overdue first
+func (q *Queries) ListOverdueLoans(ctx context.Context, arg ListOverdueLoansParams) ([]ListOverdueLoansRow, error) {
+	rows, err := q.db.Query(ctx, listOverdueLoans, arg.BranchID, arg.PageSize, arg.PageOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListOverdueLoansRow
+	for rows.Next() {
+		var i ListOverdueLoansRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.BookID,
+			&i.Title,
+			&i.CopyID,
+			&i.Barcode,
+			&i.BranchID,
+			&i.BorrowedAt,
+			&i.DueAt,
+			&i.DaysOverdue,
+			&i.UserID,
+			&i.UserName,
+			&i.UserEmail,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReviews = `-- name: ListReviews :many
+SELECT id, user_id, book_id, rating, body, hidden_at, hidden_reason, created_at, updated_at
+FROM reviews
+WHERE ($1::bool IS NULL OR (hidden_at IS NOT NULL) = $1::bool)
+  AND ($2::int IS NULL OR id < $2::int)
+ORDER BY id DESC
+LIMIT $3::int
+`
+
+type ListReviewsParams struct {
+	Hidden   pgtype.Bool
+	BeforeID pgtype.Int4
+	PageSize int32
+}
+
+// Usecase: review moderation
+func (q *Queries) ListReviews(ctx context.Context, arg ListReviewsParams) ([]Review, error) {
+	rows, err := q.db.Query(ctx, listReviews, arg.Hidden, arg.BeforeID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Review
+	for rows.Next() {
+		var i Review
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.BookID,
+			&i.Rating,
+			&i.Body,
+			&i.HiddenAt,
+			&i.HiddenReason,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSubjects = `-- name: ListSubjects :many
+SELECT id, name, parent_id
+FROM subjects
+ORDER BY id
+`
+
+func (q *Queries) ListSubjects(ctx context.Context) ([]Subject, error) {
+	rows, err := q.db.Query(ctx, listSubjects)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Subject
+	for rows.Next() {
+		var i Subject
+		if err := rows.Scan(&i.ID, &i.Name, &i.ParentID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSubjectsByWorkID = `-- name: ListSubjectsByWorkID :many
+SELECT s.id, s.name, s.parent_id
+FROM subjects s
+JOIN work_subjects ws ON s.id = ws.subject_id
+WHERE ws.work_id = $1
+ORDER BY s.id
+`
+
+func (q *Queries) ListSubjectsByWorkID(ctx context.Context, workID int32) ([]Subject, error) {
+	rows, err := q.db.Query(ctx, listSubjectsByWorkID, workID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Subject
+	for rows.Next() {
+		var i Subject
+		if err := rows.Scan(&i.ID, &i.Name, &i.ParentID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserRecommendations = `-- name: ListUserRecommendations :many
+SELECT b.id, b.title, sum(r.score)::float8 AS score, sum(r.co_borrowers)::int AS co_borrowers
+FROM book_recommendations r
+JOIN books b ON b.id = r.recommended_book_id
+WHERE r.book_id IN (SELECT bb.book_id FROM borrowed_books bb WHERE bb.user_id = $1::int)
+  AND b.archived_at IS NULL
+  AND NOT EXISTS (
+        SELECT 1 FROM borrowed_books bb
+        WHERE bb.user_id = $1::int AND bb.book_id = b.id)
+GROUP BY b.id, b.title
+ORDER BY score DESC, b.id
+LIMIT $2::int
+`
+
+type ListUserRecommendationsParams struct {
+	UserID   int32
+	PageSize int32
+}
+
+type ListUserRecommendationsRow struct {
+	ID          int32
+	Title       string
+	Score       float64
+	CoBorrowers int32
+}
+
+// Recommendations of every book the user has borrowed, summed per book,
+// less the books the user has ever borrowed
+func (q *Queries) ListUserRecommendations(ctx context.Context, arg ListUserRecommendationsParams) ([]ListUserRecommendationsRow, error) {
+	rows, err := q.db.Query(ctx, listUserRecommendations, arg.UserID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserRecommendationsRow
+	for rows.Next() {
+		var i ListUserRecommendationsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Score,
+			&i.CoBorrowers,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWorks = `-- name: ListWorks :many
+SELECT id, title, description
+FROM works w
+WHERE ($1::text IS NULL OR lower(w.title) LIKE lower($1::text) || '%')
+  AND w.id > $2::int
+  AND EXISTS (SELECT 1 FROM books b WHERE b.work_id = w.id AND b.archived_at IS NULL)
+ORDER BY w.id
+LIMIT $3::int
+`
+
+type ListWorksParams struct {
+	TitlePrefix pgtype.Text
+	AfterID     int32
+	PageSize    int32
+}
+
+func (q *Queries) ListWorks(ctx context.Context, arg ListWorksParams) ([]Work, error) {
+	rows, err := q.db.Query(ctx, listWorks, arg.TitlePrefix, arg.AfterID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Work
+	for rows.Next() {
+		var i Work
+		if err := rows.Scan(&i.ID, &i.Title, &i.Description); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockBook = `-- name: LockBook :one
+SELECT id
+FROM books
+WHERE id = $1::int
+FOR UPDATE
+`
+
+// Locks the book so that an edit is diffed against the values it replaces
+func (q *Queries) LockBook(ctx context.Context, bookID int32) (int32, error) {
+	row := q.db.QueryRow(ctx, lockBook, bookID)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const lockOverdueLoans = `-- name: LockOverdueLoans :exec
+SELECT bb.id
+FROM borrowed_books bb
+WHERE bb.due_at < COALESCE(bb.returned_at, CURRENT_TIMESTAMP)
+  AND ($1::int IS NULL OR bb.user_id = $1::int)
+ORDER BY bb.id
+FOR UPDATE
+`
+
+// Locks the loans AccrueFines charges, first ID first, so that accruals
+// running at the same time charge each loan once. It runs as a statement of
+// its own, before AccrueFines, for AccrueFines to see the charges made by
+// the accrual it waited for.
+func (q *Queries) LockOverdueLoans(ctx context.Context, userID pgtype.Int4) error {
+	_, err := q.db.Exec(ctx, lockOverdueLoans, userID)
+	return err
+}
+
+const lockUser = `-- name: LockUser :one
+SELECT id
+FROM users
+WHERE id = $1::int
+FOR UPDATE
+`
+
+// Locks the user so that their borrows are checked against their limits one
+// at a time
+func (q *Queries) LockUser(ctx context.Context, userID int32) (int32, error) {
+	row := q.db.QueryRow(ctx, lockUser, userID)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const moveAuthorWorks = `-- name: MoveAuthorWorks :exec
+INSERT INTO work_authors (work_id, author_id)
+SELECT work_id, $1::int
+FROM work_authors
+WHERE author_id = ANY($2::int[])
+ON CONFLICT (work_id, author_id) DO NOTHING
+`
+
+type MoveAuthorWorksParams struct {
+	CanonicalID  int32
+	DuplicateIds []int32
+}
+
+// Usecase: merge duplicate authors onto a canonical one
+func (q *Queries) MoveAuthorWorks(ctx context.Context, arg MoveAuthorWorksParams) error {
+	_, err := q.db.Exec(ctx, moveAuthorWorks, arg.CanonicalID, arg.DuplicateIds)
+	return err
+}
+
+const moveEditionsToWork = `-- name: MoveEditionsToWork :many
+WITH moved AS (
+    SELECT id, work_id
+    FROM books
+    WHERE id = ANY($1::int[])
+    FOR UPDATE
+)
+UPDATE books b
+SET work_id = $2::int
+FROM moved m
+WHERE b.id = m.id
+RETURNING m.work_id AS previous_work_id
+`
+
+type MoveEditionsToWorkParams struct {
+	BookIds []int32
+	WorkID  int32
+}
+
+// Usecase: attach editions catalogued as separate works to one work
+// Returns the works the editions were taken from
+func (q *Queries) MoveEditionsToWork(ctx context.Context, arg MoveEditionsToWorkParams) ([]int32, error) {
+	rows, err := q.db.Query(ctx, moveEditionsToWork, arg.BookIds, arg.WorkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var previous_work_id int32
+		if err := rows.Scan(&previous_work_id); err != nil {
+			return nil, err
+		}
+		items = append(items, previous_work_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const nextWaitingHold = `-- name: NextWaitingHold :one
+SELECT id, book_id, user_id, status, copy_id, placed_at, ready_at, expires_at, closed_at
+FROM holds
+WHERE book_id = $1 AND status = 'waiting'
+ORDER BY placed_at, id
+LIMIT 1
+FOR UPDATE
+`
+
+// The first hold placed is served first
+func (q *Queries) NextWaitingHold(ctx context.Context, bookID int32) (Hold, error) {
+	row := q.db.QueryRow(ctx, nextWaitingHold, bookID)
+	var i Hold
+	err := row.Scan(
 		&i.ID,
-		&i.Email,
-		&i.Name,
-		&i.Role,
-		&i.PasswordHash,
-		&i.Nonce,
+		&i.BookID,
+		&i.UserID,
+		&i.Status,
+		&i.CopyID,
+		&i.PlacedAt,
+		&i.ReadyAt,
+		&i.ExpiresAt,
+		&i.ClosedAt,
 	)
 	return i, err
 }
 
-const insertBorrowedBook = `-- name: InsertBorrowedBook :exec
-INSERT INTO borrowed_books (user_id, book_id) 
-VALUES ($1, $2)
+const pickAvailableCopy = `-- name: PickAvailableCopy :one
+SELECT id, branch_id
+FROM book_copies
+WHERE book_id = $1::int AND status = 'available'
+  AND ($2::int IS NULL OR branch_id = $2::int)
+  AND NOT EXISTS (SELECT 1 FROM books b WHERE b.id = $1::int AND b.archived_at IS NOT NULL)
+ORDER BY id
+LIMIT 1
+FOR UPDATE SKIP LOCKED
 `
 
-type InsertBorrowedBookParams struct {
-	UserID int32
-	BookID int32
+type PickAvailableCopyParams struct {
+	BookID   int32
+	BranchID pgtype.Int4
+}
+
+type PickAvailableCopyRow struct {
+	ID       int32
+	BranchID int32
+}
+
+// Usercase: borrow a book
+// Lock one available copy so concurrent borrowers get different copies
+// A branch_id picks a copy shelved at that branch
+func (q *Queries) PickAvailableCopy(ctx context.Context, arg PickAvailableCopyParams) (PickAvailableCopyRow, error) {
+	row := q.db.QueryRow(ctx, pickAvailableCopy, arg.BookID, arg.BranchID)
+	var i PickAvailableCopyRow
+	err := row.Scan(&i.ID, &i.BranchID)
+	return i, err
+}
+
+const readyHold = `-- name: ReadyHold :exec
+UPDATE holds
+SET status = 'ready', copy_id = $2, ready_at = CURRENT_TIMESTAMP,
+    expires_at = CURRENT_TIMESTAMP + make_interval(days => $3::int)
+WHERE id = $1
+`
+
+type ReadyHoldParams struct {
+	ID         int32
+	CopyID     pgtype.Int4
+	PickupDays int32
 }
 
-func (q *Queries) InsertBorrowedBook(ctx context.Context, arg InsertBorrowedBookParams) error {
-	_, err := q.db.Exec(ctx, insertBorrowedBook, arg.UserID, arg.BookID)
+// Usecase: a copy was set aside for the hold, to be picked up in time
+func (q *Queries) ReadyHold(ctx context.Context, arg ReadyHoldParams) error {
+	_, err := q.db.Exec(ctx, readyHold, arg.ID, arg.CopyID, arg.PickupDays)
 	return err
 }
 
-const listBorrowedBooks = `-- name: ListBorrowedBooks :many
-SELECT b.id, b.title, b.description, bb.borrowed_at, bb.returned_at
-FROM borrowed_books bb
-JOIN books b ON bb.book_id = b.id
-WHERE bb.user_id = $1 AND bb.returned_at IS NULL
+const removeWorkAuthor = `-- name: RemoveWorkAuthor :execrows
+DELETE FROM work_authors
+WHERE work_id = $1 AND author_id = $2
 `
 
-type ListBorrowedBooksRow struct {
-	ID          int32
-	Title       string
-	Description string
-	BorrowedAt  pgtype.Timestamp
-	ReturnedAt  pgtype.Timestamp
+type RemoveWorkAuthorParams struct {
+	WorkID   int32
+	AuthorID int32
 }
 
-func (q *Queries) ListBorrowedBooks(ctx context.Context, userID int32) ([]ListBorrowedBooksRow, error) {
-	rows, err := q.db.Query(ctx, listBorrowedBooks, userID)
+// Usecase: remove an author from a work and so from all of its editions
+func (q *Queries) RemoveWorkAuthor(ctx context.Context, arg RemoveWorkAuthorParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeWorkAuthor, arg.WorkID, arg.AuthorID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const removeWorkSubject = `-- name: RemoveWorkSubject :execrows
+DELETE FROM work_subjects
+WHERE work_id = $1 AND subject_id = $2
+`
+
+type RemoveWorkSubjectParams struct {
+	WorkID    int32
+	SubjectID int32
+}
+
+func (q *Queries) RemoveWorkSubject(ctx context.Context, arg RemoveWorkSubjectParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeWorkSubject, arg.WorkID, arg.SubjectID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const renewLoan = `-- name: RenewLoan :one
+UPDATE borrowed_books
+SET due_at = GREATEST(due_at, CURRENT_TIMESTAMP + make_interval(days => $2::int)),
+    renewals = renewals + 1
+WHERE id = $1
+RETURNING id, user_id, book_id, borrowed_at, returned_at, copy_id, branch_id, due_at, renewals
+`
+
+type RenewLoanParams struct {
+	ID       int32
+	LoanDays int32
+}
+
+// Usecase: a renewed loan is due one loan period from now, never earlier
+// than it was
+func (q *Queries) RenewLoan(ctx context.Context, arg RenewLoanParams) (BorrowedBook, error) {
+	row := q.db.QueryRow(ctx, renewLoan, arg.ID, arg.LoanDays)
+	var i BorrowedBook
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.BookID,
+		&i.BorrowedAt,
+		&i.ReturnedAt,
+		&i.CopyID,
+		&i.BranchID,
+		&i.DueAt,
+		&i.Renewals,
+	)
+	return i, err
+}
+
+const restoreBook = `-- name: RestoreBook :execrows
+UPDATE books
+SET archived_at = NULL, version = version + 1
+WHERE id = $1 AND archived_at IS NOT NULL
+`
+
+func (q *Queries) RestoreBook(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, restoreBook, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const retireBookCopy = `-- name: RetireBookCopy :exec
+UPDATE book_copies
+SET status = 'retired', retired_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+func (q *Queries) RetireBookCopy(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, retireBookCopy, id)
+	return err
+}
+
+const searchBooks = `-- name: SearchBooks :many
+SELECT b.id, b.title, b.description,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status = 'available')::int AS available_copies,
+       ts_rank(s.document, websearch_to_tsquery('english', $1::text))::real AS rank,
+       ts_headline('english', b.title, websearch_to_tsquery('english', $1::text),
+           'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')::text AS title_highlight,
+       ts_headline('english', b.description, websearch_to_tsquery('english', $1::text),
+           'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10')::text AS snippet
+FROM book_search s
+JOIN books b ON b.id = s.book_id
+WHERE s.document @@ websearch_to_tsquery('english', $1::text)
+  AND b.archived_at IS NULL
+ORDER BY rank DESC, b.id
+LIMIT $2::int OFFSET $3::int
+`
+
+type SearchBooksParams struct {
+	Query      string
+	PageSize   int32
+	PageOffset int32
+}
+
+type SearchBooksRow struct {
+	ID              int32
+	Title           string
+	Description     string
+	AvailableCopies int32
+	Rank            float32
+	TitleHighlight  string
+	Snippet         string
+}
+
+// Usecase: full-text search over title, author names and description
+func (q *Queries) SearchBooks(ctx context.Context, arg SearchBooksParams) ([]SearchBooksRow, error) {
+	rows, err := q.db.Query(ctx, searchBooks, arg.Query, arg.PageSize, arg.PageOffset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []ListBorrowedBooksRow
+	var items []SearchBooksRow
 	for rows.Next() {
-		var i ListBorrowedBooksRow
+		var i SearchBooksRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.Title,
 			&i.Description,
-			&i.BorrowedAt,
-			&i.ReturnedAt,
+			&i.AvailableCopies,
+			&i.Rank,
+			&i.TitleHighlight,
+			&i.Snippet,
 		); err != nil {
 			return nil, err
 		}
@@ -269,30 +3158,323 @@ func (q *Queries) ListBorrowedBooks(ctx context.Context, userID int32) ([]ListBo
 	return items, nil
 }
 
-const updateBookCopiesAddOne = `-- name: UpdateBookCopiesAddOne :exec
-UPDATE books 
-SET num_copy = num_copy + 1 
+const setBookCover = `-- name: SetBookCover :execrows
+UPDATE books
+SET cover_updated_at = $2
 WHERE id = $1
 `
 
-// Usercase: return a book
-func (q *Queries) UpdateBookCopiesAddOne(ctx context.Context, id int32) error {
-	_, err := q.db.Exec(ctx, updateBookCopiesAddOne, id)
+type SetBookCoverParams struct {
+	ID             int32
+	CoverUpdatedAt pgtype.Timestamp
+}
+
+// Usecase: a new cover image was stored
+func (q *Queries) SetBookCover(ctx context.Context, arg SetBookCoverParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setBookCover, arg.ID, arg.CoverUpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setCopyStatus = `-- name: SetCopyStatus :exec
+UPDATE book_copies
+SET status = $2
+WHERE id = $1
+`
+
+type SetCopyStatusParams struct {
+	ID     int32
+	Status string
+}
+
+func (q *Queries) SetCopyStatus(ctx context.Context, arg SetCopyStatusParams) error {
+	_, err := q.db.Exec(ctx, setCopyStatus, arg.ID, arg.Status)
+	return err
+}
+
+const shelveCopy = `-- name: ShelveCopy :exec
+UPDATE book_copies
+SET status = 'available', branch_id = COALESCE($1::int, branch_id)
+WHERE id = $2::int
+`
+
+type ShelveCopyParams struct {
+	BranchID pgtype.Int4
+	ID       int32
+}
+
+// A copy returned at another branch is shelved there
+func (q *Queries) ShelveCopy(ctx context.Context, arg ShelveCopyParams) error {
+	_, err := q.db.Exec(ctx, shelveCopy, arg.BranchID, arg.ID)
+	return err
+}
+
+const unhideReview = `-- name: UnhideReview :execrows
+UPDATE reviews
+SET hidden_at = NULL, hidden_reason = ''
+WHERE id = $1
+`
+
+func (q *Queries) UnhideReview(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, unhideReview, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateAuthor = `-- name: UpdateAuthor :execrows
+UPDATE authors
+SET name = $2, bio = $3
+WHERE id = $1
+`
+
+type UpdateAuthorParams struct {
+	ID   int32
+	Name string
+	Bio  string
+}
+
+func (q *Queries) UpdateAuthor(ctx context.Context, arg UpdateAuthorParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateAuthor, arg.ID, arg.Name, arg.Bio)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateBookCopy = `-- name: UpdateBookCopy :exec
+UPDATE book_copies
+SET status = $2, condition = $3, shelf_location = $4
+WHERE id = $1
+`
+
+type UpdateBookCopyParams struct {
+	ID            int32
+	Status        string
+	Condition     string
+	ShelfLocation string
+}
+
+func (q *Queries) UpdateBookCopy(ctx context.Context, arg UpdateBookCopyParams) error {
+	_, err := q.db.Exec(ctx, updateBookCopy,
+		arg.ID,
+		arg.Status,
+		arg.Condition,
+		arg.ShelfLocation,
+	)
 	return err
 }
 
+const updateBranch = `-- name: UpdateBranch :execrows
+UPDATE branches
+SET code = $2, name = $3, address = $4
+WHERE id = $1
+`
+
+type UpdateBranchParams struct {
+	ID      int32
+	Code    string
+	Name    string
+	Address string
+}
+
+func (q *Queries) UpdateBranch(ctx context.Context, arg UpdateBranchParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateBranch,
+		arg.ID,
+		arg.Code,
+		arg.Name,
+		arg.Address,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateReturnedBook = `-- name: UpdateReturnedBook :exec
 UPDATE borrowed_books
 SET returned_at = CURRENT_TIMESTAMP
-WHERE user_id = $1 AND book_id = $2 AND returned_at IS NULL
+WHERE id = $1
+`
+
+func (q *Queries) UpdateReturnedBook(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, updateReturnedBook, id)
+	return err
+}
+
+const updateSubject = `-- name: UpdateSubject :execrows
+UPDATE subjects
+SET name = $2, parent_id = $3
+WHERE id = $1
+`
+
+type UpdateSubjectParams struct {
+	ID       int32
+	Name     string
+	ParentID pgtype.Int4
+}
+
+func (q *Queries) UpdateSubject(ctx context.Context, arg UpdateSubjectParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateSubject, arg.ID, arg.Name, arg.ParentID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateWork = `-- name: UpdateWork :execrows
+UPDATE works
+SET title = $2, description = $3
+WHERE id = $1
+`
+
+type UpdateWorkParams struct {
+	ID          int32
+	Title       string
+	Description string
+}
+
+func (q *Queries) UpdateWork(ctx context.Context, arg UpdateWorkParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateWork, arg.ID, arg.Title, arg.Description)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const upsertBorrowingLimit = `-- name: UpsertBorrowingLimit :one
+INSERT INTO borrowing_limits (role, max_loans, max_copies_per_title)
+VALUES ($1, $2, $3)
+ON CONFLICT (role) DO UPDATE
+SET max_loans = EXCLUDED.max_loans, max_copies_per_title = EXCLUDED.max_copies_per_title
+RETURNING id, role, max_loans, max_copies_per_title
+`
+
+type UpsertBorrowingLimitParams struct {
+	Role              string
+	MaxLoans          int32
+	MaxCopiesPerTitle int32
+}
+
+func (q *Queries) UpsertBorrowingLimit(ctx context.Context, arg UpsertBorrowingLimitParams) (BorrowingLimit, error) {
+	row := q.db.QueryRow(ctx, upsertBorrowingLimit, arg.Role, arg.MaxLoans, arg.MaxCopiesPerTitle)
+	var i BorrowingLimit
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.MaxLoans,
+		&i.MaxCopiesPerTitle,
+	)
+	return i, err
+}
+
+const upsertFeeSchedule = `-- name: UpsertFeeSchedule :one
+INSERT INTO fee_schedules (role, daily_fine_cents, grace_days, max_fine_cents, block_balance_cents)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (role) DO UPDATE
+SET daily_fine_cents = EXCLUDED.daily_fine_cents, grace_days = EXCLUDED.grace_days,
+    max_fine_cents = EXCLUDED.max_fine_cents, block_balance_cents = EXCLUDED.block_balance_cents
+RETURNING id, role, daily_fine_cents, grace_days, max_fine_cents, block_balance_cents
 `
 
-type UpdateReturnedBookParams struct {
+type UpsertFeeScheduleParams struct {
+	Role              string
+	DailyFineCents    int32
+	GraceDays         int32
+	MaxFineCents      pgtype.Int4
+	BlockBalanceCents pgtype.Int4
+}
+
+func (q *Queries) UpsertFeeSchedule(ctx context.Context, arg UpsertFeeScheduleParams) (FeeSchedule, error) {
+	row := q.db.QueryRow(ctx, upsertFeeSchedule,
+		arg.Role,
+		arg.DailyFineCents,
+		arg.GraceDays,
+		arg.MaxFineCents,
+		arg.BlockBalanceCents,
+	)
+	var i FeeSchedule
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.DailyFineCents,
+		&i.GraceDays,
+		&i.MaxFineCents,
+		&i.BlockBalanceCents,
+	)
+	return i, err
+}
+
+const upsertLoanPolicy = `-- name: UpsertLoanPolicy :one
+INSERT INTO loan_policies (role, book_id, loan_days, max_renewals)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (role, COALESCE(book_id, 0)) DO UPDATE
+SET loan_days = EXCLUDED.loan_days, max_renewals = EXCLUDED.max_renewals
+RETURNING id, role, book_id, loan_days, max_renewals
+`
+
+type UpsertLoanPolicyParams struct {
+	Role        string
+	BookID      pgtype.Int4
+	LoanDays    int32
+	MaxRenewals int32
+}
+
+func (q *Queries) UpsertLoanPolicy(ctx context.Context, arg UpsertLoanPolicyParams) (LoanPolicy, error) {
+	row := q.db.QueryRow(ctx, upsertLoanPolicy,
+		arg.Role,
+		arg.BookID,
+		arg.LoanDays,
+		arg.MaxRenewals,
+	)
+	var i LoanPolicy
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.BookID,
+		&i.LoanDays,
+		&i.MaxRenewals,
+	)
+	return i, err
+}
+
+const upsertReview = `-- name: UpsertReview :one
+INSERT INTO reviews (user_id, book_id, rating, body)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, book_id) DO UPDATE
+SET rating = EXCLUDED.rating, body = EXCLUDED.body, updated_at = CURRENT_TIMESTAMP
+RETURNING id, user_id, book_id, rating, body, hidden_at, hidden_reason, created_at, updated_at
+`
+
+type UpsertReviewParams struct {
 	UserID int32
 	BookID int32
+	Rating int32
+	Body   string
 }
 
-func (q *Queries) UpdateReturnedBook(ctx context.Context, arg UpdateReturnedBookParams) error {
-	_, err := q.db.Exec(ctx, updateReturnedBook, arg.UserID, arg.BookID)
-	return err
+// A patron reviewing a book again replaces the review; moderation stays
+func (q *Queries) UpsertReview(ctx context.Context, arg UpsertReviewParams) (Review, error) {
+	row := q.db.QueryRow(ctx, upsertReview,
+		arg.UserID,
+		arg.BookID,
+		arg.Rating,
+		arg.Body,
+	)
+	var i Review
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.BookID,
+		&i.Rating,
+		&i.Body,
+		&i.HiddenAt,
+		&i.HiddenReason,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
 }
@@ -8,6 +8,19 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AccountTransaction struct {
+	ID            int32
+	UserID        int32
+	LoanID        pgtype.Int4
+	Kind          string
+	DebitAccount  string
+	CreditAccount string
+	AmountCents   int32
+	Memo          string
+	RecordedBy    string
+	CreatedAt     pgtype.Timestamp
+}
+
 type Author struct {
 	ID   int32
 	Name string
@@ -15,15 +28,52 @@ type Author struct {
 }
 
 type Book struct {
-	ID          int32
-	Title       string
-	Description string
-	NumCopy     int32
+	ID             int32
+	Title          string
+	Description    string
+	Isbn           pgtype.Text
+	WorkID         int32
+	Edition        string
+	Publisher      string
+	PublishedYear  pgtype.Int4
+	Language       string
+	ArchivedAt     pgtype.Timestamp
+	CoverUpdatedAt pgtype.Timestamp
+	Version        int32
+}
+
+type BookCopy struct {
+	ID            int32
+	BookID        int32
+	Barcode       string
+	Status        string
+	Condition     string
+	ShelfLocation string
+	AcquiredAt    pgtype.Date
+	RetiredAt     pgtype.Timestamp
+	BranchID      int32
+}
+
+type BookRecommendation struct {
+	BookID            int32
+	RecommendedBookID int32
+	Score             float64
+	CoBorrowers       int32
+	ComputedAt        pgtype.Timestamp
+}
+
+type BookRevision struct {
+	ID        int32
+	BookID    int32
+	Revision  int32
+	ChangedBy string
+	ChangedAt pgtype.Timestamp
+	Changes   []byte
 }
 
-type BookAuthor struct {
+type BookSearch struct {
 	BookID   int32
-	AuthorID int32
+	Document interface{}
 }
 
 type BorrowedBook struct {
@@ -32,6 +82,82 @@ type BorrowedBook struct {
 	BookID     int32
 	BorrowedAt pgtype.Timestamp
 	ReturnedAt pgtype.Timestamp
+	CopyID     pgtype.Int4
+	BranchID   pgtype.Int4
+	DueAt      pgtype.Timestamp
+	Renewals   int32
+}
+
+type BorrowingLimit struct {
+	ID                int32
+	Role              string
+	MaxLoans          int32
+	MaxCopiesPerTitle int32
+}
+
+type Branch struct {
+	ID      int32
+	Code    string
+	Name    string
+	Address string
+}
+
+type CopyTransfer struct {
+	ID           int32
+	CopyID       int32
+	FromBranchID int32
+	ToBranchID   int32
+	Status       string
+	RequestedBy  string
+	ShippedAt    pgtype.Timestamp
+	CompletedAt  pgtype.Timestamp
+}
+
+type FeeSchedule struct {
+	ID                int32
+	Role              string
+	DailyFineCents    int32
+	GraceDays         int32
+	MaxFineCents      pgtype.Int4
+	BlockBalanceCents pgtype.Int4
+}
+
+type Hold struct {
+	ID        int32
+	BookID    int32
+	UserID    int32
+	Status    string
+	CopyID    pgtype.Int4
+	PlacedAt  pgtype.Timestamp
+	ReadyAt   pgtype.Timestamp
+	ExpiresAt pgtype.Timestamp
+	ClosedAt  pgtype.Timestamp
+}
+
+type LoanPolicy struct {
+	ID          int32
+	Role        string
+	BookID      pgtype.Int4
+	LoanDays    int32
+	MaxRenewals int32
+}
+
+type Review struct {
+	ID           int32
+	UserID       int32
+	BookID       int32
+	Rating       int32
+	Body         string
+	HiddenAt     pgtype.Timestamp
+	HiddenReason string
+	CreatedAt    pgtype.Timestamp
+	UpdatedAt    pgtype.Timestamp
+}
+
+type Subject struct {
+	ID       int32
+	Name     string
+	ParentID pgtype.Int4
 }
 
 type User struct {
@@ -42,3 +168,19 @@ type User struct {
 	PasswordHash string
 	Nonce        string
 }
+
+type Work struct {
+	ID          int32
+	Title       string
+	Description string
+}
+
+type WorkAuthor struct {
+	WorkID   int32
+	AuthorID int32
+}
+
+type WorkSubject struct {
+	WorkID    int32
+	SubjectID int32
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_book_authors_author_id;
+DROP INDEX IF EXISTS idx_books_title_id;
+DROP INDEX IF EXISTS idx_books_lower_title;
@@ -0,0 +1,7 @@
+-- Indexes backing the paginated catalog listing (GET /books)
+-- Title prefix search and title ordering
+CREATE INDEX IF NOT EXISTS idx_books_lower_title ON books (lower(title) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_books_title_id ON books (title, id);
+
+-- Filter books by author
+CREATE INDEX IF NOT EXISTS idx_book_authors_author_id ON book_authors (author_id);
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS authors_search_refresh ON authors;
+DROP TRIGGER IF EXISTS book_authors_search_refresh ON book_authors;
+DROP TRIGGER IF EXISTS books_search_refresh ON books;
+DROP FUNCTION IF EXISTS authors_search_trigger();
+DROP FUNCTION IF EXISTS book_authors_search_trigger();
+DROP FUNCTION IF EXISTS books_search_trigger();
+DROP FUNCTION IF EXISTS refresh_book_search(INT);
+DROP TABLE IF EXISTS book_search;
@@ -0,0 +1,69 @@
+-- Full-text search document of a book: title, author names and description.
+-- Kept in its own table so the books row stays free of search internals.
+CREATE TABLE IF NOT EXISTS book_search (
+    book_id INT PRIMARY KEY,
+    document TSVECTOR NOT NULL,
+    FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_search_document ON book_search USING GIN (document);
+
+-- Rebuild the search document of one book.
+-- Title weighs most, then author names, then the description.
+CREATE OR REPLACE FUNCTION refresh_book_search(p_book_id INT) RETURNS VOID AS $$
+BEGIN
+    INSERT INTO book_search (book_id, document)
+    SELECT b.id,
+           setweight(to_tsvector('english', b.title), 'A') ||
+           setweight(to_tsvector('english', coalesce(string_agg(a.name, ' '), '')), 'B') ||
+           setweight(to_tsvector('english', b.description), 'C')
+    FROM books b
+    LEFT JOIN book_authors ba ON ba.book_id = b.id
+    LEFT JOIN authors a ON a.id = ba.author_id
+    WHERE b.id = p_book_id
+    GROUP BY b.id
+    ON CONFLICT (book_id) DO UPDATE SET document = EXCLUDED.document;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION books_search_trigger() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM refresh_book_search(NEW.id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION book_authors_search_trigger() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM refresh_book_search(OLD.book_id);
+    ELSE
+        PERFORM refresh_book_search(NEW.book_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION authors_search_trigger() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM refresh_book_search(ba.book_id)
+    FROM book_authors ba
+    WHERE ba.author_id = NEW.id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER books_search_refresh
+    AFTER INSERT OR UPDATE OF title, description ON books
+    FOR EACH ROW EXECUTE FUNCTION books_search_trigger();
+
+CREATE TRIGGER book_authors_search_refresh
+    AFTER INSERT OR DELETE ON book_authors
+    FOR EACH ROW EXECUTE FUNCTION book_authors_search_trigger();
+
+CREATE TRIGGER authors_search_refresh
+    AFTER UPDATE OF name ON authors
+    FOR EACH ROW EXECUTE FUNCTION authors_search_trigger();
+
+-- Backfill existing books
+SELECT refresh_book_search(id) FROM books;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_authors_name_key;
+DROP FUNCTION IF EXISTS author_name_key(TEXT);
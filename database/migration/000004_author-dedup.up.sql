@@ -0,0 +1,20 @@
+-- Normalized author name used to detect duplicates:
+-- case-insensitive, punctuation and repeated whitespace ignored,
+-- so "J.K. Rowling" and "j. k.  rowling" are the same author.
+CREATE OR REPLACE FUNCTION author_name_key(name TEXT) RETURNS TEXT AS $$
+    SELECT btrim(regexp_replace(lower(name), '[^[:alnum:]]+', ' ', 'g'));
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Merge the duplicates that already exist onto the oldest row
+INSERT INTO book_authors (book_id, author_id)
+SELECT ba.book_id, c.id
+FROM book_authors ba
+JOIN authors d ON d.id = ba.author_id
+JOIN authors c ON author_name_key(c.name) = author_name_key(d.name) AND c.id < d.id
+ON CONFLICT (book_id, author_id) DO NOTHING;
+
+DELETE FROM authors d
+USING authors c
+WHERE author_name_key(c.name) = author_name_key(d.name) AND c.id < d.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_authors_name_key ON authors (author_name_key(name));
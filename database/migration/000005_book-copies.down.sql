@@ -0,0 +1,11 @@
+ALTER TABLE books ADD COLUMN num_copy INT NOT NULL DEFAULT 0;
+
+UPDATE books b
+SET num_copy = (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status = 'available');
+
+ALTER TABLE books ALTER COLUMN num_copy DROP DEFAULT;
+
+ALTER TABLE borrowed_books DROP COLUMN IF EXISTS copy_id;
+DROP TABLE IF EXISTS book_copies;
+DROP FUNCTION IF EXISTS next_copy_barcode();
+DROP SEQUENCE IF EXISTS book_copy_barcode_seq;
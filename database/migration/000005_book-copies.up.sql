@@ -0,0 +1,48 @@
+-- Barcodes handed out to copies that are added without one
+CREATE SEQUENCE IF NOT EXISTS book_copy_barcode_seq;
+
+CREATE OR REPLACE FUNCTION next_copy_barcode() RETURNS TEXT AS $$
+    SELECT 'LMS' || lpad(nextval('book_copy_barcode_seq')::text, 8, '0');
+$$ LANGUAGE SQL;
+
+-- Individual physical copies of a book
+CREATE TABLE IF NOT EXISTS book_copies (
+    id SERIAL PRIMARY KEY,
+    book_id INT NOT NULL,
+    barcode VARCHAR(64) UNIQUE NOT NULL DEFAULT next_copy_barcode(),
+    -- status = available, on_loan, lost, damaged or retired
+    status VARCHAR(20) NOT NULL DEFAULT 'available',
+    -- condition = new, good, fair or poor
+    condition VARCHAR(20) NOT NULL DEFAULT 'good',
+    shelf_location VARCHAR(64) NOT NULL DEFAULT '',
+    acquired_at DATE NOT NULL DEFAULT CURRENT_DATE,
+    retired_at TIMESTAMP,
+    FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    CHECK (status IN ('available', 'on_loan', 'lost', 'damaged', 'retired')),
+    CHECK (condition IN ('new', 'good', 'fair', 'poor'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_copies_book_id_status ON book_copies (book_id, status);
+
+-- A loan is of one specific copy
+-- Loans returned before copies were tracked have no copy
+ALTER TABLE borrowed_books ADD COLUMN copy_id INT REFERENCES book_copies (id);
+
+-- Backfill: the counter held the copies on the shelf...
+INSERT INTO book_copies (book_id)
+SELECT b.id
+FROM books b, generate_series(1, b.num_copy);
+
+-- ...and every outstanding loan holds one more
+INSERT INTO book_copies (book_id, barcode, status)
+SELECT bb.book_id, 'LMS-L' || bb.id, 'on_loan'
+FROM borrowed_books bb
+WHERE bb.returned_at IS NULL;
+
+UPDATE borrowed_books bb
+SET copy_id = c.id
+FROM book_copies c
+WHERE c.barcode = 'LMS-L' || bb.id AND bb.returned_at IS NULL;
+
+-- Availability is now derived from the copies
+ALTER TABLE books DROP COLUMN num_copy;
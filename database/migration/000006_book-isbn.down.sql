@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_books_isbn;
+ALTER TABLE books DROP CONSTRAINT IF EXISTS books_isbn_format;
+ALTER TABLE books DROP COLUMN IF EXISTS isbn;
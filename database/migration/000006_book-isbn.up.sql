@@ -0,0 +1,6 @@
+-- ISBNs are stored normalized to ISBN-13, digits only
+ALTER TABLE books ADD COLUMN isbn VARCHAR(13);
+
+ALTER TABLE books ADD CONSTRAINT books_isbn_format CHECK (isbn ~ '^97[89][0-9]{10}$');
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_books_isbn ON books (isbn);
@@ -0,0 +1,25 @@
+-- Subject taxonomy: a tree of subjects, e.g. Fiction > Science Fiction > Cyberpunk
+CREATE TABLE IF NOT EXISTS subjects (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    -- NULL for a top level subject
+    parent_id INT,
+    FOREIGN KEY (parent_id) REFERENCES subjects (id),
+    CHECK (parent_id <> id)
+);
+
+-- Sibling subjects have distinct names
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subjects_parent_name ON subjects (COALESCE(parent_id, 0), lower(name));
+
+CREATE INDEX IF NOT EXISTS idx_subjects_parent_id ON subjects (parent_id);
+
+-- Book-Subject relationship: many to many
+CREATE TABLE IF NOT EXISTS book_subjects (
+    book_id INT NOT NULL,
+    subject_id INT NOT NULL,
+    PRIMARY KEY (book_id, subject_id),
+    FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    FOREIGN KEY (subject_id) REFERENCES subjects (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_subjects_subject_id ON book_subjects (subject_id);
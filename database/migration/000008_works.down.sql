@@ -0,0 +1,91 @@
+-- Every edition gets the authors and subjects of its work back
+CREATE TABLE IF NOT EXISTS book_authors (
+    book_id INT NOT NULL,
+    author_id INT NOT NULL,
+    PRIMARY KEY (book_id, author_id),
+    FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES authors (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_authors_author_id ON book_authors (author_id);
+
+INSERT INTO book_authors (book_id, author_id)
+SELECT b.id, wa.author_id
+FROM books b
+JOIN work_authors wa ON wa.work_id = b.work_id;
+
+CREATE TABLE IF NOT EXISTS book_subjects (
+    book_id INT NOT NULL,
+    subject_id INT NOT NULL,
+    PRIMARY KEY (book_id, subject_id),
+    FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    FOREIGN KEY (subject_id) REFERENCES subjects (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_subjects_subject_id ON book_subjects (subject_id);
+
+INSERT INTO book_subjects (book_id, subject_id)
+SELECT b.id, ws.subject_id
+FROM books b
+JOIN work_subjects ws ON ws.work_id = b.work_id;
+
+DROP TRIGGER IF EXISTS work_authors_search_refresh ON work_authors;
+DROP FUNCTION IF EXISTS work_authors_search_trigger();
+
+DROP TRIGGER IF EXISTS books_search_refresh ON books;
+CREATE TRIGGER books_search_refresh
+    AFTER INSERT OR UPDATE OF title, description ON books
+    FOR EACH ROW EXECUTE FUNCTION books_search_trigger();
+
+CREATE OR REPLACE FUNCTION refresh_book_search(p_book_id INT) RETURNS VOID AS $$
+BEGIN
+    INSERT INTO book_search (book_id, document)
+    SELECT b.id,
+           setweight(to_tsvector('english', b.title), 'A') ||
+           setweight(to_tsvector('english', coalesce(string_agg(a.name, ' '), '')), 'B') ||
+           setweight(to_tsvector('english', b.description), 'C')
+    FROM books b
+    LEFT JOIN book_authors ba ON ba.book_id = b.id
+    LEFT JOIN authors a ON a.id = ba.author_id
+    WHERE b.id = p_book_id
+    GROUP BY b.id
+    ON CONFLICT (book_id) DO UPDATE SET document = EXCLUDED.document;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION book_authors_search_trigger() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM refresh_book_search(OLD.book_id);
+    ELSE
+        PERFORM refresh_book_search(NEW.book_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION authors_search_trigger() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM refresh_book_search(ba.book_id)
+    FROM book_authors ba
+    WHERE ba.author_id = NEW.id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER book_authors_search_refresh
+    AFTER INSERT OR DELETE ON book_authors
+    FOR EACH ROW EXECUTE FUNCTION book_authors_search_trigger();
+
+DROP TABLE IF EXISTS work_subjects;
+DROP TABLE IF EXISTS work_authors;
+
+DROP INDEX IF EXISTS idx_books_work_id;
+ALTER TABLE books
+    DROP COLUMN IF EXISTS work_id,
+    DROP COLUMN IF EXISTS edition,
+    DROP COLUMN IF EXISTS publisher,
+    DROP COLUMN IF EXISTS published_year,
+    DROP COLUMN IF EXISTS language;
+
+DROP TABLE IF EXISTS works;
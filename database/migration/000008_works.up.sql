@@ -0,0 +1,122 @@
+-- A work is the abstract creation; books are its editions (hardcover,
+-- paperback, translations...). Editions share the authors and subjects of
+-- their work and each has its own copies.
+CREATE TABLE IF NOT EXISTS works (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+ALTER TABLE books
+    ADD COLUMN work_id INT REFERENCES works (id),
+    -- e.g. "Paperback", "2nd edition", "Translated by ..."
+    ADD COLUMN edition VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN publisher VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN published_year INT,
+    -- BCP 47 language tag, e.g. "en" or "pt-BR"
+    ADD COLUMN language VARCHAR(35) NOT NULL DEFAULT '';
+
+-- Every existing book becomes the only edition of its own work
+INSERT INTO works (id, title, description)
+SELECT id, title, description FROM books;
+
+SELECT setval(pg_get_serial_sequence('works', 'id'), COALESCE((SELECT max(id) FROM works), 0) + 1, false);
+
+UPDATE books SET work_id = id;
+
+ALTER TABLE books ALTER COLUMN work_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_books_work_id ON books (work_id);
+
+-- Work-Author relationship: many to many
+CREATE TABLE IF NOT EXISTS work_authors (
+    work_id INT NOT NULL,
+    author_id INT NOT NULL,
+    PRIMARY KEY (work_id, author_id),
+    FOREIGN KEY (work_id) REFERENCES works (id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES authors (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_work_authors_author_id ON work_authors (author_id);
+
+INSERT INTO work_authors (work_id, author_id)
+SELECT b.work_id, ba.author_id
+FROM book_authors ba
+JOIN books b ON b.id = ba.book_id
+ON CONFLICT DO NOTHING;
+
+-- Work-Subject relationship: many to many
+CREATE TABLE IF NOT EXISTS work_subjects (
+    work_id INT NOT NULL,
+    subject_id INT NOT NULL,
+    PRIMARY KEY (work_id, subject_id),
+    FOREIGN KEY (work_id) REFERENCES works (id) ON DELETE CASCADE,
+    FOREIGN KEY (subject_id) REFERENCES subjects (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_work_subjects_subject_id ON work_subjects (subject_id);
+
+INSERT INTO work_subjects (work_id, subject_id)
+SELECT b.work_id, bs.subject_id
+FROM book_subjects bs
+JOIN books b ON b.id = bs.book_id
+ON CONFLICT DO NOTHING;
+
+-- The search document now takes the author names from the work
+DROP TRIGGER IF EXISTS book_authors_search_refresh ON book_authors;
+DROP FUNCTION IF EXISTS book_authors_search_trigger();
+
+DROP TABLE IF EXISTS book_subjects;
+DROP TABLE IF EXISTS book_authors;
+
+CREATE OR REPLACE FUNCTION refresh_book_search(p_book_id INT) RETURNS VOID AS $$
+BEGIN
+    INSERT INTO book_search (book_id, document)
+    SELECT b.id,
+           setweight(to_tsvector('english', b.title), 'A') ||
+           setweight(to_tsvector('english', coalesce(string_agg(a.name, ' '), '')), 'B') ||
+           setweight(to_tsvector('english', b.description), 'C')
+    FROM books b
+    LEFT JOIN work_authors wa ON wa.work_id = b.work_id
+    LEFT JOIN authors a ON a.id = wa.author_id
+    WHERE b.id = p_book_id
+    GROUP BY b.id
+    ON CONFLICT (book_id) DO UPDATE SET document = EXCLUDED.document;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION work_authors_search_trigger() RETURNS TRIGGER AS $$
+DECLARE
+    v_work_id INT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        v_work_id := OLD.work_id;
+    ELSE
+        v_work_id := NEW.work_id;
+    END IF;
+    PERFORM refresh_book_search(b.id)
+    FROM books b
+    WHERE b.work_id = v_work_id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION authors_search_trigger() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM refresh_book_search(b.id)
+    FROM work_authors wa
+    JOIN books b ON b.work_id = wa.work_id
+    WHERE wa.author_id = NEW.id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- An edition moved to another work takes that work's authors
+DROP TRIGGER IF EXISTS books_search_refresh ON books;
+CREATE TRIGGER books_search_refresh
+    AFTER INSERT OR UPDATE OF title, description, work_id ON books
+    FOR EACH ROW EXECUTE FUNCTION books_search_trigger();
+
+CREATE TRIGGER work_authors_search_refresh
+    AFTER INSERT OR DELETE ON work_authors
+    FOR EACH ROW EXECUTE FUNCTION work_authors_search_trigger();
@@ -0,0 +1,4 @@
+-- Deleted books are archived: hidden from the catalog, loan history kept
+ALTER TABLE books ADD COLUMN archived_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_books_archived_at ON books (archived_at) WHERE archived_at IS NOT NULL;
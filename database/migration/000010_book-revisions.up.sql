@@ -0,0 +1,12 @@
+-- Every edit of a book's details, numbered per book from 1
+-- changes maps each changed field to {"old": ..., "new": ...}
+CREATE TABLE IF NOT EXISTS book_revisions (
+    id SERIAL PRIMARY KEY,
+    book_id INT NOT NULL,
+    revision INT NOT NULL,
+    changed_by VARCHAR(255) NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    changes JSONB NOT NULL,
+    UNIQUE (book_id, revision),
+    FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE
+);
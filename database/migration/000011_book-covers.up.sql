@@ -0,0 +1,3 @@
+-- Cover images live in blob storage; this is when the current one was
+-- uploaded, NULL when the book has no cover
+ALTER TABLE books ADD COLUMN cover_updated_at TIMESTAMP;
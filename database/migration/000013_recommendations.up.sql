@@ -0,0 +1,13 @@
+-- Item-to-item recommendations computed from loan history by the
+-- recommend job; the table is rebuilt on every run
+CREATE TABLE IF NOT EXISTS book_recommendations (
+    book_id INT NOT NULL,
+    recommended_book_id INT NOT NULL,
+    -- Co-borrowers divided by the geometric mean of both books' borrowers
+    score FLOAT8 NOT NULL,
+    co_borrowers INT NOT NULL,
+    computed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (book_id, recommended_book_id),
+    FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    FOREIGN KEY (recommended_book_id) REFERENCES books (id) ON DELETE CASCADE
+);
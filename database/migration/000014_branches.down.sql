@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS copy_transfers;
+
+ALTER TABLE borrowed_books DROP COLUMN IF EXISTS branch_id;
+
+-- Copies in transit stay where they were sent from
+UPDATE book_copies SET status = 'available' WHERE status = 'in_transit';
+ALTER TABLE book_copies DROP CONSTRAINT book_copies_status_check;
+ALTER TABLE book_copies ADD CONSTRAINT book_copies_status_check
+    CHECK (status IN ('available', 'on_loan', 'lost', 'damaged', 'retired'));
+
+DROP INDEX IF EXISTS idx_book_copies_branch_id_status;
+ALTER TABLE book_copies DROP COLUMN IF EXISTS branch_id;
+
+DROP FUNCTION IF EXISTS default_branch_id();
+DROP TABLE IF EXISTS branches;
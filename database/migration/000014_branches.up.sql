@@ -0,0 +1,53 @@
+-- Library branches; each copy is shelved at one of them
+CREATE TABLE IF NOT EXISTS branches (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(16) UNIQUE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    address TEXT NOT NULL DEFAULT ''
+);
+
+-- The existing collection belongs to the main branch
+INSERT INTO branches (code, name) VALUES ('MAIN', 'Main Branch');
+
+-- Copies added without a branch go to the first branch, the main one
+CREATE OR REPLACE FUNCTION default_branch_id() RETURNS INT AS $$
+    SELECT id FROM branches ORDER BY id LIMIT 1;
+$$ LANGUAGE SQL;
+
+ALTER TABLE book_copies ADD COLUMN branch_id INT NOT NULL DEFAULT default_branch_id() REFERENCES branches (id);
+
+CREATE INDEX IF NOT EXISTS idx_book_copies_branch_id_status ON book_copies (branch_id, status);
+
+-- Copies being moved between branches are in_transit
+ALTER TABLE book_copies DROP CONSTRAINT book_copies_status_check;
+ALTER TABLE book_copies ADD CONSTRAINT book_copies_status_check
+    CHECK (status IN ('available', 'on_loan', 'in_transit', 'lost', 'damaged', 'retired'));
+
+-- The branch a loan was made at, the branch of its copy for earlier loans
+ALTER TABLE borrowed_books ADD COLUMN branch_id INT REFERENCES branches (id);
+
+UPDATE borrowed_books bb
+SET branch_id = c.branch_id
+FROM book_copies c
+WHERE c.id = bb.copy_id;
+
+-- Moves of copies between branches
+CREATE TABLE IF NOT EXISTS copy_transfers (
+    id SERIAL PRIMARY KEY,
+    copy_id INT NOT NULL,
+    from_branch_id INT NOT NULL,
+    to_branch_id INT NOT NULL,
+    -- status = in_transit, received or cancelled
+    status VARCHAR(20) NOT NULL DEFAULT 'in_transit',
+    requested_by VARCHAR(255) NOT NULL DEFAULT '',
+    shipped_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP,
+    FOREIGN KEY (copy_id) REFERENCES book_copies (id) ON DELETE CASCADE,
+    FOREIGN KEY (from_branch_id) REFERENCES branches (id),
+    FOREIGN KEY (to_branch_id) REFERENCES branches (id),
+    CHECK (status IN ('in_transit', 'received', 'cancelled')),
+    CHECK (from_branch_id <> to_branch_id)
+);
+
+-- A copy is in at most one transfer at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_copy_transfers_in_transit ON copy_transfers (copy_id) WHERE status = 'in_transit';
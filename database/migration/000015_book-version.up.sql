@@ -0,0 +1,2 @@
+-- Optimistic concurrency: bumped by every change to a book, sent as its ETag
+ALTER TABLE books ADD COLUMN version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_borrowed_books_due_at;
+ALTER TABLE borrowed_books DROP COLUMN IF EXISTS due_at;
+
+DROP TABLE IF EXISTS loan_policies;
@@ -0,0 +1,24 @@
+-- Loan periods by user role, optionally for one book only. A loan gets the
+-- period of its book's policy for the borrower's role, else of the role's.
+CREATE TABLE IF NOT EXISTS loan_policies (
+    id SERIAL PRIMARY KEY,
+    role VARCHAR(10) NOT NULL,
+    book_id INT,
+    loan_days INT NOT NULL,
+    FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    CHECK (loan_days > 0)
+);
+
+-- One policy per role, and per role and book
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loan_policies_role_book ON loan_policies (role, COALESCE(book_id, 0));
+
+INSERT INTO loan_policies (role, loan_days) VALUES ('user', 14), ('admin', 28);
+
+-- Loans are due back at due_at; earlier loans get the default 14 days
+ALTER TABLE borrowed_books ADD COLUMN due_at TIMESTAMP;
+
+UPDATE borrowed_books SET due_at = borrowed_at + INTERVAL '14 days';
+
+ALTER TABLE borrowed_books ALTER COLUMN due_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_borrowed_books_due_at ON borrowed_books (due_at) WHERE returned_at IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE borrowed_books DROP COLUMN IF EXISTS renewals;
+
+ALTER TABLE loan_policies DROP COLUMN IF EXISTS max_renewals;
@@ -0,0 +1,8 @@
+-- How many times a loan may be renewed, by the same role and book rules as
+-- the loan period
+ALTER TABLE loan_policies ADD COLUMN max_renewals INT NOT NULL DEFAULT 2;
+
+ALTER TABLE loan_policies ADD CONSTRAINT loan_policies_max_renewals_check CHECK (max_renewals >= 0);
+
+-- How many times the loan was renewed
+ALTER TABLE borrowed_books ADD COLUMN renewals INT NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS holds;
+
+-- Copies set aside go back on the shelf
+UPDATE book_copies SET status = 'available' WHERE status = 'on_hold';
+ALTER TABLE book_copies DROP CONSTRAINT book_copies_status_check;
+ALTER TABLE book_copies ADD CONSTRAINT book_copies_status_check
+    CHECK (status IN ('available', 'on_loan', 'in_transit', 'lost', 'damaged', 'retired'));
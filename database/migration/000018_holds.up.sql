@@ -0,0 +1,29 @@
+-- Copies set aside for a patron's hold are on_hold
+ALTER TABLE book_copies DROP CONSTRAINT book_copies_status_check;
+ALTER TABLE book_copies ADD CONSTRAINT book_copies_status_check
+    CHECK (status IN ('available', 'on_loan', 'on_hold', 'in_transit', 'lost', 'damaged', 'retired'));
+
+-- Holds queue patrons for a book, first placed first served. A ready hold
+-- has a copy set aside until expires_at.
+CREATE TABLE IF NOT EXISTS holds (
+    id SERIAL PRIMARY KEY,
+    book_id INT NOT NULL,
+    user_id INT NOT NULL,
+    -- status = waiting, ready, fulfilled, cancelled or expired
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting',
+    copy_id INT,
+    placed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ready_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    closed_at TIMESTAMP,
+    FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (copy_id) REFERENCES book_copies (id),
+    CHECK (status IN ('waiting', 'ready', 'fulfilled', 'cancelled', 'expired'))
+);
+
+-- A patron holds a book at most once at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_holds_open ON holds (book_id, user_id) WHERE status IN ('waiting', 'ready');
+
+CREATE INDEX IF NOT EXISTS idx_holds_queue ON holds (book_id, placed_at, id) WHERE status = 'waiting';
+CREATE INDEX IF NOT EXISTS idx_holds_user_id ON holds (user_id);
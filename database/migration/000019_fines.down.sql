@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS account_transactions;
+DROP TABLE IF EXISTS fee_schedules;
@@ -0,0 +1,46 @@
+-- Overdue fines by user role. Loans are charged daily_fine_cents for each
+-- day overdue past the grace days, up to max_fine_cents a loan when set.
+-- Patrons owing more than block_balance_cents, when set, cannot borrow.
+CREATE TABLE IF NOT EXISTS fee_schedules (
+    id SERIAL PRIMARY KEY,
+    role VARCHAR(10) NOT NULL UNIQUE,
+    daily_fine_cents INT NOT NULL,
+    grace_days INT NOT NULL DEFAULT 0,
+    max_fine_cents INT,
+    block_balance_cents INT,
+    CHECK (daily_fine_cents >= 0),
+    CHECK (grace_days >= 0),
+    CHECK (max_fine_cents >= 0),
+    CHECK (block_balance_cents >= 0)
+);
+
+INSERT INTO fee_schedules (role, daily_fine_cents, grace_days, max_fine_cents, block_balance_cents)
+VALUES ('user', 25, 1, 1000, 1000), ('admin', 0, 0, NULL, NULL);
+
+-- The ledger of patron accounts. Each entry moves amount_cents from its
+-- credit account to its debit account: charges are owed by the patron
+-- (patron/fines), waivers and payments settle them (waived/patron and
+-- cash/patron). A patron's balance is what the patron account was debited
+-- less what it was credited.
+CREATE TABLE IF NOT EXISTS account_transactions (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    loan_id INT,
+    -- kind = charge, waiver or payment
+    kind VARCHAR(20) NOT NULL,
+    debit_account VARCHAR(20) NOT NULL,
+    credit_account VARCHAR(20) NOT NULL,
+    amount_cents INT NOT NULL,
+    memo TEXT NOT NULL DEFAULT '',
+    -- Email of the admin who recorded the entry, empty for fines
+    recorded_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (loan_id) REFERENCES borrowed_books (id) ON DELETE SET NULL,
+    CHECK (kind IN ('charge', 'waiver', 'payment')),
+    CHECK (debit_account <> credit_account),
+    CHECK (amount_cents > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_transactions_user_id ON account_transactions (user_id, id);
+CREATE INDEX IF NOT EXISTS idx_account_transactions_loan_id ON account_transactions (loan_id) WHERE kind = 'charge';
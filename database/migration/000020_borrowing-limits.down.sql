@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_borrowed_books_user_id_active;
+DROP TABLE IF EXISTS borrowing_limits;
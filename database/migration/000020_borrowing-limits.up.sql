@@ -0,0 +1,15 @@
+-- How much a patron of a role may have on loan at a time: max_loans books
+-- in all and max_copies_per_title copies of one book. Roles without limits
+-- may borrow any number.
+CREATE TABLE IF NOT EXISTS borrowing_limits (
+    id SERIAL PRIMARY KEY,
+    role VARCHAR(10) NOT NULL UNIQUE,
+    max_loans INT NOT NULL,
+    max_copies_per_title INT NOT NULL DEFAULT 1,
+    CHECK (max_loans > 0),
+    CHECK (max_copies_per_title > 0)
+);
+
+INSERT INTO borrowing_limits (role, max_loans, max_copies_per_title) VALUES ('user', 10, 3), ('admin', 50, 5);
+
+CREATE INDEX IF NOT EXISTS idx_borrowed_books_user_id_active ON borrowed_books (user_id, book_id) WHERE returned_at IS NULL;
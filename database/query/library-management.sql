@@ -1,67 +1,276 @@
--- Usecase: add a new book
+-- Usecase: add a new book, an edition of a work
 -- name: AddBook :one
-INSERT INTO books (title, description, num_copy) 
-VALUES ($1, $2, $3)
+INSERT INTO books (title, description, isbn, work_id, edition, publisher, published_year, language) 
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 RETURNING id;
 
+-- Usecase: works group the editions of the same book
+-- name: AddWork :one
+INSERT INTO works (title, description)
+VALUES ($1, $2)
+RETURNING id;
+
+-- name: GetWork :one
+SELECT id, title, description
+FROM works
+WHERE id = $1;
+
+-- name: UpdateWork :execrows
+UPDATE works
+SET title = $2, description = $3
+WHERE id = $1;
+
+-- name: ListWorks :many
+SELECT id, title, description
+FROM works w
+WHERE (sqlc.narg('title_prefix')::text IS NULL OR lower(w.title) LIKE lower(sqlc.narg('title_prefix')::text) || '%')
+  AND w.id > sqlc.arg('after_id')::int
+  AND EXISTS (SELECT 1 FROM books b WHERE b.work_id = w.id AND b.archived_at IS NULL)
+ORDER BY w.id
+LIMIT sqlc.arg('page_size')::int;
+
+-- name: ListEditionsByWorkIDs :many
+SELECT b.id, b.work_id, b.title, b.isbn, b.edition, b.publisher, b.published_year, b.language,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status = 'available')::int AS available_copies,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status <> 'retired')::int AS total_copies
+FROM books b
+WHERE b.work_id = ANY(sqlc.arg('work_ids')::int[])
+  AND b.archived_at IS NULL
+ORDER BY b.work_id, b.published_year NULLS LAST, b.id;
+
+-- Usecase: attach editions catalogued as separate works to one work
+-- Returns the works the editions were taken from
+-- name: MoveEditionsToWork :many
+WITH moved AS (
+    SELECT id, work_id
+    FROM books
+    WHERE id = ANY(sqlc.arg('book_ids')::int[])
+    FOR UPDATE
+)
+UPDATE books b
+SET work_id = sqlc.arg('work_id')::int
+FROM moved m
+WHERE b.id = m.id
+RETURNING m.work_id AS previous_work_id;
+
+-- name: CopyWorkAuthors :exec
+INSERT INTO work_authors (work_id, author_id)
+SELECT sqlc.arg('work_id')::int, author_id
+FROM work_authors
+WHERE work_id = ANY(sqlc.arg('source_ids')::int[])
+ON CONFLICT (work_id, author_id) DO NOTHING;
+
+-- name: CopyWorkSubjects :exec
+INSERT INTO work_subjects (work_id, subject_id)
+SELECT sqlc.arg('work_id')::int, subject_id
+FROM work_subjects
+WHERE work_id = ANY(sqlc.arg('source_ids')::int[])
+ON CONFLICT (work_id, subject_id) DO NOTHING;
+
+-- Works without editions left are removed with their authors and subjects
+-- name: DeleteEmptyWorks :exec
+DELETE FROM works w
+WHERE w.id = ANY(sqlc.arg('ids')::int[])
+  AND NOT EXISTS (SELECT 1 FROM books b WHERE b.work_id = w.id);
+
+-- name: AddBookCopies :exec
+INSERT INTO book_copies (book_id)
+SELECT sqlc.arg('book_id')::int
+FROM generate_series(1, sqlc.arg('copies')::int);
+
 -- name: AddAuthor :one
 INSERT INTO authors (name, bio) 
 VALUES ($1, $2)
 RETURNING id;
 
--- name: AddBookAuthor :exec
-INSERT INTO book_authors (book_id, author_id) 
-VALUES ($1, $2);
+-- name: AddWorkAuthor :exec
+INSERT INTO work_authors (work_id, author_id) 
+VALUES ($1, $2)
+ON CONFLICT (work_id, author_id) DO NOTHING;
+
+-- Usecase: reuse an author whose normalized name already exists
+-- An empty bio is filled in, an existing one is kept
+-- name: GetOrCreateAuthor :one
+INSERT INTO authors (name, bio)
+VALUES ($1, $2)
+ON CONFLICT ((author_name_key(name))) DO UPDATE
+SET bio = CASE WHEN authors.bio = '' THEN EXCLUDED.bio ELSE authors.bio END
+RETURNING id;
+
+-- name: GetAuthor :one
+SELECT id, name, bio
+FROM authors
+WHERE id = $1;
+
+-- Usecase: remove an author from a work and so from all of its editions
+-- name: RemoveWorkAuthor :execrows
+DELETE FROM work_authors
+WHERE work_id = $1 AND author_id = $2;
 
 -- Usercase: edit book details
--- name: EditBook :exec
+-- The version only moves when a field changes; a non-zero $9 must be the
+-- current version, otherwise no row is returned
+-- name: EditBook :one
+UPDATE books
+SET title = $2, description = $3, isbn = $4, edition = $5, publisher = $6, published_year = $7, language = $8,
+    version = version + CASE
+        WHEN (title, description, isbn, edition, publisher, published_year, language)
+             IS DISTINCT FROM ($2, $3, $4, $5, $6, $7, $8) THEN 1
+        ELSE 0
+    END
+WHERE id = $1 AND ($9::int = 0 OR version = $9::int)
+RETURNING version;
+
+-- Usecase: edit history, written in the same transaction as EditBook
+-- name: AddBookRevision :one
+INSERT INTO book_revisions (book_id, revision, changed_by, changes)
+SELECT sqlc.arg('book_id')::int, COALESCE(MAX(revision), 0) + 1, sqlc.arg('changed_by')::text, sqlc.arg('changes')::jsonb
+FROM book_revisions
+WHERE book_id = sqlc.arg('book_id')::int
+RETURNING id, book_id, revision, changed_by, changed_at, changes;
+
+-- name: ListBookRevisions :many
+SELECT id, book_id, revision, changed_by, changed_at, changes
+FROM book_revisions
+WHERE book_id = $1
+ORDER BY revision DESC;
+
+-- Usecase: a new cover image was stored
+-- name: SetBookCover :execrows
 UPDATE books
-SET title = $2, description = $3, num_copy = $4
+SET cover_updated_at = $2
 WHERE id = $1;
 
--- Usercase: delete a book
--- name: DeleteBook :exec
+-- Usercase: delete a book, it is archived rather than removed
+-- A non-zero $2 must be the current version
+-- name: ArchiveBook :execrows
+UPDATE books
+SET archived_at = CURRENT_TIMESTAMP, version = version + 1
+WHERE id = $1 AND archived_at IS NULL AND ($2::int = 0 OR version = $2::int);
+
+-- name: RestoreBook :execrows
+UPDATE books
+SET archived_at = NULL, version = version + 1
+WHERE id = $1 AND archived_at IS NOT NULL;
+
+-- Usecase: purge books archived before the given time
+-- name: ListArchivedBookIDs :many
+SELECT id
+FROM books
+WHERE archived_at < sqlc.arg('archived_before')::timestamp
+ORDER BY id;
+
+-- name: CountActiveLoansByBook :one
+SELECT count(*)
+FROM borrowed_books
+WHERE book_id = $1 AND returned_at IS NULL;
+
+-- name: DeleteBookLoans :exec
+DELETE FROM borrowed_books
+WHERE book_id = $1;
+
+-- Only archived books are ever deleted
+-- name: DeleteBook :execrows
 DELETE FROM books
-WHERE id = $1;
+WHERE id = $1 AND archived_at IS NOT NULL;
 
 -- Usercase: borrow a book
--- name: GetAvailableCopies :one
-SELECT num_copy 
-FROM books 
+-- Lock one available copy so concurrent borrowers get different copies
+-- A branch_id picks a copy shelved at that branch
+-- name: PickAvailableCopy :one
+SELECT id, branch_id
+FROM book_copies
+WHERE book_id = sqlc.arg('book_id')::int AND status = 'available'
+  AND (sqlc.narg('branch_id')::int IS NULL OR branch_id = sqlc.narg('branch_id')::int)
+  AND NOT EXISTS (SELECT 1 FROM books b WHERE b.id = sqlc.arg('book_id')::int AND b.archived_at IS NOT NULL)
+ORDER BY id
+LIMIT 1
+FOR UPDATE SKIP LOCKED;
+
+-- name: SetCopyStatus :exec
+UPDATE book_copies
+SET status = $2
 WHERE id = $1;
 
--- name: BorrowBook :exec
-UPDATE books 
-SET num_copy = num_copy - 1 
-WHERE id = $1 AND num_copy > 0;
+-- The most specific policy for the borrower's role sets the loan period
+-- and how often the loan may be renewed
+-- name: GetLoanTerms :one
+SELECT p.loan_days, p.max_renewals
+FROM loan_policies p
+JOIN users u ON u.role = p.role
+WHERE u.id = $1 AND (p.book_id = $2 OR p.book_id IS NULL)
+ORDER BY p.book_id NULLS LAST
+LIMIT 1;
 
--- name: InsertBorrowedBook :exec
-INSERT INTO borrowed_books (user_id, book_id) 
-VALUES ($1, $2);
+-- name: InsertBorrowedBook :one
+INSERT INTO borrowed_books (user_id, book_id, copy_id, branch_id, due_at) 
+VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + make_interval(days => $5::int))
+RETURNING id, user_id, book_id, borrowed_at, returned_at, copy_id, branch_id, due_at, renewals;
 
 -- Usercase: return a book
--- name: UpdateBookCopiesAddOne :exec
-UPDATE books 
-SET num_copy = num_copy + 1 
-WHERE id = $1;
+-- name: GetActiveLoan :one
+SELECT id, copy_id
+FROM borrowed_books
+WHERE user_id = $1 AND book_id = $2 AND returned_at IS NULL
+ORDER BY borrowed_at, id
+LIMIT 1
+FOR UPDATE;
+
+-- A copy returned at another branch is shelved there
+-- name: ShelveCopy :exec
+UPDATE book_copies
+SET status = 'available', branch_id = COALESCE(sqlc.narg('branch_id')::int, branch_id)
+WHERE id = sqlc.arg('id')::int;
 
 -- name: UpdateReturnedBook :exec
 UPDATE borrowed_books
 SET returned_at = CURRENT_TIMESTAMP
-WHERE user_id = $1 AND book_id = $2 AND returned_at IS NULL;
+WHERE id = $1;
 
 -- Usercase: get book with ID with their authors (So user can borrow)
--- name: GetBookWithAuthorsByID :one
-SELECT b.id, b.title, b.description, b.num_copy, a.name AS author_name 
+-- name: GetBook :one
+SELECT b.id, b.title, b.description, b.isbn, b.work_id, b.edition, b.publisher, b.published_year, b.language, b.archived_at,
+       b.cover_updated_at, b.version,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status = 'available')::int AS available_copies,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status <> 'retired')::int AS total_copies,
+       (SELECT count(*) FROM reviews r WHERE r.book_id = b.id AND r.hidden_at IS NULL)::int AS rating_count,
+       (SELECT COALESCE(avg(r.rating), 0) FROM reviews r WHERE r.book_id = b.id AND r.hidden_at IS NULL)::float8 AS rating_average
 FROM books b
-JOIN book_authors ba ON b.id = ba.book_id
-JOIN authors a ON ba.author_id = a.id
 WHERE b.id = $1;
 
+-- Locks the book so that an edit is diffed against the values it replaces
+-- name: LockBook :one
+SELECT id
+FROM books
+WHERE id = sqlc.arg('book_id')::int
+FOR UPDATE;
+
+-- Usecase: resolve a scanned or catalog ISBN to a book
+-- name: GetBookIDByISBN :one
+SELECT id
+FROM books
+WHERE isbn = $1;
+
+-- name: ListAuthorsByWorkID :many
+SELECT a.id, a.name, a.bio
+FROM authors a
+JOIN work_authors wa ON a.id = wa.author_id
+WHERE wa.work_id = $1
+ORDER BY a.id;
+
+-- name: ListAuthorsByWorkIDs :many
+SELECT wa.work_id, a.id, a.name, a.bio
+FROM work_authors wa
+JOIN authors a ON a.id = wa.author_id
+WHERE wa.work_id = ANY(sqlc.arg('work_ids')::int[])
+ORDER BY wa.work_id, a.id;
+
 -- name: ListBorrowedBooks :many
-SELECT b.id, b.title, b.description, bb.borrowed_at, bb.returned_at
+SELECT b.id, b.title, b.description, bb.borrowed_at, bb.returned_at, bb.copy_id, c.barcode, bb.due_at,
+       bb.id AS loan_id, bb.renewals
 FROM borrowed_books bb
 JOIN books b ON bb.book_id = b.id
+LEFT JOIN book_copies c ON bb.copy_id = c.id
 WHERE bb.user_id = $1 AND bb.returned_at IS NULL;
 
 -- name: GetUserByEmail :one
@@ -73,3 +282,666 @@ WHERE email = $1;
 INSERT INTO users (name, email, role, password_hash, nonce) 
 VALUES ($1, $2, $3, $4, $5)
 RETURNING id, name, email, role;
+
+-- Usecase: browse the catalog page by page
+-- Keyset pagination: cursor_id/cursor_title are taken from the last row of the previous page
+-- A branch_id counts, and filters on, the copies of that branch only
+-- name: ListBooks :many
+WITH RECURSIVE subtree AS (
+    SELECT s.id FROM subjects s WHERE s.id = sqlc.narg('subject_id')::int
+    UNION ALL
+    SELECT s.id FROM subjects s JOIN subtree t ON s.parent_id = t.id
+)
+SELECT b.id, b.title, b.description, b.work_id,
+       (SELECT count(*) FROM book_copies c
+        WHERE c.book_id = b.id AND c.status = 'available'
+          AND (sqlc.narg('branch_id')::int IS NULL OR c.branch_id = sqlc.narg('branch_id')::int))::int AS available_copies,
+       (SELECT count(*) FROM book_copies c
+        WHERE c.book_id = b.id AND c.status <> 'retired'
+          AND (sqlc.narg('branch_id')::int IS NULL OR c.branch_id = sqlc.narg('branch_id')::int))::int AS total_copies,
+       (SELECT count(*) FROM reviews r WHERE r.book_id = b.id AND r.hidden_at IS NULL)::int AS rating_count,
+       (SELECT COALESCE(avg(r.rating), 0) FROM reviews r WHERE r.book_id = b.id AND r.hidden_at IS NULL)::float8 AS rating_average
+FROM books b
+WHERE b.archived_at IS NULL
+  AND (sqlc.narg('author_id')::int IS NULL OR EXISTS (
+        SELECT 1 FROM work_authors wa
+        WHERE wa.work_id = b.work_id AND wa.author_id = sqlc.narg('author_id')::int))
+  AND (NOT sqlc.arg('available_only')::bool OR EXISTS (
+        SELECT 1 FROM book_copies c
+        WHERE c.book_id = b.id AND c.status = 'available'
+          AND (sqlc.narg('branch_id')::int IS NULL OR c.branch_id = sqlc.narg('branch_id')::int)))
+  AND (sqlc.narg('title_prefix')::text IS NULL OR lower(b.title) LIKE lower(sqlc.narg('title_prefix')::text) || '%')
+  AND (sqlc.narg('subject_id')::int IS NULL OR b.work_id IN (
+        SELECT ws.work_id FROM work_subjects ws JOIN subtree t ON t.id = ws.subject_id))
+  AND (sqlc.narg('cursor_id')::int IS NULL OR CASE sqlc.arg('sort_order')::text
+        WHEN '-id' THEN b.id < sqlc.narg('cursor_id')::int
+        WHEN 'title' THEN (b.title, b.id) > (sqlc.narg('cursor_title')::text, sqlc.narg('cursor_id')::int)
+        WHEN '-title' THEN (b.title, b.id) < (sqlc.narg('cursor_title')::text, sqlc.narg('cursor_id')::int)
+        ELSE b.id > sqlc.narg('cursor_id')::int
+      END)
+ORDER BY
+  CASE WHEN sqlc.arg('sort_order')::text = 'title' THEN b.title END ASC,
+  CASE WHEN sqlc.arg('sort_order')::text = '-title' THEN b.title END DESC,
+  CASE WHEN sqlc.arg('sort_order')::text IN ('-id', '-title') THEN b.id END DESC,
+  b.id ASC
+LIMIT sqlc.arg('page_size')::int;
+
+-- Usecase: full-text search over title, author names and description
+-- name: SearchBooks :many
+SELECT b.id, b.title, b.description,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status = 'available')::int AS available_copies,
+       ts_rank(s.document, websearch_to_tsquery('english', sqlc.arg('query')::text))::real AS rank,
+       ts_headline('english', b.title, websearch_to_tsquery('english', sqlc.arg('query')::text),
+           'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')::text AS title_highlight,
+       ts_headline('english', b.description, websearch_to_tsquery('english', sqlc.arg('query')::text),
+           'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10')::text AS snippet
+FROM book_search s
+JOIN books b ON b.id = s.book_id
+WHERE s.document @@ websearch_to_tsquery('english', sqlc.arg('query')::text)
+  AND b.archived_at IS NULL
+ORDER BY rank DESC, b.id
+LIMIT sqlc.arg('page_size')::int OFFSET sqlc.arg('page_offset')::int;
+
+-- Usecase: export the catalog, or the selected books, in ID order
+-- An empty ids array selects every book that is not archived
+-- name: ListBooksForExport :many
+SELECT id, title, description, isbn, work_id, edition, publisher, published_year, language, archived_at, cover_updated_at, version
+FROM books
+WHERE ((cardinality(sqlc.arg('ids')::int[]) = 0 AND archived_at IS NULL) OR id = ANY(sqlc.arg('ids')::int[]))
+  AND id > sqlc.arg('after_id')::int
+ORDER BY id
+LIMIT sqlc.arg('page_size')::int;
+
+-- Usecase: nightly catalog dump, read a page at a time
+-- name: ExportBooks :many
+SELECT b.id, b.title, b.description, b.isbn, b.work_id, b.edition, b.publisher, b.published_year, b.language,
+       COALESCE((SELECT string_agg(a.name, '; ' ORDER BY a.id)
+                 FROM work_authors wa
+                 JOIN authors a ON a.id = wa.author_id
+                 WHERE wa.work_id = b.work_id), '')::text AS authors,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status = 'available')::int AS available_copies,
+       (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND c.status <> 'retired')::int AS total_copies
+FROM books b
+WHERE b.archived_at IS NULL
+  AND b.id > sqlc.arg('after_id')::int
+ORDER BY b.id
+LIMIT sqlc.arg('page_size')::int;
+
+-- Usecase: nightly circulation dump, read a page at a time
+-- Loans borrowed or returned since the given time, or all of them
+-- name: ExportLoans :many
+SELECT bb.id, bb.user_id, bb.book_id, b.title, bb.copy_id, c.barcode, bb.borrowed_at, bb.returned_at
+FROM borrowed_books bb
+JOIN books b ON b.id = bb.book_id
+LEFT JOIN book_copies c ON c.id = bb.copy_id
+WHERE (sqlc.narg('since')::timestamp IS NULL
+       OR bb.borrowed_at >= sqlc.narg('since')::timestamp
+       OR bb.returned_at >= sqlc.narg('since')::timestamp)
+  AND bb.id > sqlc.arg('after_id')::int
+ORDER BY bb.id
+LIMIT sqlc.arg('page_size')::int;
+
+-- Usecase: author management
+-- name: ListAuthors :many
+SELECT id, name, bio
+FROM authors
+WHERE (sqlc.narg('name_prefix')::text IS NULL OR author_name_key(name) LIKE author_name_key(sqlc.narg('name_prefix')::text) || '%')
+  AND id > sqlc.arg('after_id')::int
+ORDER BY id
+LIMIT sqlc.arg('page_size')::int;
+
+-- name: UpdateAuthor :execrows
+UPDATE authors
+SET name = $2, bio = $3
+WHERE id = $1;
+
+-- name: CountWorksByAuthor :one
+SELECT count(*)
+FROM work_authors
+WHERE author_id = $1;
+
+-- name: DeleteAuthor :execrows
+DELETE FROM authors
+WHERE id = $1;
+
+-- Usecase: merge duplicate authors onto a canonical one
+-- name: MoveAuthorWorks :exec
+INSERT INTO work_authors (work_id, author_id)
+SELECT work_id, sqlc.arg('canonical_id')::int
+FROM work_authors
+WHERE author_id = ANY(sqlc.arg('duplicate_ids')::int[])
+ON CONFLICT (work_id, author_id) DO NOTHING;
+
+-- name: DeleteAuthors :execrows
+DELETE FROM authors
+WHERE id = ANY(sqlc.arg('ids')::int[]);
+
+-- Usecase: manage physical copies
+-- A copy added without a barcode gets a generated one
+-- name: AddBookCopy :one
+INSERT INTO book_copies (book_id, barcode, condition, shelf_location, acquired_at, branch_id)
+VALUES (
+    sqlc.arg('book_id')::int,
+    COALESCE(sqlc.narg('barcode')::text, next_copy_barcode()),
+    sqlc.arg('condition')::text,
+    sqlc.arg('shelf_location')::text,
+    COALESCE(sqlc.narg('acquired_at')::date, CURRENT_DATE),
+    COALESCE(sqlc.narg('branch_id')::int, default_branch_id())
+)
+RETURNING id, book_id, barcode, status, condition, shelf_location, acquired_at, retired_at, branch_id;
+
+-- name: GetBookCopy :one
+SELECT id, book_id, barcode, status, condition, shelf_location, acquired_at, retired_at, branch_id
+FROM book_copies
+WHERE id = $1;
+
+-- name: GetBookCopyForUpdate :one
+SELECT id, book_id, barcode, status, condition, shelf_location, acquired_at, retired_at, branch_id
+FROM book_copies
+WHERE id = $1
+FOR UPDATE;
+
+-- name: ListBookCopies :many
+SELECT id, book_id, barcode, status, condition, shelf_location, acquired_at, retired_at, branch_id
+FROM book_copies
+WHERE book_id = $1
+ORDER BY id;
+
+-- name: UpdateBookCopy :exec
+UPDATE book_copies
+SET status = $2, condition = $3, shelf_location = $4
+WHERE id = $1;
+
+-- name: RetireBookCopy :exec
+UPDATE book_copies
+SET status = 'retired', retired_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: GetCopyActiveLoan :one
+SELECT id, user_id, book_id, borrowed_at, returned_at, copy_id, branch_id, due_at, renewals
+FROM borrowed_books
+WHERE copy_id = $1 AND returned_at IS NULL;
+
+-- Usecase: subject taxonomy
+-- name: CreateSubject :one
+INSERT INTO subjects (name, parent_id)
+VALUES ($1, $2)
+RETURNING id, name, parent_id;
+
+-- name: GetSubject :one
+SELECT id, name, parent_id
+FROM subjects
+WHERE id = $1;
+
+-- name: ListSubjects :many
+SELECT id, name, parent_id
+FROM subjects
+ORDER BY id;
+
+-- name: UpdateSubject :execrows
+UPDATE subjects
+SET name = $2, parent_id = $3
+WHERE id = $1;
+
+-- Moving a subject under one of its own descendants would make a cycle
+-- name: IsSubjectInSubtree :one
+WITH RECURSIVE subtree AS (
+    SELECT s.id FROM subjects s WHERE s.id = sqlc.arg('root_id')::int
+    UNION ALL
+    SELECT s.id FROM subjects s JOIN subtree t ON s.parent_id = t.id
+)
+SELECT EXISTS (SELECT 1 FROM subtree WHERE id = sqlc.arg('subject_id')::int)::bool AS in_subtree;
+
+-- name: CountSubjectChildren :one
+SELECT count(*)
+FROM subjects
+WHERE parent_id = $1;
+
+-- name: CountWorksBySubject :one
+SELECT count(*)
+FROM work_subjects
+WHERE subject_id = $1;
+
+-- name: DeleteSubject :execrows
+DELETE FROM subjects
+WHERE id = $1;
+
+-- name: AddWorkSubject :exec
+INSERT INTO work_subjects (work_id, subject_id)
+VALUES ($1, $2)
+ON CONFLICT (work_id, subject_id) DO NOTHING;
+
+-- name: RemoveWorkSubject :execrows
+DELETE FROM work_subjects
+WHERE work_id = $1 AND subject_id = $2;
+
+-- name: ListSubjectsByWorkID :many
+SELECT s.id, s.name, s.parent_id
+FROM subjects s
+JOIN work_subjects ws ON s.id = ws.subject_id
+WHERE ws.work_id = $1
+ORDER BY s.id;
+
+-- Usecase: patron reviews
+-- name: HasBorrowedBook :one
+SELECT EXISTS (
+    SELECT 1 FROM borrowed_books
+    WHERE user_id = $1 AND book_id = $2
+)::bool AS borrowed;
+
+-- A patron reviewing a book again replaces the review; moderation stays
+-- name: UpsertReview :one
+INSERT INTO reviews (user_id, book_id, rating, body)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, book_id) DO UPDATE
+SET rating = EXCLUDED.rating, body = EXCLUDED.body, updated_at = CURRENT_TIMESTAMP
+RETURNING id, user_id, book_id, rating, body, hidden_at, hidden_reason, created_at, updated_at;
+
+-- name: DeleteReview :execrows
+DELETE FROM reviews
+WHERE user_id = $1 AND book_id = $2;
+
+-- Newest first; before_id is the ID of the last review of the previous page
+-- name: ListBookReviews :many
+SELECT r.id, r.user_id, COALESCE(u.name, '')::text AS user_name, r.rating, r.body, r.created_at, r.updated_at
+FROM reviews r
+JOIN users u ON u.id = r.user_id
+WHERE r.book_id = sqlc.arg('book_id')::int
+  AND r.hidden_at IS NULL
+  AND (sqlc.narg('before_id')::int IS NULL OR r.id < sqlc.narg('before_id')::int)
+ORDER BY r.id DESC
+LIMIT sqlc.arg('page_size')::int;
+
+-- Usecase: review moderation
+-- name: ListReviews :many
+SELECT id, user_id, book_id, rating, body, hidden_at, hidden_reason, created_at, updated_at
+FROM reviews
+WHERE (sqlc.narg('hidden')::bool IS NULL OR (hidden_at IS NOT NULL) = sqlc.narg('hidden')::bool)
+  AND (sqlc.narg('before_id')::int IS NULL OR id < sqlc.narg('before_id')::int)
+ORDER BY id DESC
+LIMIT sqlc.arg('page_size')::int;
+
+-- name: HideReview :execrows
+UPDATE reviews
+SET hidden_at = CURRENT_TIMESTAMP, hidden_reason = $2
+WHERE id = $1;
+
+-- name: UnhideReview :execrows
+UPDATE reviews
+SET hidden_at = NULL, hidden_reason = ''
+WHERE id = $1;
+
+-- Usecase: recommendations, see the recommend job
+-- name: ClearRecommendations :exec
+DELETE FROM book_recommendations;
+
+-- Scores every pair of books borrowed by the same patrons and keeps the
+-- per_book best of each book
+-- name: ComputeRecommendations :execrows
+WITH borrowers AS (
+    SELECT DISTINCT user_id, book_id FROM borrowed_books
+), counts AS (
+    SELECT book_id, count(*) AS n FROM borrowers GROUP BY book_id
+), pairs AS (
+    SELECT a.book_id, b.book_id AS recommended_book_id, count(*) AS co_borrowers
+    FROM borrowers a
+    JOIN borrowers b ON b.user_id = a.user_id AND b.book_id <> a.book_id
+    GROUP BY a.book_id, b.book_id
+    HAVING count(*) >= sqlc.arg('min_co_borrowers')::int
+), ranked AS (
+    SELECT p.book_id, p.recommended_book_id, p.co_borrowers,
+           p.co_borrowers / sqrt(ca.n * cb.n) AS score,
+           row_number() OVER (PARTITION BY p.book_id
+                              ORDER BY p.co_borrowers / sqrt(ca.n * cb.n) DESC, p.recommended_book_id) AS rank
+    FROM pairs p
+    JOIN counts ca ON ca.book_id = p.book_id
+    JOIN counts cb ON cb.book_id = p.recommended_book_id
+)
+INSERT INTO book_recommendations (book_id, recommended_book_id, score, co_borrowers)
+SELECT book_id, recommended_book_id, score, co_borrowers
+FROM ranked
+WHERE rank <= sqlc.arg('per_book')::int;
+
+-- Books the user, if any, has on loan are left out
+-- name: ListBookRecommendations :many
+SELECT b.id, b.title, r.score, r.co_borrowers
+FROM book_recommendations r
+JOIN books b ON b.id = r.recommended_book_id
+WHERE r.book_id = sqlc.arg('book_id')::int
+  AND b.archived_at IS NULL
+  AND NOT EXISTS (
+        SELECT 1 FROM borrowed_books bb
+        WHERE bb.user_id = sqlc.narg('user_id')::int AND bb.book_id = b.id AND bb.returned_at IS NULL)
+ORDER BY r.score DESC, b.id
+LIMIT sqlc.arg('page_size')::int;
+
+-- Recommendations of every book the user has borrowed, summed per book,
+-- less the books the user has ever borrowed
+-- name: ListUserRecommendations :many
+SELECT b.id, b.title, sum(r.score)::float8 AS score, sum(r.co_borrowers)::int AS co_borrowers
+FROM book_recommendations r
+JOIN books b ON b.id = r.recommended_book_id
+WHERE r.book_id IN (SELECT bb.book_id FROM borrowed_books bb WHERE bb.user_id = sqlc.arg('user_id')::int)
+  AND b.archived_at IS NULL
+  AND NOT EXISTS (
+        SELECT 1 FROM borrowed_books bb
+        WHERE bb.user_id = sqlc.arg('user_id')::int AND bb.book_id = b.id)
+GROUP BY b.id, b.title
+ORDER BY score DESC, b.id
+LIMIT sqlc.arg('page_size')::int;
+
+-- Usecase: branches
+-- name: AddBranch :one
+INSERT INTO branches (code, name, address)
+VALUES ($1, $2, $3)
+RETURNING id, code, name, address;
+
+-- name: GetBranch :one
+SELECT id, code, name, address
+FROM branches
+WHERE id = $1;
+
+-- name: ListBranches :many
+SELECT id, code, name, address
+FROM branches
+ORDER BY id;
+
+-- name: UpdateBranch :execrows
+UPDATE branches
+SET code = $2, name = $3, address = $4
+WHERE id = $1;
+
+-- Usecase: per-branch inventory of a book, every branch is listed
+-- name: ListBookBranchInventory :many
+SELECT br.id AS branch_id, br.code, br.name,
+       count(c.id) FILTER (WHERE c.status = 'available')::int AS available_copies,
+       count(c.id) FILTER (WHERE c.status = 'in_transit')::int AS in_transit_copies,
+       count(c.id) FILTER (WHERE c.status <> 'retired')::int AS total_copies
+FROM branches br
+LEFT JOIN book_copies c ON c.branch_id = br.id AND c.book_id = $1
+GROUP BY br.id
+ORDER BY br.id;
+
+-- Usecase: move copies between branches
+-- name: AddCopyTransfer :one
+INSERT INTO copy_transfers (copy_id, from_branch_id, to_branch_id, requested_by)
+VALUES ($1, $2, $3, $4)
+RETURNING id, copy_id, from_branch_id, to_branch_id, status, requested_by, shipped_at, completed_at;
+
+-- name: GetCopyTransferForUpdate :one
+SELECT id, copy_id, from_branch_id, to_branch_id, status, requested_by, shipped_at, completed_at
+FROM copy_transfers
+WHERE id = $1
+FOR UPDATE;
+
+-- name: CompleteCopyTransfer :one
+UPDATE copy_transfers
+SET status = $2, completed_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, copy_id, from_branch_id, to_branch_id, status, requested_by, shipped_at, completed_at;
+
+-- Transfers from or to a branch, oldest first
+-- name: ListCopyTransfers :many
+SELECT id, copy_id, from_branch_id, to_branch_id, status, requested_by, shipped_at, completed_at
+FROM copy_transfers
+WHERE (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status')::text)
+  AND (sqlc.narg('branch_id')::int IS NULL
+       OR from_branch_id = sqlc.narg('branch_id')::int OR to_branch_id = sqlc.narg('branch_id')::int)
+  AND id > sqlc.arg('after_id')::int
+ORDER BY id
+LIMIT sqlc.arg('page_size')::int;
+
+-- Usecase: loan policies
+-- name: ListLoanPolicies :many
+SELECT id, role, book_id, loan_days, max_renewals
+FROM loan_policies
+ORDER BY role, book_id NULLS FIRST;
+
+-- name: UpsertLoanPolicy :one
+INSERT INTO loan_policies (role, book_id, loan_days, max_renewals)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (role, COALESCE(book_id, 0)) DO UPDATE
+SET loan_days = EXCLUDED.loan_days, max_renewals = EXCLUDED.max_renewals
+RETURNING id, role, book_id, loan_days, max_renewals;
+
+-- name: DeleteLoanPolicy :execrows
+DELETE FROM loan_policies
+WHERE id = $1;
+
+-- name: GetLoanForUpdate :one
+SELECT id, user_id, book_id, returned_at, renewals, due_at < CURRENT_TIMESTAMP AS overdue
+FROM borrowed_books
+WHERE id = $1
+FOR UPDATE;
+
+-- Usecase: a renewed loan is due one loan period from now, never earlier
+-- than it was
+-- name: RenewLoan :one
+UPDATE borrowed_books
+SET due_at = GREATEST(due_at, CURRENT_TIMESTAMP + make_interval(days => $2::int)),
+    renewals = renewals + 1
+WHERE id = $1
+RETURNING id, user_id, book_id, borrowed_at, returned_at, copy_id, branch_id, due_at, renewals;
+
+-- Usecase: loans past their due date, most overdue first
+-- name: ListOverdueLoans :many
+SELECT bb.id, bb.book_id, b.title, bb.copy_id, c.barcode, bb.branch_id, bb.borrowed_at, bb.due_at,
+       (CURRENT_DATE - bb.due_at::date)::int AS days_overdue,
+       u.id AS user_id, u.name AS user_name, u.email AS user_email
+FROM borrowed_books bb
+JOIN books b ON b.id = bb.book_id
+JOIN users u ON u.id = bb.user_id
+LEFT JOIN book_copies c ON c.id = bb.copy_id
+WHERE bb.returned_at IS NULL AND bb.due_at < CURRENT_TIMESTAMP
+  AND (sqlc.narg('branch_id')::int IS NULL OR bb.branch_id = sqlc.narg('branch_id')::int)
+ORDER BY bb.due_at, bb.id
+LIMIT sqlc.arg('page_size')::int OFFSET sqlc.arg('page_offset')::int;
+
+-- Usecase: holds queue patrons for books
+-- name: AddHold :one
+INSERT INTO holds (book_id, user_id)
+VALUES ($1, $2)
+RETURNING id;
+
+-- name: GetHoldForUpdate :one
+SELECT id, book_id, user_id, status, copy_id, placed_at, ready_at, expires_at, closed_at
+FROM holds
+WHERE id = $1
+FOR UPDATE;
+
+-- The first hold placed is served first
+-- name: NextWaitingHold :one
+SELECT id, book_id, user_id, status, copy_id, placed_at, ready_at, expires_at, closed_at
+FROM holds
+WHERE book_id = $1 AND status = 'waiting'
+ORDER BY placed_at, id
+LIMIT 1
+FOR UPDATE;
+
+-- Usecase: a loan is not renewed while patrons wait for the book
+-- name: HasWaitingHolds :one
+SELECT EXISTS (
+    SELECT 1 FROM holds
+    WHERE book_id = $1 AND status = 'waiting'
+)::bool AS waiting;
+
+-- Usecase: a copy was set aside for the hold, to be picked up in time
+-- name: ReadyHold :exec
+UPDATE holds
+SET status = 'ready', copy_id = $2, ready_at = CURRENT_TIMESTAMP,
+    expires_at = CURRENT_TIMESTAMP + make_interval(days => $3::int)
+WHERE id = $1;
+
+-- name: GetReadyHoldForUpdate :one
+SELECT h.id, h.copy_id, c.branch_id
+FROM holds h
+JOIN book_copies c ON c.id = h.copy_id
+WHERE h.user_id = $1 AND h.book_id = $2 AND h.status = 'ready'
+FOR UPDATE OF h;
+
+-- name: CloseHold :exec
+UPDATE holds
+SET status = $2, closed_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- Usecase: ready holds not picked up in time expire and release their copy
+-- name: ExpireHolds :many
+UPDATE holds
+SET status = 'expired', closed_at = CURRENT_TIMESTAMP
+WHERE status = 'ready' AND expires_at < CURRENT_TIMESTAMP
+  AND (sqlc.narg('book_id')::int IS NULL OR book_id = sqlc.narg('book_id')::int)
+RETURNING id, book_id, copy_id;
+
+-- Open holds with their place in the queue, 0 once a copy is set aside
+-- name: ListHolds :many
+SELECT h.id, h.book_id, b.title, h.user_id, h.status, h.copy_id, c.branch_id,
+       h.placed_at, h.ready_at, h.expires_at,
+       CASE WHEN h.status = 'waiting' THEN (
+           SELECT count(*) FROM holds w
+           WHERE w.book_id = h.book_id AND w.status = 'waiting' AND (w.placed_at, w.id) <= (h.placed_at, h.id)
+       ) ELSE 0 END::int AS position
+FROM holds h
+JOIN books b ON b.id = h.book_id
+LEFT JOIN book_copies c ON c.id = h.copy_id
+WHERE h.status IN ('waiting', 'ready')
+  AND (sqlc.narg('id')::int IS NULL OR h.id = sqlc.narg('id')::int)
+  AND (sqlc.narg('user_id')::int IS NULL OR h.user_id = sqlc.narg('user_id')::int)
+  AND (sqlc.narg('book_id')::int IS NULL OR h.book_id = sqlc.narg('book_id')::int)
+ORDER BY h.placed_at, h.id;
+
+-- Usecase: overdue fines
+-- name: ListFeeSchedules :many
+SELECT id, role, daily_fine_cents, grace_days, max_fine_cents, block_balance_cents
+FROM fee_schedules
+ORDER BY role;
+
+-- name: UpsertFeeSchedule :one
+INSERT INTO fee_schedules (role, daily_fine_cents, grace_days, max_fine_cents, block_balance_cents)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (role) DO UPDATE
+SET daily_fine_cents = EXCLUDED.daily_fine_cents, grace_days = EXCLUDED.grace_days,
+    max_fine_cents = EXCLUDED.max_fine_cents, block_balance_cents = EXCLUDED.block_balance_cents
+RETURNING id, role, daily_fine_cents, grace_days, max_fine_cents, block_balance_cents;
+
+-- name: GetUserFeeSchedule :one
+SELECT f.id, f.role, f.daily_fine_cents, f.grace_days, f.max_fine_cents, f.block_balance_cents
+FROM fee_schedules f
+JOIN users u ON u.role = f.role
+WHERE u.id = $1;
+
+-- Locks the loans AccrueFines charges, first ID first, so that accruals
+-- running at the same time charge each loan once. It runs as a statement of
+-- its own, before AccrueFines, for AccrueFines to see the charges made by
+-- the accrual it waited for.
+-- name: LockOverdueLoans :exec
+SELECT bb.id
+FROM borrowed_books bb
+WHERE bb.due_at < COALESCE(bb.returned_at, CURRENT_TIMESTAMP)
+  AND (sqlc.narg('user_id')::int IS NULL OR bb.user_id = sqlc.narg('user_id')::int)
+ORDER BY bb.id
+FOR UPDATE;
+
+-- Charges each loan kept past its due date what its fine comes to by now,
+-- less what it was charged before, so that running it daily charges one
+-- day at a time. The fine of a returned loan stops growing.
+-- name: AccrueFines :execrows
+WITH fines AS (
+    SELECT bb.id AS loan_id, bb.user_id,
+           LEAST(f.max_fine_cents, f.daily_fine_cents * GREATEST(
+               (COALESCE(bb.returned_at, CURRENT_TIMESTAMP)::date - bb.due_at::date) - f.grace_days, 0)) AS fine
+    FROM borrowed_books bb
+    JOIN users u ON u.id = bb.user_id
+    JOIN fee_schedules f ON f.role = u.role
+    WHERE bb.due_at < COALESCE(bb.returned_at, CURRENT_TIMESTAMP)
+      AND (sqlc.narg('user_id')::int IS NULL OR bb.user_id = sqlc.narg('user_id')::int)
+), charged AS (
+    SELECT t.loan_id, SUM(t.amount_cents) AS amount
+    FROM account_transactions t
+    WHERE t.kind = 'charge' AND t.loan_id IN (SELECT loan_id FROM fines)
+    GROUP BY t.loan_id
+)
+INSERT INTO account_transactions (user_id, loan_id, kind, debit_account, credit_account, amount_cents, memo)
+SELECT fines.user_id, fines.loan_id, 'charge', 'patron', 'fines', fines.fine - COALESCE(charged.amount, 0), 'Overdue fine'
+FROM fines
+LEFT JOIN charged ON charged.loan_id = fines.loan_id
+WHERE fines.fine > COALESCE(charged.amount, 0);
+
+-- name: GetAccountBalance :one
+SELECT COALESCE(SUM(CASE WHEN debit_account = 'patron' THEN amount_cents ELSE -amount_cents END), 0)::int AS balance
+FROM account_transactions
+WHERE user_id = $1 AND 'patron' IN (debit_account, credit_account);
+
+-- name: AddAccountTransaction :one
+INSERT INTO account_transactions (user_id, loan_id, kind, debit_account, credit_account, amount_cents, memo, recorded_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, user_id, loan_id, kind, debit_account, credit_account, amount_cents, memo, recorded_by, created_at;
+
+-- Newest first
+-- name: ListAccountTransactions :many
+SELECT id, user_id, loan_id, kind, debit_account, credit_account, amount_cents, memo, recorded_by, created_at
+FROM account_transactions
+WHERE user_id = sqlc.arg('user_id')::int
+  AND (sqlc.arg('before_id')::int = 0 OR id < sqlc.arg('before_id')::int)
+ORDER BY id DESC
+LIMIT sqlc.arg('page_size')::int;
+
+-- name: GetUser :one
+SELECT id, email, name, role, password_hash, nonce
+FROM users
+WHERE id = $1;
+
+-- Usecase: borrowing limits
+-- name: ListBorrowingLimits :many
+SELECT id, role, max_loans, max_copies_per_title
+FROM borrowing_limits
+ORDER BY role;
+
+-- name: UpsertBorrowingLimit :one
+INSERT INTO borrowing_limits (role, max_loans, max_copies_per_title)
+VALUES ($1, $2, $3)
+ON CONFLICT (role) DO UPDATE
+SET max_loans = EXCLUDED.max_loans, max_copies_per_title = EXCLUDED.max_copies_per_title
+RETURNING id, role, max_loans, max_copies_per_title;
+
+-- name: GetUserBorrowingLimit :one
+SELECT l.id, l.role, l.max_loans, l.max_copies_per_title
+FROM borrowing_limits l
+JOIN users u ON u.role = l.role
+WHERE u.id = $1;
+
+-- Locks the user so that their borrows are checked against their limits one
+-- at a time
+-- name: LockUser :one
+SELECT id
+FROM users
+WHERE id = sqlc.arg('user_id')::int
+FOR UPDATE;
+
+-- title_loans counts the loans of every edition of the book's work
+-- name: CountActiveLoans :one
+SELECT count(*)::int AS loans,
+       count(*) FILTER (WHERE b.work_id = (SELECT work_id FROM books WHERE id = sqlc.arg('book_id')::int))::int AS title_loans
+FROM borrowed_books bb
+JOIN books b ON b.id = bb.book_id
+WHERE bb.user_id = sqlc.arg('user_id')::int AND bb.returned_at IS NULL;
+
+-- Usecase: loan history, newest first
+-- status = active, returned or overdue (active past its due date)
+-- name: ListLoans :many
+SELECT bb.id, bb.user_id, u.name AS user_name, bb.book_id, b.title, bb.copy_id, c.barcode, bb.branch_id,
+       bb.borrowed_at, bb.due_at, bb.returned_at, bb.renewals
+FROM borrowed_books bb
+JOIN books b ON b.id = bb.book_id
+JOIN users u ON u.id = bb.user_id
+LEFT JOIN book_copies c ON c.id = bb.copy_id
+WHERE (sqlc.narg('user_id')::int IS NULL OR bb.user_id = sqlc.narg('user_id')::int)
+  AND (sqlc.narg('book_id')::int IS NULL OR bb.book_id = sqlc.narg('book_id')::int)
+  AND (sqlc.narg('status')::text IS NULL
+       OR (sqlc.narg('status')::text = 'active' AND bb.returned_at IS NULL)
+       OR (sqlc.narg('status')::text = 'returned' AND bb.returned_at IS NOT NULL)
+       OR (sqlc.narg('status')::text = 'overdue' AND bb.returned_at IS NULL AND bb.due_at < CURRENT_TIMESTAMP))
+  AND (sqlc.narg('borrowed_from')::timestamp IS NULL OR bb.borrowed_at >= sqlc.narg('borrowed_from')::timestamp)
+  AND (sqlc.narg('borrowed_before')::timestamp IS NULL OR bb.borrowed_at < sqlc.narg('borrowed_before')::timestamp)
+  AND (sqlc.arg('before_id')::int = 0 OR bb.id < sqlc.arg('before_id')::int)
+ORDER BY bb.id DESC
+LIMIT sqlc.arg('page_size')::int;
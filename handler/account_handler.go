@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"app/database/db"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/julienschmidt/httprouter"
+)
+
+type SettlementRequest struct {
+	AmountCents int32 `json:"amount_cents"`
+	// LoanID ties a waiver to one loan, optional
+	LoanID int32  `json:"loan_id"`
+	Memo   string `json:"memo"`
+}
+
+type FeeScheduleRequest struct {
+	Role           string `json:"role"`
+	DailyFineCents int32  `json:"daily_fine_cents"`
+	GraceDays      int32  `json:"grace_days"`
+	// MaxFineCents caps the fine of a loan, no cap when null
+	MaxFineCents *int32 `json:"max_fine_cents"`
+	// BlockBalanceCents is the most a patron may owe and still borrow, no
+	// limit when null
+	BlockBalanceCents *int32 `json:"block_balance_cents"`
+}
+
+func optionalInt4(v *int32) pgtype.Int4 {
+	if v == nil {
+		return pgtype.Int4{}
+	}
+	return pgtype.Int4{Int32: *v, Valid: true}
+}
+
+// MyAccountHandler shows the fines balance of the caller and their account
+// transactions, newest first.
+// Query parameters: cursor, limit.
+func MyAccountHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		limit, ok := limitParam(w, r)
+		if !ok {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		user, err := authenticatedUser(r, dbc)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		account, err := dbc.GetAccount(r.Context(), user.ID, r.URL.Query().Get("cursor"), limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching account: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(account)
+	}
+}
+
+// GetUserAccountHandler shows the fines balance of a user and their account
+// transactions, newest first.
+// Query parameters: cursor, limit.
+func GetUserAccountHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		userID, err := strconv.Atoi(ps.ByName("user_id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		limit, ok := limitParam(w, r)
+		if !ok {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		account, err := dbc.GetAccount(r.Context(), int32(userID), r.URL.Query().Get("cursor"), limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching account: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(account)
+	}
+}
+
+// WaiveFineHandler lets a user off some of the fines they owe.
+func WaiveFineHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		userID, err := strconv.Atoi(ps.ByName("user_id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var req SettlementRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		waiver, err := dbc.WaiveFine(r.Context(), requestEmail(r), int32(userID), req.LoanID, req.AmountCents, req.Memo)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error waiving fine: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(waiver)
+	}
+}
+
+// RecordPaymentHandler records a payment a user made towards their fines.
+func RecordPaymentHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		userID, err := strconv.Atoi(ps.ByName("user_id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var req SettlementRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if req.LoanID != 0 {
+			http.Error(w, "Payments are not tied to a loan", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		payment, err := dbc.RecordPayment(r.Context(), requestEmail(r), int32(userID), req.AmountCents, req.Memo)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error recording payment: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(payment)
+	}
+}
+
+// ListFeeSchedulesHandler lists the overdue fines by role.
+func ListFeeSchedulesHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		schedules, err := dbc.ListFeeSchedules(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching fee schedules: %v", err), errorStatus(err))
+			return
+		}
+		if schedules == nil {
+			schedules = []db.FeeSchedule{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schedules)
+	}
+}
+
+// SetFeeScheduleHandler sets the overdue fines of a role.
+func SetFeeScheduleHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		var req FeeScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		schedule, err := dbc.SetFeeSchedule(r.Context(), db.UpsertFeeScheduleParams{
+			Role:              req.Role,
+			DailyFineCents:    req.DailyFineCents,
+			GraceDays:         req.GraceDays,
+			MaxFineCents:      optionalInt4(req.MaxFineCents),
+			BlockBalanceCents: optionalInt4(req.BlockBalanceCents),
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error setting fee schedule: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schedule)
+	}
+}
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"app/database/db"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type AuthorPayload struct {
+	Name string `json:"name"`
+	Bio  string `json:"bio"`
+}
+
+type MergeAuthorsRequest struct {
+	DuplicateIDs []int32 `json:"duplicate_ids"`
+}
+
+// AuthorPage is one page of the author listing.
+type AuthorPage struct {
+	Authors    []db.Author `json:"authors"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// CreateAuthorHandler adds a new author.
+func CreateAuthorHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		var req AuthorPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Author name is required", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		author, err := dbc.CreateAuthor(r.Context(), req.Name, req.Bio)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error creating author: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(author)
+	}
+}
+
+// ListAuthorsHandler lists authors ordered by ID.
+// Query parameters: name_prefix, cursor, limit.
+func ListAuthorsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		query := r.URL.Query()
+		var limit int
+		if v := query.Get("limit"); v != "" {
+			var err error
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		authors, next, err := dbc.ListAuthors(r.Context(), query.Get("name_prefix"), query.Get("cursor"), int32(limit))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching authors: %v", err), errorStatus(err))
+			return
+		}
+		if authors == nil {
+			authors = []db.Author{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AuthorPage{Authors: authors, NextCursor: next})
+	}
+}
+
+// GetAuthorHandler retrieves an author by ID.
+func GetAuthorHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		authorID, err := strconv.Atoi(ps.ByName("author_id"))
+		if err != nil {
+			http.Error(w, "Invalid author ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		author, err := dbc.GetAuthor(r.Context(), int32(authorID))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching author: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(author)
+	}
+}
+
+// UpdateAuthorHandler updates the name and bio of an author.
+func UpdateAuthorHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		authorID, err := strconv.Atoi(ps.ByName("author_id"))
+		if err != nil {
+			http.Error(w, "Invalid author ID", http.StatusBadRequest)
+			return
+		}
+
+		var req AuthorPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Author name is required", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		err = dbc.UpdateAuthor(r.Context(), db.Author{ID: int32(authorID), Name: req.Name, Bio: req.Bio})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error updating author: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Author updated successfully")
+	}
+}
+
+// DeleteAuthorHandler deletes an author that has no books.
+func DeleteAuthorHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		authorID, err := strconv.Atoi(ps.ByName("author_id"))
+		if err != nil {
+			http.Error(w, "Invalid author ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.DeleteAuthor(r.Context(), int32(authorID)); err != nil {
+			http.Error(w, fmt.Sprintf("Error deleting author: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Author deleted successfully")
+	}
+}
+
+// MergeAuthorsHandler merges duplicate authors into the author in the path.
+func MergeAuthorsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		authorID, err := strconv.Atoi(ps.ByName("author_id"))
+		if err != nil {
+			http.Error(w, "Invalid author ID", http.StatusBadRequest)
+			return
+		}
+
+		var req MergeAuthorsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if len(req.DuplicateIDs) == 0 {
+			http.Error(w, "At least one duplicate author is required", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.MergeAuthors(r.Context(), int32(authorID), req.DuplicateIDs); err != nil {
+			http.Error(w, fmt.Sprintf("Error merging authors: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Authors merged successfully")
+	}
+}
+
+// ListAuthorBooksHandler lists the books of an author.
+// It accepts the same query parameters as ListBooksHandler.
+func ListAuthorBooksHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		authorID, err := strconv.Atoi(ps.ByName("author_id"))
+		if err != nil {
+			http.Error(w, "Invalid author ID", http.StatusBadRequest)
+			return
+		}
+
+		opts, err := parseListBooksOptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.AuthorID = int32(authorID)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := dbc.GetAuthor(r.Context(), opts.AuthorID); err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching author: %v", err), errorStatus(err))
+			return
+		}
+
+		books, next, err := dbc.ListBooks(r.Context(), opts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching books: %v", err), errorStatus(err))
+			return
+		}
+		if books == nil {
+			books = []db.ListBooksRow{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BookPage{Books: books, NextCursor: next})
+	}
+}
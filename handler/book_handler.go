@@ -4,14 +4,17 @@ import (
 	"app/database/adaptor"
 	"app/database/db"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"runtime/debug"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/julienschmidt/httprouter"
 	"golang.org/x/time/rate"
 )
@@ -24,9 +27,67 @@ var mu sync.Mutex
 type AddBookRequest struct {
 	Title       string `json:"title"`
 	Description string `json:"description"`
-	Copies      int32  `json:"copies"`
-	Author      string `json:"author"`
-	AuthorBio   string `json:"author_bio"`
+	// ISBN is an ISBN-10 or ISBN-13, hyphens allowed; it is stored as ISBN-13
+	ISBN string `json:"isbn"`
+	// WorkID makes the book a new edition of an existing work, which already
+	// has authors. Without it the book starts a work of its own.
+	WorkID        int32           `json:"work_id"`
+	Edition       string          `json:"edition"`
+	Publisher     string          `json:"publisher"`
+	PublishedYear int32           `json:"published_year"`
+	Language      string          `json:"language"`
+	Copies        int32           `json:"copies"`
+	Authors       []AuthorRequest `json:"authors"`
+	// Deprecated: single author form, use Authors.
+	Author    string `json:"author"`
+	AuthorBio string `json:"author_bio"`
+}
+
+// AuthorRequest references an existing author by ID or describes a new one.
+type AuthorRequest struct {
+	ID   int32  `json:"id"`
+	Name string `json:"name"`
+	Bio  string `json:"bio"`
+}
+
+// UpdateBookRequest holds the details of a book, i.e. of one edition.
+// The work it belongs to is changed through the work's editions.
+type UpdateBookRequest struct {
+	Title         string `json:"title"`
+	Description   string `json:"description"`
+	ISBN          string `json:"isbn"`
+	Edition       string `json:"edition"`
+	Publisher     string `json:"publisher"`
+	PublishedYear int32  `json:"published_year"`
+	Language      string `json:"language"`
+}
+
+type BookAuthorsRequest struct {
+	Authors []AuthorRequest `json:"authors"`
+}
+
+// toAuthors validates the author references of a request.
+func toAuthors(reqs []AuthorRequest) ([]db.Author, error) {
+	authors := make([]db.Author, 0, len(reqs))
+	for i, a := range reqs {
+		if a.ID <= 0 && strings.TrimSpace(a.Name) == "" {
+			return nil, fmt.Errorf("author %d: either id or name is required", i)
+		}
+		authors = append(authors, db.Author{ID: a.ID, Name: strings.TrimSpace(a.Name), Bio: a.Bio})
+	}
+	return authors, nil
+}
+
+// BookPage is one page of the catalog listing.
+type BookPage struct {
+	Books      []db.ListBooksRow `json:"books"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// SearchPage is one page of full-text search results, best match first.
+type SearchPage struct {
+	Results    []db.SearchBooksRow `json:"results"`
+	NextOffset int32               `json:"next_offset,omitempty"`
 }
 
 // NewServer creates a new HTTP server
@@ -40,19 +101,6 @@ func NewServer(port int, router http.Handler) *http.Server {
 	return &server
 }
 
-// PanicHandler prints the stack trace and returns the error status.
-func panicHandler(w http.ResponseWriter, r *http.Request, err interface{}) {
-	debug.PrintStack()
-	w.WriteHeader(http.StatusInternalServerError)
-}
-
-// NewRouter creates a new router
-func NewRouter() *httprouter.Router {
-	router := httprouter.New()
-	router.PanicHandler = panicHandler
-	return router
-}
-
 // AddANewBookHandler handles the creation of a new book.
 func AddANewBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
@@ -67,20 +115,56 @@ func AddANewBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter
 			return
 		}
 
-		if err := dbc.CreateBook(
+		authorReqs := addBookReq.Authors
+		if addBookReq.Author != "" {
+			authorReqs = append(authorReqs, AuthorRequest{Name: addBookReq.Author, Bio: addBookReq.AuthorBio})
+		}
+		authors, err := toAuthors(authorReqs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(authors) == 0 && addBookReq.WorkID == 0 {
+			http.Error(w, "At least one author is required", http.StatusBadRequest)
+			return
+		}
+		if addBookReq.WorkID < 0 || addBookReq.PublishedYear < 0 {
+			http.Error(w, "work_id and published_year must not be negative", http.StatusBadRequest)
+			return
+		}
+
+		bookID, err := dbc.CreateBook(
 			r.Context(),
-			db.AddBookParams{Title: addBookReq.Title, Description: addBookReq.Description, NumCopy: addBookReq.Copies},
-			db.Author{Name: addBookReq.Author, Bio: addBookReq.AuthorBio}); err != nil {
-			http.Error(w, fmt.Sprintf("Error creating book: %v", err), http.StatusInternalServerError)
+			db.AddBookParams{
+				Title:         addBookReq.Title,
+				Description:   addBookReq.Description,
+				Isbn:          pgtype.Text{String: addBookReq.ISBN, Valid: addBookReq.ISBN != ""},
+				WorkID:        addBookReq.WorkID,
+				Edition:       addBookReq.Edition,
+				Publisher:     addBookReq.Publisher,
+				PublishedYear: pgtype.Int4{Int32: addBookReq.PublishedYear, Valid: addBookReq.PublishedYear > 0},
+				Language:      addBookReq.Language,
+			},
+			addBookReq.Copies,
+			authors)
+		if errors.Is(err, adaptor.ErrNotFound) {
+			// An author or work referenced by ID does not exist
+			http.Error(w, fmt.Sprintf("Error creating book: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error creating book: %v", err), errorStatus(err))
 			return
 		}
 
+		w.Header().Set("Location", fmt.Sprintf("/books/%d", bookID))
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode("Book created successfully")
 	}
 }
 
-// UpdateBookHandler updates the details of a book.
+// UpdateBookHandler updates the details of a book. If-Match must carry the
+// ETag of the book; the response carries the new one.
 func UpdateBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		if !limiter.Allow() {
@@ -88,31 +172,53 @@ func UpdateBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.
 			return
 		}
 
-		bookID, err := strconv.Atoi(ps.ByName("id"))
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
 		if err != nil {
 			http.Error(w, "Invalid book ID", http.StatusBadRequest)
 			return
 		}
 
-		var book db.EditBookParams
-		if err := json.NewDecoder(r.Body).Decode(&book); err != nil {
+		var req UpdateBookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request payload", http.StatusBadRequest)
 			return
 		}
-		book.ID = int32(bookID)
+		if req.PublishedYear < 0 {
+			http.Error(w, "published_year must not be negative", http.StatusBadRequest)
+			return
+		}
+		book := db.EditBookParams{
+			ID:            int32(bookID),
+			Title:         req.Title,
+			Description:   req.Description,
+			Isbn:          pgtype.Text{String: req.ISBN, Valid: req.ISBN != ""},
+			Edition:       req.Edition,
+			Publisher:     req.Publisher,
+			PublishedYear: pgtype.Int4{Int32: req.PublishedYear, Valid: req.PublishedYear > 0},
+			Language:      req.Language,
+		}
 
 		mu.Lock()
 		defer mu.Unlock()
-		if err := dbc.UpdateBook(r.Context(), book); err != nil {
-			http.Error(w, fmt.Sprintf("Error updating book: %v", err), http.StatusInternalServerError)
+		var ok bool
+		if book.Version, ok = ifMatchVersion(w, r, dbc, book.ID); !ok {
+			return
+		}
+		version, err := dbc.UpdateBook(r.Context(), requestEmail(r), book)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error updating book: %v", err), errorStatus(err))
 			return
 		}
 
+		w.Header().Set("ETag", bookETag(version))
 		json.NewEncoder(w).Encode("Book updated successfully")
 	}
 }
 
-// BorrowBookHandler handles borrowing a book.
+// BorrowBookHandler handles borrowing a book and responds with the loan,
+// which tells when the book is due back. A patron who may not borrow gets a
+// 403 ErrorResponse with the code of adaptor.BorrowError.
+// Query parameters: branch_id, the branch the copy is lent from.
 func BorrowBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		if !limiter.Allow() {
@@ -132,18 +238,99 @@ func BorrowBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.
 			return
 		}
 
+		branchID, err := branchParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		loan, err := dbc.BorrowBook(r.Context(), int32(userID), int32(bookID), branchID)
+		var refused *adaptor.BorrowError
+		if errors.As(err, &refused) {
+			errorWithCode(w, refused.Code, fmt.Sprintf("Error borrowing book: %v", err), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error borrowing book: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(loan)
+	}
+}
+
+// AddBookAuthorsHandler links one or more authors to an existing book.
+func AddBookAuthorsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		var req BookAuthorsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		authors, err := toAuthors(req.Authors)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.AddBookAuthors(r.Context(), int32(bookID), authors); err != nil {
+			http.Error(w, fmt.Sprintf("Error adding authors: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Authors added successfully")
+	}
+}
+
+// RemoveBookAuthorHandler unlinks an author from a book.
+func RemoveBookAuthorHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		authorID, err := strconv.Atoi(ps.ByName("author_id"))
+		if err != nil {
+			http.Error(w, "Invalid author ID", http.StatusBadRequest)
+			return
+		}
+
 		mu.Lock()
 		defer mu.Unlock()
-		if err := dbc.BorrowBook(r.Context(), int32(userID), int32(bookID)); err != nil {
-			http.Error(w, fmt.Sprintf("Error borrowing book: %v", err), http.StatusInternalServerError)
+		if err := dbc.RemoveBookAuthor(r.Context(), int32(bookID), int32(authorID)); err != nil {
+			http.Error(w, fmt.Sprintf("Error removing author: %v", err), errorStatus(err))
 			return
 		}
 
-		json.NewEncoder(w).Encode("Book borrowed successfully")
+		json.NewEncoder(w).Encode("Author removed successfully")
 	}
 }
 
-// DeleteBookHandler deletes a book by ID.
+// DeleteBookHandler archives a book by ID, see RestoreBookHandler. If-Match
+// must carry the ETag of the book.
 func DeleteBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		if !limiter.Allow() {
@@ -151,7 +338,36 @@ func DeleteBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.
 			return
 		}
 
-		bookID, err := strconv.Atoi(ps.ByName("id"))
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		version, ok := ifMatchVersion(w, r, dbc, int32(bookID))
+		if !ok {
+			return
+		}
+		if err := dbc.DeleteBook(r.Context(), int32(bookID), version); err != nil {
+			http.Error(w, fmt.Sprintf("Error deleting book: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Book archived successfully")
+	}
+}
+
+// RestoreBookHandler brings an archived book back into the catalog.
+func RestoreBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
 		if err != nil {
 			http.Error(w, "Invalid book ID", http.StatusBadRequest)
 			return
@@ -159,16 +375,17 @@ func DeleteBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.
 
 		mu.Lock()
 		defer mu.Unlock()
-		if err := dbc.DeleteBook(r.Context(), int32(bookID)); err != nil {
-			http.Error(w, fmt.Sprintf("Error deleting book: %v", err), http.StatusInternalServerError)
+		if err := dbc.RestoreBook(r.Context(), int32(bookID)); err != nil {
+			http.Error(w, fmt.Sprintf("Error restoring book: %v", err), errorStatus(err))
 			return
 		}
 
-		json.NewEncoder(w).Encode("Book deleted successfully")
+		json.NewEncoder(w).Encode("Book restored successfully")
 	}
 }
 
 // ReturnBookHandler handles returning a borrowed book.
+// Query parameters: branch_id, the branch the copy is returned to.
 func ReturnBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		if !limiter.Allow() {
@@ -188,10 +405,16 @@ func ReturnBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.
 			return
 		}
 
+		branchID, err := branchParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		mu.Lock()
 		defer mu.Unlock()
-		if err := dbc.ReturnBook(r.Context(), int32(userID), int32(bookID)); err != nil {
-			http.Error(w, fmt.Sprintf("Error returning book: %v", err), http.StatusInternalServerError)
+		if err := dbc.ReturnBook(r.Context(), int32(userID), int32(bookID), branchID); err != nil {
+			http.Error(w, fmt.Sprintf("Error returning book: %v", err), errorStatus(err))
 			return
 		}
 
@@ -217,15 +440,70 @@ func GetBooksByIDHandler(dbc *adaptor.PostgresClient, log *log.Logger) httproute
 		defer mu.Unlock()
 		books, err := dbc.GetBookByID(r.Context(), int32(bookID))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error fetching books: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Error fetching books: %v", err), errorStatus(err))
 			return
 		}
 
+		// The ETag tracks the record, not the copy counts or ratings, so it
+		// is for If-Match on changes rather than for caching
+		w.Header().Set("ETag", bookETag(books.Version))
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(books)
 	}
 }
 
+// bookETag is the entity tag of a version of a book.
+func bookETag(version int32) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatchVersion checks the If-Match header of a change to a book against
+// its current ETag and returns the version the change is made against. It
+// writes the error response, 428 without If-Match and 412 for a stale
+// ETag, when the change must not go ahead. The caller holds mu.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request, dbc *adaptor.PostgresClient, bookID int32) (int32, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		http.Error(w, "If-Match header is required", http.StatusPreconditionRequired)
+		return 0, false
+	}
+
+	book, err := dbc.GetBookByID(r.Context(), bookID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching book: %v", err), errorStatus(err))
+		return 0, false
+	}
+
+	etag := bookETag(book.Version)
+	if !strongETagMatch(ifMatch, etag) {
+		w.Header().Set("ETag", etag)
+		http.Error(w, "The book has changed since it was read", http.StatusPreconditionFailed)
+		return 0, false
+	}
+	return book.Version, true
+}
+
+// GetBookByISBNHandler resolves an ISBN-10 or ISBN-13 to a book.
+func GetBookByISBNHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		book, err := dbc.GetBookByISBN(r.Context(), ps.ByName("isbn"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching book: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(book)
+	}
+}
+
 func ViewBorrowedBooksHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		if !limiter.Allow() {
@@ -251,3 +529,166 @@ func ViewBorrowedBooksHandler(dbc *adaptor.PostgresClient, log *log.Logger) http
 		json.NewEncoder(w).Encode(books)
 	}
 }
+
+// ListBooksHandler lists the catalog with cursor-based pagination.
+// Query parameters: author_id, subject_id, available, branch_id, title_prefix, sort, cursor, limit.
+// With branch_id the copy counts, and the available filter, cover that branch only.
+func ListBooksHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		opts, err := parseListBooksOptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		books, next, err := dbc.ListBooks(r.Context(), opts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching books: %v", err), errorStatus(err))
+			return
+		}
+
+		if books == nil {
+			books = []db.ListBooksRow{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BookPage{Books: books, NextCursor: next})
+	}
+}
+
+// parseListBooksOptions reads the catalog filters from the query string.
+func parseListBooksOptions(query url.Values) (adaptor.ListBooksOptions, error) {
+	opts := adaptor.ListBooksOptions{
+		TitlePrefix: query.Get("title_prefix"),
+		Sort:        query.Get("sort"),
+		Cursor:      query.Get("cursor"),
+	}
+
+	if v := query.Get("author_id"); v != "" {
+		authorID, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New("Invalid author ID")
+		}
+		opts.AuthorID = int32(authorID)
+	}
+
+	if v := query.Get("subject_id"); v != "" {
+		subjectID, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New("Invalid subject ID")
+		}
+		opts.SubjectID = int32(subjectID)
+	}
+
+	if v := query.Get("available"); v != "" {
+		available, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, errors.New("Invalid available flag")
+		}
+		opts.AvailableOnly = available
+	}
+
+	if v := query.Get("branch_id"); v != "" {
+		branchID, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New("Invalid branch ID")
+		}
+		opts.BranchID = int32(branchID)
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return opts, errors.New("Invalid limit")
+		}
+		opts.Limit = int32(limit)
+	}
+	return opts, nil
+}
+
+// errorStatus maps errors returned by the database adaptor onto HTTP status codes.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, adaptor.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, adaptor.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, adaptor.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, adaptor.ErrConflict), errors.Is(err, adaptor.ErrNotAvailable):
+		return http.StatusConflict
+	case errors.Is(err, adaptor.ErrInvalidInput), errors.Is(err, adaptor.ErrInvalidCursor), errors.Is(err, adaptor.ErrInvalidSort):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ErrorResponse is the body of errors that carry a machine-readable code.
+type ErrorResponse struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// errorWithCode replies like http.Error, with an ErrorResponse as JSON.
+func errorWithCode(w http.ResponseWriter, code string, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Code: code, Error: message})
+}
+
+// SearchBooksHandler runs a full-text search over the catalog.
+// Query parameters: q (required), limit, offset.
+func SearchBooksHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		query := r.URL.Query()
+		q := strings.TrimSpace(query.Get("q"))
+		if q == "" {
+			http.Error(w, "Missing search query", http.StatusBadRequest)
+			return
+		}
+
+		var limit, offset int
+		var err error
+		if v := query.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("offset"); v != "" {
+			if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		results, next, err := dbc.SearchBooks(r.Context(), q, int32(limit), int32(offset))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error searching books: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if results == nil {
+			results = []db.SearchBooksRow{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SearchPage{Results: results, NextOffset: next})
+	}
+}
@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"app/database/db"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type BranchPayload struct {
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+type TransferRequest struct {
+	CopyIDs    []int32 `json:"copy_ids"`
+	ToBranchID int32   `json:"to_branch_id"`
+}
+
+// TransferPage is one page of the transfer listing.
+type TransferPage struct {
+	Transfers  []db.CopyTransfer `json:"transfers"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// branchParam reads the optional branch_id query parameter; zero means any
+// branch.
+func branchParam(r *http.Request) (int32, error) {
+	v := r.URL.Query().Get("branch_id")
+	if v == "" {
+		return 0, nil
+	}
+	branchID, err := strconv.Atoi(v)
+	if err != nil || branchID <= 0 {
+		return 0, errors.New("Invalid branch ID")
+	}
+	return int32(branchID), nil
+}
+
+// ListBranchesHandler lists the branches of the library.
+func ListBranchesHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		branches, err := dbc.ListBranches(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching branches: %v", err), errorStatus(err))
+			return
+		}
+		if branches == nil {
+			branches = []db.Branch{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(branches)
+	}
+}
+
+// AddBranchHandler opens a new branch.
+func AddBranchHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		var req BranchPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		branch, err := dbc.AddBranch(r.Context(), db.AddBranchParams{
+			Code:    strings.TrimSpace(req.Code),
+			Name:    strings.TrimSpace(req.Name),
+			Address: req.Address,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error adding branch: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(branch)
+	}
+}
+
+// UpdateBranchHandler changes the code, name and address of a branch.
+func UpdateBranchHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		branchID, err := strconv.Atoi(ps.ByName("branch_id"))
+		if err != nil {
+			http.Error(w, "Invalid branch ID", http.StatusBadRequest)
+			return
+		}
+
+		var req BranchPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		err = dbc.UpdateBranch(r.Context(), db.UpdateBranchParams{
+			ID:      int32(branchID),
+			Code:    strings.TrimSpace(req.Code),
+			Name:    strings.TrimSpace(req.Name),
+			Address: req.Address,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error updating branch: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Branch updated successfully")
+	}
+}
+
+// TransferCopiesHandler sends copies to another branch. They stay in transit
+// until the transfer is received or cancelled.
+func TransferCopiesHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		var req TransferRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		transfers, err := dbc.TransferCopies(r.Context(), requestEmail(r), uniqueIDs(req.CopyIDs), req.ToBranchID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error transferring copies: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(transfers)
+	}
+}
+
+// ListTransfersHandler lists transfers, oldest first.
+// Query parameters: status, branch_id, cursor, limit.
+func ListTransfersHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		branchID, err := branchParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		var limit int
+		if v := query.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		transfers, next, err := dbc.ListTransfers(r.Context(), query.Get("status"), branchID, query.Get("cursor"), int32(limit))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching transfers: %v", err), errorStatus(err))
+			return
+		}
+		if transfers == nil {
+			transfers = []db.CopyTransfer{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TransferPage{Transfers: transfers, NextCursor: next})
+	}
+}
+
+// ReceiveTransferHandler shelves a copy in transit at its destination.
+func ReceiveTransferHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		transferID, err := strconv.Atoi(ps.ByName("transfer_id"))
+		if err != nil {
+			http.Error(w, "Invalid transfer ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		transfer, err := dbc.ReceiveTransfer(r.Context(), int32(transferID))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error receiving transfer: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(transfer)
+	}
+}
+
+// CancelTransferHandler puts a copy in transit back at the branch it was
+// sent from.
+func CancelTransferHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		transferID, err := strconv.Atoi(ps.ByName("transfer_id"))
+		if err != nil {
+			http.Error(w, "Invalid transfer ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		transfer, err := dbc.CancelTransfer(r.Context(), int32(transferID))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error cancelling transfer: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(transfer)
+	}
+}
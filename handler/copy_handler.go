@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"app/database/db"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/julienschmidt/httprouter"
+)
+
+type AddCopyRequest struct {
+	Barcode       string `json:"barcode"`
+	Condition     string `json:"condition"`
+	ShelfLocation string `json:"shelf_location"`
+	// AcquiredAt is a date in the form 2006-01-02
+	AcquiredAt string `json:"acquired_at"`
+	// BranchID is the branch the copy is shelved at, the main branch by default
+	BranchID int32 `json:"branch_id"`
+}
+
+type UpdateCopyRequest struct {
+	Status        string `json:"status"`
+	Condition     string `json:"condition"`
+	ShelfLocation string `json:"shelf_location"`
+}
+
+// AddBookCopyHandler adds a physical copy of a book.
+func AddBookCopyHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		var req AddCopyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		params := db.AddBookCopyParams{
+			BookID:        int32(bookID),
+			Condition:     req.Condition,
+			ShelfLocation: req.ShelfLocation,
+		}
+		if req.BranchID != 0 {
+			params.BranchID = pgtype.Int4{Int32: req.BranchID, Valid: true}
+		}
+		if req.Barcode != "" {
+			params.Barcode = pgtype.Text{String: req.Barcode, Valid: true}
+		}
+		if req.AcquiredAt != "" {
+			acquiredAt, err := time.Parse(time.DateOnly, req.AcquiredAt)
+			if err != nil {
+				http.Error(w, "Invalid acquired_at date", http.StatusBadRequest)
+				return
+			}
+			params.AcquiredAt = pgtype.Date{Time: acquiredAt, Valid: true}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		copy, err := dbc.AddBookCopy(r.Context(), params)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error adding copy: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(copy)
+	}
+}
+
+// ListBookCopiesHandler lists every copy of a book, retired ones included.
+func ListBookCopiesHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		copies, err := dbc.ListBookCopies(r.Context(), int32(bookID))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching copies: %v", err), errorStatus(err))
+			return
+		}
+		if copies == nil {
+			copies = []db.BookCopy{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(copies)
+	}
+}
+
+// GetBookCopyHandler shows a copy and who holds it.
+func GetBookCopyHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		copyID, err := strconv.Atoi(ps.ByName("copy_id"))
+		if err != nil {
+			http.Error(w, "Invalid copy ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		copy, err := dbc.GetBookCopy(r.Context(), int32(copyID))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching copy: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(copy)
+	}
+}
+
+// UpdateBookCopyHandler updates the status, condition and shelf location of a copy.
+func UpdateBookCopyHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		copyID, err := strconv.Atoi(ps.ByName("copy_id"))
+		if err != nil {
+			http.Error(w, "Invalid copy ID", http.StatusBadRequest)
+			return
+		}
+
+		var req UpdateCopyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		err = dbc.UpdateBookCopy(r.Context(), db.UpdateBookCopyParams{
+			ID:            int32(copyID),
+			Status:        req.Status,
+			Condition:     req.Condition,
+			ShelfLocation: req.ShelfLocation,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error updating copy: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Copy updated successfully")
+	}
+}
+
+// RetireBookCopyHandler takes a copy out of circulation.
+func RetireBookCopyHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		copyID, err := strconv.Atoi(ps.ByName("copy_id"))
+		if err != nil {
+			http.Error(w, "Invalid copy ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.RetireBookCopy(r.Context(), int32(copyID)); err != nil {
+			http.Error(w, fmt.Sprintf("Error retiring copy: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Copy retired successfully")
+	}
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"app/blob"
+	"app/cover"
+	"app/database/adaptor"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/time/rate"
+)
+
+// coverLimiter limits cover downloads apart from the API: a catalog page
+// loads a cover per book, and anonymous clients should not use up the
+// limit of the API.
+var coverLimiter = rate.NewLimiter(50, 100) // 50 requests per second, burst of 100
+
+// coverMaxAge is how long clients may use a cover without revalidating it.
+const coverMaxAge = time.Hour
+
+// coverKey is the blob key of a cover thumbnail.
+func coverKey(bookID int, size string) string {
+	return fmt.Sprintf("covers/%d/%s.jpg", bookID, size)
+}
+
+// UploadCoverHandler stores the cover image of a book, sent as the "cover"
+// field of a multipart form, and renders its thumbnails.
+func UploadCoverHandler(dbc *adaptor.PostgresClient, covers blob.Store, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		// Leave room for the multipart headers
+		r.Body = http.MaxBytesReader(w, r.Body, cover.MaxSize+64<<10)
+		file, _, err := r.FormFile("cover")
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, cover.ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "A multipart form with a cover file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		img, err := cover.Decode(file)
+		switch {
+		case errors.Is(err, cover.ErrTooLarge):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		case errors.Is(err, cover.ErrUnsupportedType):
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		case err != nil:
+			http.Error(w, "Error reading cover", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		_, err = dbc.GetBookByID(r.Context(), int32(bookID))
+		mu.Unlock()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching book: %v", err), errorStatus(err))
+			return
+		}
+
+		src := cover.Flatten(img)
+		for _, size := range cover.Sizes {
+			var buf bytes.Buffer
+			if err := cover.Encode(&buf, cover.Thumbnail(src, size.MaxSide)); err != nil {
+				http.Error(w, fmt.Sprintf("Error rendering cover: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if err := covers.Put(r.Context(), coverKey(bookID, size.Name), &buf); err != nil {
+				log.Printf("storing cover of book %d failed: %v", bookID, err)
+				http.Error(w, "Error storing cover", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.SetBookCover(r.Context(), int32(bookID), time.Now().UTC()); err != nil {
+			http.Error(w, fmt.Sprintf("Error updating book: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/books/%d/cover", bookID))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode("Cover uploaded successfully")
+	}
+}
+
+// GetCoverHandler serves a cover thumbnail of a book. The size query
+// parameter is small, medium or large. Responses carry an ETag and
+// Last-Modified so clients can revalidate cheaply after coverMaxAge.
+func GetCoverHandler(dbc *adaptor.PostgresClient, covers blob.Store, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !coverLimiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		sizeName := r.URL.Query().Get("size")
+		if sizeName == "" {
+			sizeName = cover.DefaultSize
+		}
+		size, ok := cover.LookupSize(sizeName)
+		if !ok {
+			http.Error(w, "Invalid size, use small, medium or large", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		book, err := dbc.GetBookByID(r.Context(), int32(bookID))
+		mu.Unlock()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching book: %v", err), errorStatus(err))
+			return
+		}
+		if !book.CoverUpdatedAt.Valid {
+			http.Error(w, "Book has no cover", http.StatusNotFound)
+			return
+		}
+
+		updated := book.CoverUpdatedAt.Time
+		etag := fmt.Sprintf(`"%d-%s-%d"`, bookID, size.Name, updated.UnixMicro())
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(coverMaxAge.Seconds())))
+
+		if notModified(r, etag, updated) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		image, info, err := covers.Get(r.Context(), coverKey(bookID, size.Name))
+		if errors.Is(err, blob.ErrNotFound) {
+			http.Error(w, "Book has no cover", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("reading cover of book %d failed: %v", bookID, err)
+			http.Error(w, "Error reading cover", http.StatusInternalServerError)
+			return
+		}
+		defer image.Close()
+
+		w.Header().Set("Content-Type", cover.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		io.Copy(w, image)
+	}
+}
+
+// notModified evaluates the conditional headers of a GET. If-None-Match
+// takes precedence over If-Modified-Since.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, etag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// etagMatch reports whether a list of entity tags, as sent in
+// If-None-Match, contains etag or is "*". Weak tags match their strong
+// form.
+func etagMatch(list string, etag string) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// strongETagMatch reports whether a list of entity tags, as sent in
+// If-Match, contains the strong etag or is "*". Weak tags never match, a
+// change must not be made against a weakly matching version.
+func strongETagMatch(list string, etag string) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || (tag == etag && !strings.HasPrefix(tag, "W/")) {
+			return true
+		}
+	}
+	return false
+}
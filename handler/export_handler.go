@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Export formats, chosen with ?format= or the Accept header
+const (
+	exportCSV    = "csv"
+	exportJSON   = "json"
+	exportNDJSON = "ndjson"
+)
+
+var exportContentTypes = map[string]string{
+	exportCSV:    "text/csv; charset=utf-8",
+	exportJSON:   "application/json",
+	exportNDJSON: "application/x-ndjson",
+}
+
+// exportFormat picks the export format of a request. JSON is the default.
+func exportFormat(r *http.Request) (string, bool) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		_, ok := exportContentTypes[format]
+		return format, ok
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return exportJSON, true
+	}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.Split(mediaRange, ";")[0])
+		switch mediaType {
+		case "text/csv":
+			return exportCSV, true
+		case "application/x-ndjson", "application/jsonl":
+			return exportNDJSON, true
+		case "application/json", "application/*", "*/*":
+			return exportJSON, true
+		}
+	}
+	return "", false
+}
+
+// tableWriter writes rows as CSV, a JSON array or NDJSON. Nothing is sent
+// before the first row, so an error up to then can still get a status code.
+type tableWriter struct {
+	w       http.ResponseWriter
+	format  string
+	header  []string
+	csv     *csv.Writer
+	started bool
+	rows    int
+}
+
+func newTableWriter(w http.ResponseWriter, format string, header []string) *tableWriter {
+	return &tableWriter{w: w, format: format, header: header}
+}
+
+func (t *tableWriter) start() error {
+	if t.started {
+		return nil
+	}
+	t.started = true
+	t.w.Header().Set("Content-Type", exportContentTypes[t.format])
+
+	switch t.format {
+	case exportCSV:
+		t.csv = csv.NewWriter(t.w)
+		return t.csv.Write(t.header)
+	case exportJSON:
+		_, err := io.WriteString(t.w, "[\n")
+		return err
+	}
+	return nil
+}
+
+// Write writes one row: v for the JSON formats, record for CSV.
+func (t *tableWriter) Write(v interface{}, record func() []string) error {
+	if err := t.start(); err != nil {
+		return err
+	}
+	t.rows++
+
+	if t.format == exportCSV {
+		return t.csv.Write(record())
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if t.format == exportJSON && t.rows > 1 {
+		data = append([]byte(",\n"), data...)
+	}
+	_, err = t.w.Write(append(data, '\n'))
+	return err
+}
+
+// Close ends the output.
+func (t *tableWriter) Close() error {
+	if err := t.start(); err != nil {
+		return err
+	}
+	switch t.format {
+	case exportCSV:
+		t.csv.Flush()
+		return t.csv.Error()
+	case exportJSON:
+		_, err := io.WriteString(t.w, "]\n")
+		return err
+	}
+	return nil
+}
+
+func formatInt4(v pgtype.Int4) string {
+	if !v.Valid {
+		return ""
+	}
+	return strconv.Itoa(int(v.Int32))
+}
+
+func formatTimestamp(v pgtype.Timestamp) string {
+	if !v.Valid {
+		return ""
+	}
+	return v.Time.Format(time.RFC3339)
+}
+
+// exportBatchTimeout is how long a batch of an export has to be written.
+// The deadline moves with each batch, so the server write timeout does not
+// cut a long export short.
+const exportBatchTimeout = 60 * time.Second
+
+func extendWriteDeadline(w http.ResponseWriter) {
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(exportBatchTimeout))
+}
+
+// ExportBooksHandler streams the whole catalog as CSV, JSON or NDJSON, a
+// page of books at a time. The database is free between pages.
+func ExportBooksHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		format, ok := exportFormat(r)
+		if !ok {
+			http.Error(w, "Unsupported format, use csv, json or ndjson", http.StatusNotAcceptable)
+			return
+		}
+
+		out := newTableWriter(w, format, []string{
+			"id", "title", "description", "isbn", "work_id", "edition", "publisher", "published_year",
+			"language", "authors", "available_copies", "total_copies",
+		})
+
+		var afterID int32
+		for {
+			extendWriteDeadline(w)
+			mu.Lock()
+			books, err := dbc.ExportBooks(r.Context(), afterID, exportPageSize)
+			mu.Unlock()
+			if err != nil {
+				if !out.started {
+					http.Error(w, fmt.Sprintf("Error exporting books: %v", err), http.StatusInternalServerError)
+					return
+				}
+				// Too late for a status code, the output ends unterminated
+				log.Printf("book export stopped after %d rows: %v", out.rows, err)
+				return
+			}
+			if len(books) == 0 {
+				break
+			}
+
+			for _, book := range books {
+				err := out.Write(book, func() []string {
+					return []string{
+						strconv.Itoa(int(book.ID)),
+						book.Title,
+						book.Description,
+						book.Isbn.String,
+						strconv.Itoa(int(book.WorkID)),
+						book.Edition,
+						book.Publisher,
+						formatInt4(book.PublishedYear),
+						book.Language,
+						book.Authors,
+						strconv.Itoa(int(book.AvailableCopies)),
+						strconv.Itoa(int(book.TotalCopies)),
+					}
+				})
+				if err != nil {
+					log.Printf("book export stopped after %d rows: %v", out.rows, err)
+					return
+				}
+			}
+			afterID = books[len(books)-1].ID
+		}
+		out.Close()
+	}
+}
+
+// ExportLoansHandler streams loans as CSV, JSON or NDJSON. With since, an
+// RFC 3339 time or a date, only loans borrowed or returned from then on
+// are exported.
+func ExportLoansHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		format, ok := exportFormat(r)
+		if !ok {
+			http.Error(w, "Unsupported format, use csv, json or ndjson", http.StatusNotAcceptable)
+			return
+		}
+
+		var since pgtype.Timestamp
+		if v := r.URL.Query().Get("since"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				t, err = time.Parse(time.DateOnly, v)
+			}
+			if err != nil {
+				http.Error(w, "Invalid since, use RFC 3339 or YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+			since = pgtype.Timestamp{Time: t.UTC(), Valid: true}
+		}
+
+		out := newTableWriter(w, format, []string{
+			"id", "user_id", "book_id", "title", "copy_id", "barcode", "borrowed_at", "returned_at",
+		})
+
+		var afterID int32
+		for {
+			extendWriteDeadline(w)
+			mu.Lock()
+			loans, err := dbc.ExportLoans(r.Context(), since, afterID, exportPageSize)
+			mu.Unlock()
+			if err != nil {
+				if !out.started {
+					http.Error(w, fmt.Sprintf("Error exporting loans: %v", err), http.StatusInternalServerError)
+					return
+				}
+				log.Printf("loan export stopped after %d rows: %v", out.rows, err)
+				return
+			}
+			if len(loans) == 0 {
+				break
+			}
+
+			for _, loan := range loans {
+				err := out.Write(loan, func() []string {
+					return []string{
+						strconv.Itoa(int(loan.ID)),
+						strconv.Itoa(int(loan.UserID)),
+						strconv.Itoa(int(loan.BookID)),
+						loan.Title,
+						formatInt4(loan.CopyID),
+						loan.Barcode.String,
+						formatTimestamp(loan.BorrowedAt),
+						formatTimestamp(loan.ReturnedAt),
+					}
+				})
+				if err != nil {
+					log.Printf("loan export stopped after %d rows: %v", out.rows, err)
+					return
+				}
+			}
+			afterID = loans[len(loans)-1].ID
+		}
+		out.Close()
+	}
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"app/database/db"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// PlaceHoldHandler queues the caller for a copy of a book and responds with
+// the hold and its place in the queue.
+func PlaceHoldHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		user, err := authenticatedUser(r, dbc)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		hold, err := dbc.PlaceHold(r.Context(), user.ID, int32(bookID))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error placing hold: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(hold)
+	}
+}
+
+// MyHoldsHandler lists the open holds of the caller with their place in
+// the queue.
+func MyHoldsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		user, err := authenticatedUser(r, dbc)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		holds, err := dbc.ListUserHolds(r.Context(), user.ID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching holds: %v", err), errorStatus(err))
+			return
+		}
+		if holds == nil {
+			holds = []db.ListHoldsRow{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(holds)
+	}
+}
+
+// GetHoldHandler shows an open hold of the caller, or any hold for admins,
+// with its place in the queue.
+func GetHoldHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		holdID, err := strconv.Atoi(ps.ByName("hold_id"))
+		if err != nil {
+			http.Error(w, "Invalid hold ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		user, err := authenticatedUser(r, dbc)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		hold, err := dbc.GetHold(r.Context(), int32(holdID))
+		if err == nil && user.Role != adaptor.RoleAdmin && hold.UserID != user.ID {
+			err = adaptor.ErrNotFound
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching hold: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(hold)
+	}
+}
+
+// CancelHoldHandler cancels an open hold of the caller, or any hold for
+// admins.
+func CancelHoldHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		holdID, err := strconv.Atoi(ps.ByName("hold_id"))
+		if err != nil {
+			http.Error(w, "Invalid hold ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		user, err := authenticatedUser(r, dbc)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		userID := user.ID
+		if user.Role == adaptor.RoleAdmin {
+			userID = 0
+		}
+		if err := dbc.CancelHold(r.Context(), int32(holdID), userID); err != nil {
+			http.Error(w, fmt.Sprintf("Error cancelling hold: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Hold cancelled successfully")
+	}
+}
+
+// ListBookHoldsHandler lists the queue of open holds for a book.
+func ListBookHoldsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		holds, err := dbc.ListBookHolds(r.Context(), int32(bookID))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching holds: %v", err), errorStatus(err))
+			return
+		}
+		if holds == nil {
+			holds = []db.ListHoldsRow{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(holds)
+	}
+}
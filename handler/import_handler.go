@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"app/importer"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// ImportBooksHandler bulk imports books from a CSV or NDJSON request body.
+// The format comes from the format query parameter or the Content-Type, and
+// the response reports the rows that could not be imported.
+func ImportBooksHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		formatName := r.URL.Query().Get("format")
+		if formatName == "" {
+			formatName = r.Header.Get("Content-Type")
+		}
+		format, err := importer.ParseFormat(formatName)
+		if err != nil {
+			http.Error(w, "Invalid format, use csv, ndjson, marc or marcxml", http.StatusBadRequest)
+			return
+		}
+
+		batchSize := importer.DefaultBatchSize
+		if v := r.URL.Query().Get("batch_size"); v != "" {
+			batchSize, err = strconv.Atoi(v)
+			if err != nil || batchSize <= 0 {
+				http.Error(w, "Invalid batch_size", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Other requests get the connection between batches
+		changedBy := requestEmail(r)
+		write := func(ctx context.Context, books []adaptor.ImportBook) ([]bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return dbc.ImportBooks(ctx, changedBy, books)
+		}
+
+		report, err := importer.Import(r.Context(), r.Body, format, batchSize, write)
+		if err != nil {
+			log.Printf("import stopped after %d rows: %v", report.Created+report.Updated+report.Failed, err)
+			http.Error(w, fmt.Sprintf("Error importing books: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
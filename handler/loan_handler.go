@@ -0,0 +1,420 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"app/database/db"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/julienschmidt/httprouter"
+)
+
+// LoanPage is one page of the loan history.
+type LoanPage struct {
+	Loans      []db.ListLoansRow `json:"loans"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+type BorrowingLimitRequest struct {
+	Role              string `json:"role"`
+	MaxLoans          int32  `json:"max_loans"`
+	MaxCopiesPerTitle int32  `json:"max_copies_per_title"`
+}
+
+type LoanPolicyRequest struct {
+	Role string `json:"role"`
+	// BookID limits the policy to one book, otherwise it covers every book
+	BookID   int32 `json:"book_id"`
+	LoanDays int32 `json:"loan_days"`
+	// MaxRenewals defaults to adaptor.DefaultMaxRenewals
+	MaxRenewals *int32 `json:"max_renewals"`
+}
+
+// ListBorrowingLimitsHandler lists how much patrons of each role may have
+// on loan at a time.
+func ListBorrowingLimitsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		limits, err := dbc.ListBorrowingLimits(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching borrowing limits: %v", err), errorStatus(err))
+			return
+		}
+		if limits == nil {
+			limits = []db.BorrowingLimit{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(limits)
+	}
+}
+
+// SetBorrowingLimitHandler sets how much patrons of a role may have on loan
+// at a time.
+func SetBorrowingLimitHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		var req BorrowingLimitRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		limit, err := dbc.SetBorrowingLimit(r.Context(), db.UpsertBorrowingLimitParams{
+			Role:              req.Role,
+			MaxLoans:          req.MaxLoans,
+			MaxCopiesPerTitle: req.MaxCopiesPerTitle,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error setting borrowing limit: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(limit)
+	}
+}
+
+// ListLoanPoliciesHandler lists the loan periods by role and book.
+func ListLoanPoliciesHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		policies, err := dbc.ListLoanPolicies(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching loan policies: %v", err), errorStatus(err))
+			return
+		}
+		if policies == nil {
+			policies = []db.LoanPolicy{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policies)
+	}
+}
+
+// SetLoanPolicyHandler sets the loan period of a role, or of a book for a
+// role. It applies to loans made from now on.
+func SetLoanPolicyHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		var req LoanPolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		maxRenewals := int32(adaptor.DefaultMaxRenewals)
+		if req.MaxRenewals != nil {
+			maxRenewals = *req.MaxRenewals
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		policy, err := dbc.SetLoanPolicy(r.Context(), db.UpsertLoanPolicyParams{
+			Role:        req.Role,
+			BookID:      pgtype.Int4{Int32: req.BookID, Valid: req.BookID != 0},
+			LoanDays:    req.LoanDays,
+			MaxRenewals: maxRenewals,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error setting loan policy: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policy)
+	}
+}
+
+// DeleteLoanPolicyHandler removes a loan policy.
+func DeleteLoanPolicyHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		policyID, err := strconv.Atoi(ps.ByName("policy_id"))
+		if err != nil {
+			http.Error(w, "Invalid loan policy ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.DeleteLoanPolicy(r.Context(), int32(policyID)); err != nil {
+			http.Error(w, fmt.Sprintf("Error deleting loan policy: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Loan policy deleted successfully")
+	}
+}
+
+// RenewLoanHandler extends a loan of the authenticated user, or any loan
+// for admins, and responds with the renewed loan.
+// Query parameters: override=true lets admins renew an overdue loan.
+func RenewLoanHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		loanID, err := strconv.Atoi(ps.ByName("loan_id"))
+		if err != nil {
+			http.Error(w, "Invalid loan ID", http.StatusBadRequest)
+			return
+		}
+
+		var override bool
+		if v := r.URL.Query().Get("override"); v != "" {
+			if override, err = strconv.ParseBool(v); err != nil {
+				http.Error(w, "Invalid override", http.StatusBadRequest)
+				return
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		user, err := authenticatedUser(r, dbc)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		opts := adaptor.RenewOptions{Override: override}
+		if user.Role != adaptor.RoleAdmin {
+			if override {
+				http.Error(w, "Only admins can override", http.StatusForbidden)
+				return
+			}
+			opts.UserID = user.ID
+		}
+
+		loan, err := dbc.RenewLoan(r.Context(), int32(loanID), opts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error renewing loan: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(loan)
+	}
+}
+
+// ListOverdueLoansHandler lists the outstanding loans past their due date,
+// most overdue first, with the borrower's name and email.
+// Query parameters: branch_id, limit, offset.
+func ListOverdueLoansHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		branchID, err := branchParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		var limit, offset int
+		if v := query.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("offset"); v != "" {
+			if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		loans, err := dbc.ListOverdueLoans(r.Context(), branchID, int32(limit), int32(offset))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching overdue loans: %v", err), errorStatus(err))
+			return
+		}
+		if loans == nil {
+			loans = []db.ListOverdueLoansRow{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(loans)
+	}
+}
+
+// parseListLoansOptions reads the loan history filters from the query
+// string. from and to are RFC 3339 times or dates, a date to includes the
+// whole day.
+func parseListLoansOptions(query url.Values) (adaptor.ListLoansOptions, error) {
+	opts := adaptor.ListLoansOptions{
+		Status: query.Get("status"),
+		Cursor: query.Get("cursor"),
+	}
+
+	if v := query.Get("user_id"); v != "" {
+		userID, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New("Invalid user ID")
+		}
+		opts.UserID = int32(userID)
+	}
+
+	if v := query.Get("book_id"); v != "" {
+		bookID, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New("Invalid book ID")
+		}
+		opts.BookID = int32(bookID)
+	}
+
+	if v := query.Get("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			from, err = time.Parse(time.DateOnly, v)
+		}
+		if err != nil {
+			return opts, errors.New("Invalid from, use RFC 3339 or YYYY-MM-DD")
+		}
+		opts.BorrowedFrom = from.UTC()
+	}
+
+	if v := query.Get("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			to, err = time.Parse(time.DateOnly, v)
+			to = to.AddDate(0, 0, 1)
+		}
+		if err != nil {
+			return opts, errors.New("Invalid to, use RFC 3339 or YYYY-MM-DD")
+		}
+		opts.BorrowedBefore = to.UTC()
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return opts, errors.New("Invalid limit")
+		}
+		opts.Limit = int32(limit)
+	}
+
+	return opts, nil
+}
+
+// UserLoansHandler lists the loan history of a user, newest first, to the
+// user and to admins.
+// Query parameters: status (active, returned or overdue), book_id, from, to, cursor, limit.
+func UserLoansHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		userID, err := strconv.Atoi(ps.ByName("user_id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		opts, err := parseListLoansOptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.UserID = int32(userID)
+
+		mu.Lock()
+		defer mu.Unlock()
+		user, err := authenticatedUser(r, dbc)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if user.Role != adaptor.RoleAdmin && user.ID != int32(userID) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		loans, next, err := dbc.ListLoans(r.Context(), opts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching loans: %v", err), errorStatus(err))
+			return
+		}
+		if loans == nil {
+			loans = []db.ListLoansRow{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LoanPage{Loans: loans, NextCursor: next})
+	}
+}
+
+// ListLoansHandler lists the loan history of everyone, newest first.
+// Query parameters: status (active, returned or overdue), user_id, book_id, from, to, cursor, limit.
+func ListLoansHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		opts, err := parseListLoansOptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		loans, next, err := dbc.ListLoans(r.Context(), opts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching loans: %v", err), errorStatus(err))
+			return
+		}
+		if loans == nil {
+			loans = []db.ListLoansRow{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LoanPage{Loans: loans, NextCursor: next})
+	}
+}
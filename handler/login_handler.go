@@ -3,6 +3,7 @@ package handler
 import (
 	"app/auth"
 	"app/database/adaptor"
+	"app/database/db"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -17,7 +18,8 @@ import (
 )
 
 const (
-	RoleKey = "roleKey"
+	RoleKey  = "roleKey"
+	EmailKey = "emailKey"
 )
 
 // Adapt function to convert httprouter.Handle to http.HandlerFunc
@@ -60,25 +62,43 @@ func JWTAuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		claims := &Claims{}
 
-		claim, err := extractClaims(tokenStr)
+		claims, err := extractClaims(tokenStr)
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		if claim.Role != "admin" {
+		if claims.Role != "admin" {
 			http.Error(w, "Unauthorized", http.StatusForbidden)
 			return
 		}
 
-		// Store role in context for later use
+		// Store role and email in context for later use
 		ctx := context.WithValue(r.Context(), RoleKey, claims.Role)
+		ctx = context.WithValue(ctx, EmailKey, claims.Email)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// requestEmail returns the email of the admin making the request, as put in
+// the context by JWTAuthMiddleware.
+func requestEmail(r *http.Request) string {
+	email, _ := r.Context().Value(EmailKey).(string)
+	return email
+}
+
+// authenticatedUser returns the user the bearer token of the request was
+// issued to. Unlike JWTAuthMiddleware it accepts every role.
+func authenticatedUser(r *http.Request, dbc *adaptor.PostgresClient) (db.User, error) {
+	tokenStr := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := extractClaims(tokenStr)
+	if err != nil {
+		return db.User{}, err
+	}
+	return dbc.GetUserByEmail(r.Context(), claims.Email)
+}
+
 // LoginHandler handles the login request.
 type Claims struct {
 	Email string `json:"email"`
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"app/marc"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// exportPageSize is the number of rows read from the database at a time
+// while exporting.
+const exportPageSize = 500
+
+// marcWriter is a marc.Writer or a marc.XMLWriter.
+type marcWriter interface {
+	Write(marc.Record) error
+}
+
+// ExportMARCHandler exports the catalog as MARC21, in ISO 2709 (format=marc,
+// the default) or as MARCXML (format=marcxml). The ids query parameter,
+// a comma separated list of book IDs, restricts the export to those books.
+func ExportMARCHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		var ids []int32
+		if v := r.URL.Query().Get("ids"); v != "" {
+			for _, s := range strings.Split(v, ",") {
+				id, err := strconv.Atoi(strings.TrimSpace(s))
+				if err != nil {
+					http.Error(w, "Invalid ids", http.StatusBadRequest)
+					return
+				}
+				ids = append(ids, int32(id))
+			}
+		}
+
+		var out marcWriter
+		var closeOut func() error
+		switch r.URL.Query().Get("format") {
+		case "", "marc", "mrc":
+			w.Header().Set("Content-Type", "application/marc")
+			w.Header().Set("Content-Disposition", `attachment; filename="catalog.mrc"`)
+			out = marc.NewWriter(w)
+		case "marcxml", "xml":
+			w.Header().Set("Content-Type", "application/marcxml+xml")
+			w.Header().Set("Content-Disposition", `attachment; filename="catalog.xml"`)
+			xmlOut := marc.NewXMLWriter(w)
+			out, closeOut = xmlOut, xmlOut.Close
+		default:
+			http.Error(w, "Invalid format, use marc or marcxml", http.StatusBadRequest)
+			return
+		}
+
+		var afterID int32
+		for {
+			mu.Lock()
+			books, err := dbc.ListBooksForExport(r.Context(), ids, afterID, exportPageSize)
+			mu.Unlock()
+			if err != nil {
+				// The status line is gone once the first page is written
+				log.Printf("MARC export stopped after book %d: %v", afterID, err)
+				return
+			}
+			if len(books) == 0 {
+				break
+			}
+
+			for _, book := range books {
+				// A record too large for ISO 2709 is left out, any other
+				// error means the client is gone
+				err := out.Write(marc.NewRecord(marcBook(book)))
+				if errors.Is(err, marc.ErrTooLarge) {
+					log.Printf("MARC export left out book %d: %v", book.ID, err)
+					continue
+				}
+				if err != nil {
+					log.Printf("MARC export stopped at book %d: %v", book.ID, err)
+					return
+				}
+			}
+			afterID = books[len(books)-1].ID
+		}
+
+		if closeOut != nil {
+			closeOut()
+		}
+	}
+}
+
+func marcBook(book adaptor.CatalogBook) marc.Book {
+	b := marc.Book{
+		ID:          book.ID,
+		Title:       book.Title,
+		Description: book.Description,
+		ISBN:        book.Isbn.String,
+		Edition:     book.Edition,
+		Publisher:   book.Publisher,
+	}
+	if book.PublishedYear.Valid {
+		b.PublishedYear = int(book.PublishedYear.Int32)
+	}
+	for _, a := range book.Authors {
+		b.Authors = append(b.Authors, a.Name)
+	}
+	return b
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/julienschmidt/httprouter"
+)
+
+// MergePatchType is the media type of JSON Merge Patch documents, RFC 7396.
+const MergePatchType = "application/merge-patch+json"
+
+// PatchBookHandler applies a JSON Merge Patch to the details of a book: only
+// the fields present in the document change, and a null removes a field.
+// If-Match must carry the ETag of the book. It responds with the patched
+// book and its new ETag.
+func PatchBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || (mediaType != MergePatchType && mediaType != "application/json") {
+			w.Header().Set("Accept-Patch", MergePatchType)
+			http.Error(w, "Content-Type must be "+MergePatchType, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		patch, err := parseBookPatch(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		version, ok := ifMatchVersion(w, r, dbc, int32(bookID))
+		if !ok {
+			return
+		}
+		if _, err := dbc.PatchBook(r.Context(), requestEmail(r), int32(bookID), version, patch); err != nil {
+			http.Error(w, fmt.Sprintf("Error updating book: %v", err), errorStatus(err))
+			return
+		}
+
+		book, err := dbc.GetBookByID(r.Context(), int32(bookID))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching book: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("ETag", bookETag(book.Version))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(book)
+	}
+}
+
+// parseBookPatch reads a merge patch of the fields of UpdateBookRequest.
+// Other members, values of the wrong type and a null title are rejected.
+func parseBookPatch(body io.Reader) (adaptor.BookPatch, error) {
+	var patch adaptor.BookPatch
+
+	var doc map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&doc); err != nil || doc == nil {
+		return patch, errors.New("Invalid merge patch: the document must be a JSON object")
+	}
+
+	// Sorted so the first invalid member reported is always the same
+	names := make([]string, 0, len(doc))
+	for name := range doc {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := doc[name]
+		var err error
+		switch name {
+		case "title":
+			patch.Title, err = patchString(name, value, false)
+		case "description":
+			patch.Description, err = patchString(name, value, true)
+		case "edition":
+			patch.Edition, err = patchString(name, value, true)
+		case "publisher":
+			patch.Publisher, err = patchString(name, value, true)
+		case "language":
+			patch.Language, err = patchString(name, value, true)
+		case "isbn":
+			var isbn *string
+			if isbn, err = patchString(name, value, true); err == nil {
+				patch.ISBN = &pgtype.Text{String: *isbn, Valid: *isbn != ""}
+			}
+		case "published_year":
+			patch.PublishedYear = &pgtype.Int4{}
+			if !isNull(value) {
+				var year int32
+				if json.Unmarshal(value, &year) != nil {
+					err = fmt.Errorf("%s must be an integer", name)
+				}
+				patch.PublishedYear = &pgtype.Int4{Int32: year, Valid: true}
+			}
+		default:
+			err = fmt.Errorf("%s cannot be patched", name)
+		}
+		if err != nil {
+			return patch, err
+		}
+	}
+	return patch, nil
+}
+
+// patchString reads a string member of a merge patch. A null removes the
+// value, leaving an empty string, when the field is optional.
+func patchString(name string, value json.RawMessage, optional bool) (*string, error) {
+	var s string
+	if isNull(value) {
+		if !optional {
+			return nil, fmt.Errorf("%s cannot be removed", name)
+		}
+		return &s, nil
+	}
+	if err := json.Unmarshal(value, &s); err != nil {
+		return nil, fmt.Errorf("%s must be a string", name)
+	}
+	return &s, nil
+}
+
+func isNull(value json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// BookRecommendationsHandler lists the books patrons who borrowed a book
+// also borrowed. It is served without authentication; callers who send a
+// token don't get the books they have on loan.
+// Query parameters: limit.
+func BookRecommendationsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		limit, ok := limitParam(w, r)
+		if !ok {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		var userID int32
+		if r.Header.Get("Authorization") != "" {
+			user, err := authenticatedUser(r, dbc)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			userID = user.ID
+		}
+
+		recommendations, err := dbc.BookRecommendations(r.Context(), int32(bookID), userID, limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching recommendations: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(recommendations)
+	}
+}
+
+// MyRecommendationsHandler lists books recommended from the caller's loan
+// history, leaving out the books they have borrowed.
+// Query parameters: limit.
+func MyRecommendationsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		limit, ok := limitParam(w, r)
+		if !ok {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		user, err := authenticatedUser(r, dbc)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		recommendations, err := dbc.UserRecommendations(r.Context(), user.ID, limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching recommendations: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(recommendations)
+	}
+}
+
+// limitParam reads the optional limit query parameter, writing a
+// 400 response when it is invalid.
+func limitParam(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return 0, true
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return 0, false
+	}
+	return int32(limit), true
+}
@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"app/database/db"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/julienschmidt/httprouter"
+)
+
+type ReviewRequest struct {
+	Rating int32  `json:"rating"`
+	Text   string `json:"text"`
+}
+
+type HideReviewRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ReviewPage is one page of the reviews of a book.
+type ReviewPage struct {
+	Reviews    []db.ListBookReviewsRow `json:"reviews"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// ModerationPage is one page of the review moderation queue.
+type ModerationPage struct {
+	Reviews    []db.Review `json:"reviews"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// ReviewBookHandler adds or replaces the caller's review of a book they
+// have borrowed.
+func ReviewBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		var req ReviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		user, err := authenticatedUser(r, dbc)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		review, err := dbc.ReviewBook(r.Context(), user.ID, int32(bookID), req.Rating, req.Text)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reviewing book: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review)
+	}
+}
+
+// DeleteReviewHandler removes the caller's review of a book.
+func DeleteReviewHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		user, err := authenticatedUser(r, dbc)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err := dbc.DeleteReview(r.Context(), user.ID, int32(bookID)); err != nil {
+			http.Error(w, fmt.Sprintf("Error deleting review: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Review deleted successfully")
+	}
+}
+
+// ListBookReviewsHandler lists the visible reviews of a book, newest first.
+// Query parameters: cursor, limit.
+func ListBookReviewsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		var limit int
+		if v := query.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		reviews, next, err := dbc.ListBookReviews(r.Context(), int32(bookID), query.Get("cursor"), int32(limit))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching reviews: %v", err), errorStatus(err))
+			return
+		}
+		if reviews == nil {
+			reviews = []db.ListBookReviewsRow{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ReviewPage{Reviews: reviews, NextCursor: next})
+	}
+}
+
+// ListReviewsHandler lists all reviews for moderation, newest first.
+// Query parameters: hidden (true or false, both by default), cursor, limit.
+func ListReviewsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		query := r.URL.Query()
+		var hidden pgtype.Bool
+		if v := query.Get("hidden"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "Invalid hidden, use true or false", http.StatusBadRequest)
+				return
+			}
+			hidden = pgtype.Bool{Bool: b, Valid: true}
+		}
+		var limit int
+		if v := query.Get("limit"); v != "" {
+			var err error
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		reviews, next, err := dbc.ListReviews(r.Context(), hidden, query.Get("cursor"), int32(limit))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching reviews: %v", err), errorStatus(err))
+			return
+		}
+		if reviews == nil {
+			reviews = []db.Review{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ModerationPage{Reviews: reviews, NextCursor: next})
+	}
+}
+
+// HideReviewHandler hides an abusive review from patrons.
+func HideReviewHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		reviewID, err := strconv.Atoi(ps.ByName("review_id"))
+		if err != nil {
+			http.Error(w, "Invalid review ID", http.StatusBadRequest)
+			return
+		}
+
+		var req HideReviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.HideReview(r.Context(), int32(reviewID), req.Reason); err != nil {
+			http.Error(w, fmt.Sprintf("Error hiding review: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Review hidden successfully")
+	}
+}
+
+// UnhideReviewHandler shows a hidden review again.
+func UnhideReviewHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		reviewID, err := strconv.Atoi(ps.ByName("review_id"))
+		if err != nil {
+			http.Error(w, "Invalid review ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.UnhideReview(r.Context(), int32(reviewID)); err != nil {
+			http.Error(w, fmt.Sprintf("Error unhiding review: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Review unhidden successfully")
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// BookHistoryHandler lists the recorded edits of a book, newest first.
+func BookHistoryHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		revisions, err := dbc.BookHistory(r.Context(), int32(bookID))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching book history: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(revisions)
+	}
+}
+
+// RevertBookHandler sets the details of a book back to a revision of its
+// history. Revision 0 is the book as it was added. Like the other changes
+// to a book it requires If-Match.
+func RevertBookHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		revision, err := strconv.Atoi(ps.ByName("revision"))
+		if err != nil || revision < 0 {
+			http.Error(w, "Invalid revision", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		version, ok := ifMatchVersion(w, r, dbc, int32(bookID))
+		if !ok {
+			return
+		}
+		version, err = dbc.RevertBook(r.Context(), requestEmail(r), int32(bookID), int32(revision), version)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reverting book: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("ETag", bookETag(version))
+		json.NewEncoder(w).Encode("Book reverted successfully")
+	}
+}
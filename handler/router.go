@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Router is an httprouter.Router that can also serve routes httprouter v1.3
+// refuses to register because a wildcard already owns the same path segment,
+// e.g. GET /books/search next to GET /books/:book_id.
+type Router struct {
+	*httprouter.Router
+	priority map[string][]priorityRoute
+}
+
+type priorityRoute struct {
+	segments []string
+	handler  http.Handler
+}
+
+// PanicHandler prints the stack trace and returns the error status.
+func panicHandler(w http.ResponseWriter, r *http.Request, err interface{}) {
+	debug.PrintStack()
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+// NewRouter creates a new router
+func NewRouter() *Router {
+	router := httprouter.New()
+	router.PanicHandler = panicHandler
+	return &Router{Router: router, priority: map[string][]priorityRoute{}}
+}
+
+// Priority registers a route that is matched before the httprouter tree.
+// Segments starting with ":" are named parameters, as in httprouter, and are
+// available to the handler through httprouter.ParamsFromContext.
+func (rt *Router) Priority(method, path string, handler http.Handler) {
+	rt.priority[method] = append(rt.priority[method], priorityRoute{
+		segments: strings.Split(strings.Trim(path, "/"), "/"),
+		handler:  handler,
+	})
+}
+
+// ServeHTTP makes the router implement the http.Handler interface.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if routes, ok := rt.priority[req.Method]; ok {
+		path := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+		for _, route := range routes {
+			params, ok := route.match(path)
+			if !ok {
+				continue
+			}
+			if rt.PanicHandler != nil {
+				defer func() {
+					if rcv := recover(); rcv != nil {
+						rt.PanicHandler(w, req, rcv)
+					}
+				}()
+			}
+			ctx := context.WithValue(req.Context(), httprouter.ParamsKey, params)
+			route.handler.ServeHTTP(w, req.WithContext(ctx))
+			return
+		}
+	}
+	rt.Router.ServeHTTP(w, req)
+}
+
+func (route priorityRoute) match(path []string) (httprouter.Params, bool) {
+	if len(path) != len(route.segments) {
+		return nil, false
+	}
+	var params httprouter.Params
+	for i, segment := range route.segments {
+		if strings.HasPrefix(segment, ":") {
+			params = append(params, httprouter.Param{Key: segment[1:], Value: path[i]})
+			continue
+		}
+		if segment != path[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// SubjectPayload names a subject and its parent; parent_id 0 or omitted
+// means a top level subject.
+type SubjectPayload struct {
+	Name     string `json:"name"`
+	ParentID int32  `json:"parent_id"`
+}
+
+type BookSubjectsRequest struct {
+	SubjectIDs []int32 `json:"subject_ids"`
+}
+
+// CreateSubjectHandler adds a subject to the taxonomy.
+func CreateSubjectHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		var req SubjectPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Subject name is required", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		subject, err := dbc.CreateSubject(r.Context(), req.Name, req.ParentID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error creating subject: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(subject)
+	}
+}
+
+// ListSubjectsHandler returns the whole subject tree.
+func ListSubjectsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		tree, err := dbc.SubjectTree(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching subjects: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tree)
+	}
+}
+
+// GetSubjectHandler retrieves a subject by ID.
+func GetSubjectHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		subjectID, err := strconv.Atoi(ps.ByName("subject_id"))
+		if err != nil {
+			http.Error(w, "Invalid subject ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		subject, err := dbc.GetSubject(r.Context(), int32(subjectID))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching subject: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(subject)
+	}
+}
+
+// UpdateSubjectHandler renames a subject and moves it under another parent.
+func UpdateSubjectHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		subjectID, err := strconv.Atoi(ps.ByName("subject_id"))
+		if err != nil {
+			http.Error(w, "Invalid subject ID", http.StatusBadRequest)
+			return
+		}
+
+		var req SubjectPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Subject name is required", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.UpdateSubject(r.Context(), int32(subjectID), req.Name, req.ParentID); err != nil {
+			http.Error(w, fmt.Sprintf("Error updating subject: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Subject updated successfully")
+	}
+}
+
+// DeleteSubjectHandler deletes a subject without child subjects or books.
+func DeleteSubjectHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		subjectID, err := strconv.Atoi(ps.ByName("subject_id"))
+		if err != nil {
+			http.Error(w, "Invalid subject ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.DeleteSubject(r.Context(), int32(subjectID)); err != nil {
+			http.Error(w, fmt.Sprintf("Error deleting subject: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Subject deleted successfully")
+	}
+}
+
+// AddBookSubjectsHandler files a book under one or more subjects.
+func AddBookSubjectsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		var req BookSubjectsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if len(req.SubjectIDs) == 0 {
+			http.Error(w, "At least one subject is required", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.AddBookSubjects(r.Context(), int32(bookID), req.SubjectIDs); err != nil {
+			http.Error(w, fmt.Sprintf("Error adding subjects: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Subjects added successfully")
+	}
+}
+
+// RemoveBookSubjectHandler takes a book out of a subject.
+func RemoveBookSubjectHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		bookID, err := strconv.Atoi(ps.ByName("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+
+		subjectID, err := strconv.Atoi(ps.ByName("subject_id"))
+		if err != nil {
+			http.Error(w, "Invalid subject ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.RemoveBookSubject(r.Context(), int32(bookID), int32(subjectID)); err != nil {
+			http.Error(w, fmt.Sprintf("Error removing subject: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Subject removed successfully")
+	}
+}
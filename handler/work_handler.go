@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"app/database/adaptor"
+	"app/database/db"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type WorkPayload struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+type AttachEditionsRequest struct {
+	BookIDs []int32 `json:"book_ids"`
+}
+
+// WorkPage is one page of the work listing.
+type WorkPage struct {
+	Works      []adaptor.WorkDetail `json:"works"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// ListWorksHandler lists works ordered by ID, each with its editions.
+// Query parameters: title_prefix, cursor, limit.
+func ListWorksHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		query := r.URL.Query()
+		var limit int
+		if v := query.Get("limit"); v != "" {
+			var err error
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		works, next, err := dbc.ListWorks(r.Context(), query.Get("title_prefix"), query.Get("cursor"), int32(limit))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching works: %v", err), errorStatus(err))
+			return
+		}
+		if works == nil {
+			works = []adaptor.WorkDetail{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(WorkPage{Works: works, NextCursor: next})
+	}
+}
+
+// GetWorkHandler retrieves a work with its authors, subjects and editions.
+func GetWorkHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		workID, err := strconv.Atoi(ps.ByName("work_id"))
+		if err != nil {
+			http.Error(w, "Invalid work ID", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		work, err := dbc.GetWork(r.Context(), int32(workID))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching work: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(work)
+	}
+}
+
+// UpdateWorkHandler updates the title and description of a work.
+func UpdateWorkHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		workID, err := strconv.Atoi(ps.ByName("work_id"))
+		if err != nil {
+			http.Error(w, "Invalid work ID", http.StatusBadRequest)
+			return
+		}
+
+		var req WorkPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		req.Title = strings.TrimSpace(req.Title)
+		if req.Title == "" {
+			http.Error(w, "Work title is required", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		err = dbc.UpdateWork(r.Context(), db.Work{ID: int32(workID), Title: req.Title, Description: req.Description})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error updating work: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Work updated successfully")
+	}
+}
+
+// AttachEditionsHandler moves books, catalogued under other works, to a work.
+func AttachEditionsHandler(dbc *adaptor.PostgresClient, log *log.Logger) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !limiter.Allow() {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		workID, err := strconv.Atoi(ps.ByName("work_id"))
+		if err != nil {
+			http.Error(w, "Invalid work ID", http.StatusBadRequest)
+			return
+		}
+
+		var req AttachEditionsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		bookIDs := uniqueIDs(req.BookIDs)
+		if len(bookIDs) == 0 {
+			http.Error(w, "At least one book is required", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err := dbc.AttachEditions(r.Context(), int32(workID), bookIDs); err != nil {
+			http.Error(w, fmt.Sprintf("Error attaching editions: %v", err), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("Editions attached successfully")
+	}
+}
+
+// uniqueIDs drops duplicate IDs, keeping the first occurrence.
+func uniqueIDs(ids []int32) []int32 {
+	seen := make(map[int32]bool, len(ids))
+	var result []int32
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,270 @@
+// Package importer loads books into the catalog from CSV, NDJSON or MARC21
+// files.
+//
+// CSV files need a header row. The title column is required; description,
+// isbn, edition, publisher, published_year, language, copies and authors are
+// optional, and authors holds author names separated by ";". NDJSON files
+// hold one JSON object per line with the same fields, where authors is a
+// list of names or of {"id", "name", "bio"} objects. MARC21 records, in
+// ISO 2709 or MARCXML, are mapped as described in package marc and come
+// without copies.
+package importer
+
+import (
+	"app/database/adaptor"
+	"app/database/db"
+	"app/isbn"
+	"app/marc"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Format is the encoding of an import file.
+type Format string
+
+const (
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson"
+	MARC    Format = "marc"
+	MARCXML Format = "marcxml"
+)
+
+// DefaultBatchSize is the number of rows written per transaction.
+const DefaultBatchSize = 500
+
+// ErrUnknownFormat is returned for a format Import does not read.
+var ErrUnknownFormat = errors.New("unknown import format")
+
+// Writer stores one batch of books, see adaptor.PostgresClient.ImportBooks.
+type Writer func(ctx context.Context, books []adaptor.ImportBook) ([]bool, error)
+
+// Report is the outcome of an import. Line numbers start at 1 and count the
+// CSV header; for MARC files they are record numbers.
+type Report struct {
+	Created int        `json:"created"`
+	Updated int        `json:"updated"`
+	Failed  int        `json:"failed"`
+	Errors  []RowError `json:"errors"`
+}
+
+// RowError explains why a row was not imported.
+type RowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// Record is one book as it appears in an import file.
+type Record struct {
+	Title         string         `json:"title"`
+	Description   string         `json:"description"`
+	ISBN          string         `json:"isbn"`
+	Edition       string         `json:"edition"`
+	Publisher     string         `json:"publisher"`
+	PublishedYear int32          `json:"published_year"`
+	Language      string         `json:"language"`
+	Copies        int32          `json:"copies"`
+	Authors       []RecordAuthor `json:"authors"`
+}
+
+// RecordAuthor references an existing author by ID or names one.
+type RecordAuthor struct {
+	ID   int32  `json:"id"`
+	Name string `json:"name"`
+	Bio  string `json:"bio"`
+}
+
+// UnmarshalJSON accepts a plain name as well as an author object.
+func (a *RecordAuthor) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*a = RecordAuthor{Name: name}
+		return nil
+	}
+	type author RecordAuthor
+	return json.Unmarshal(data, (*author)(a))
+}
+
+// ParseFormat maps a format name or a content type to a Format.
+func ParseFormat(s string) (Format, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if i := strings.IndexByte(s, ';'); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	switch s {
+	case "csv", "text/csv":
+		return CSV, nil
+	case "ndjson", "jsonl", "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return NDJSON, nil
+	case "marc", "mrc", "iso2709", "application/marc":
+		return MARC, nil
+	case "marcxml", "xml", "application/marcxml+xml", "application/xml", "text/xml":
+		return MARCXML, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+	}
+}
+
+// Import streams rows from r, validates them and writes the valid ones in
+// batches of batchSize. A batch that fails is written again row by row so
+// that only the offending rows are reported. The returned error is set only
+// when the file cannot be read any further.
+func Import(ctx context.Context, r io.Reader, format Format, batchSize int, write Writer) (Report, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	var next func() (int, Record, error)
+	switch format {
+	case CSV:
+		src, err := newCSVSource(r)
+		if err != nil {
+			return Report{}, err
+		}
+		next = src.next
+	case NDJSON:
+		next = newNDJSONSource(r).next
+	case MARC:
+		next = newMARCSource(marc.NewReader(r)).next
+	case MARCXML:
+		next = newMARCSource(marc.NewXMLReader(r)).next
+	default:
+		return Report{}, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+
+	report := Report{Errors: []RowError{}}
+	var batch []adaptor.ImportBook
+	var lines []int
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		created, err := write(ctx, batch)
+		if err == nil {
+			report.add(created)
+		} else {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			for i := range batch {
+				created, err := write(ctx, batch[i:i+1])
+				if err != nil {
+					report.fail(lines[i], err)
+					continue
+				}
+				report.add(created)
+			}
+		}
+		batch, lines = batch[:0], lines[:0]
+		return nil
+	}
+
+	for {
+		line, record, err := next()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *rowError
+		if errors.As(err, &rowErr) {
+			report.fail(line, rowErr.err)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		book, err := record.validate()
+		if err != nil {
+			report.fail(line, err)
+			continue
+		}
+		batch = append(batch, book)
+		lines = append(lines, line)
+
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, flush()
+}
+
+func (r *Report) add(created []bool) {
+	for _, c := range created {
+		if c {
+			r.Created++
+		} else {
+			r.Updated++
+		}
+	}
+}
+
+func (r *Report) fail(line int, err error) {
+	r.Failed++
+	r.Errors = append(r.Errors, RowError{Line: line, Error: err.Error()})
+}
+
+// rowError is a row that could not be decoded; reading can go on after it.
+type rowError struct {
+	err error
+}
+
+func (e *rowError) Error() string {
+	return e.err.Error()
+}
+
+// validate checks a record the same way AddANewBookHandler checks a request.
+func (rec Record) validate() (adaptor.ImportBook, error) {
+	title := strings.TrimSpace(rec.Title)
+	if title == "" {
+		return adaptor.ImportBook{}, errors.New("title is required")
+	}
+	if rec.Copies < 0 {
+		return adaptor.ImportBook{}, fmt.Errorf("copies must not be negative, got %d", rec.Copies)
+	}
+
+	if rec.PublishedYear < 0 {
+		return adaptor.ImportBook{}, fmt.Errorf("published_year must not be negative, got %d", rec.PublishedYear)
+	}
+
+	book := adaptor.ImportBook{
+		Book: db.AddBookParams{
+			Title:         title,
+			Description:   rec.Description,
+			Edition:       strings.TrimSpace(rec.Edition),
+			Publisher:     strings.TrimSpace(rec.Publisher),
+			PublishedYear: pgtype.Int4{Int32: rec.PublishedYear, Valid: rec.PublishedYear > 0},
+			Language:      strings.TrimSpace(rec.Language),
+		},
+		Copies: rec.Copies,
+	}
+
+	if value := strings.TrimSpace(rec.ISBN); value != "" {
+		normalized, err := isbn.Normalize(value)
+		if err != nil {
+			return adaptor.ImportBook{}, fmt.Errorf("isbn %q: %w", value, err)
+		}
+		book.Book.Isbn = pgtype.Text{String: normalized, Valid: true}
+	}
+
+	for i, a := range rec.Authors {
+		name := strings.TrimSpace(a.Name)
+		if a.ID <= 0 && name == "" {
+			return adaptor.ImportBook{}, fmt.Errorf("author %d: either id or name is required", i)
+		}
+		book.Authors = append(book.Authors, db.Author{ID: a.ID, Name: name, Bio: a.Bio})
+	}
+	if len(book.Authors) == 0 {
+		return adaptor.ImportBook{}, errors.New("at least one author is required")
+	}
+
+	return book, nil
+}
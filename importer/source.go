@@ -0,0 +1,173 @@
+package importer
+
+import (
+	"app/marc"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxLineSize bounds a single NDJSON line.
+const maxLineSize = 1 << 20
+
+type csvSource struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVSource(r io.Reader) (*csvSource, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("csv: missing header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("csv: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("csv: header has no title column")
+	}
+
+	return &csvSource{reader: reader, columns: columns}, nil
+}
+
+func (s *csvSource) next() (int, Record, error) {
+	fields, err := s.reader.Read()
+	if err == io.EOF {
+		return 0, Record{}, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, Record{}, &rowError{err: parseErr.Err}
+	}
+	if err != nil {
+		return 0, Record{}, err
+	}
+	line, _ := s.reader.FieldPos(0)
+
+	get := func(column string) string {
+		i, ok := s.columns[column]
+		if !ok || i >= len(fields) {
+			return ""
+		}
+		return strings.TrimSpace(fields[i])
+	}
+
+	record := Record{
+		Title:       get("title"),
+		Description: get("description"),
+		ISBN:        get("isbn"),
+		Edition:     get("edition"),
+		Publisher:   get("publisher"),
+		Language:    get("language"),
+	}
+	if year := get("published_year"); year != "" {
+		n, err := strconv.ParseInt(year, 10, 32)
+		if err != nil {
+			return line, Record{}, &rowError{err: fmt.Errorf("published_year %q is not a number", year)}
+		}
+		record.PublishedYear = int32(n)
+	}
+	if copies := get("copies"); copies != "" {
+		n, err := strconv.ParseInt(copies, 10, 32)
+		if err != nil {
+			return line, Record{}, &rowError{err: fmt.Errorf("copies %q is not a number", copies)}
+		}
+		record.Copies = int32(n)
+	}
+	for _, name := range strings.Split(get("authors"), ";") {
+		if name = strings.TrimSpace(name); name != "" {
+			record.Authors = append(record.Authors, RecordAuthor{Name: name})
+		}
+	}
+
+	return line, record, nil
+}
+
+type ndjsonSource struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONSource(r io.Reader) *ndjsonSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	return &ndjsonSource{scanner: scanner}
+}
+
+func (s *ndjsonSource) next() (int, Record, error) {
+	for s.scanner.Scan() {
+		s.line++
+		data := bytes.TrimSpace(s.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(data, &record); err != nil {
+			return s.line, Record{}, &rowError{err: fmt.Errorf("invalid JSON: %w", err)}
+		}
+		return s.line, record, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return s.line + 1, Record{}, fmt.Errorf("ndjson line %d: %w", s.line+1, err)
+	}
+	return 0, Record{}, io.EOF
+}
+
+// marcReader is a marc.Reader or a marc.XMLReader.
+type marcReader interface {
+	Read() (marc.Record, error)
+}
+
+type marcSource struct {
+	reader marcReader
+	number int
+}
+
+func newMARCSource(r marcReader) *marcSource {
+	return &marcSource{reader: r}
+}
+
+func (s *marcSource) next() (int, Record, error) {
+	rec, err := s.reader.Read()
+	if err == io.EOF {
+		return 0, Record{}, io.EOF
+	}
+	s.number++
+	if errors.Is(err, marc.ErrMalformed) {
+		return s.number, Record{}, &rowError{err: err}
+	}
+	if err != nil {
+		return s.number, Record{}, fmt.Errorf("marc record %d: %w", s.number, err)
+	}
+
+	book := rec.Book()
+	record := Record{
+		Title:         book.Title,
+		Description:   book.Description,
+		ISBN:          book.ISBN,
+		Edition:       book.Edition,
+		Publisher:     book.Publisher,
+		PublishedYear: int32(book.PublishedYear),
+	}
+	for _, name := range book.Authors {
+		record.Authors = append(record.Authors, RecordAuthor{Name: name})
+	}
+	return s.number, record, nil
+}
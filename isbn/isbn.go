@@ -0,0 +1,113 @@
+// Package isbn validates International Standard Book Numbers and converts
+// between the ISBN-10 and ISBN-13 forms.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalid is returned for a value that is not a valid ISBN-10 or ISBN-13.
+var ErrInvalid = errors.New("invalid ISBN")
+
+// Normalize validates an ISBN-10 or ISBN-13, with or without hyphens and
+// spaces, and returns it as a 13 digit ISBN-13.
+func Normalize(s string) (string, error) {
+	s = strip(s)
+	switch len(s) {
+	case 10:
+		if !valid10(s) {
+			return "", ErrInvalid
+		}
+		return to13(s), nil
+	case 13:
+		if !valid13(s) {
+			return "", ErrInvalid
+		}
+		return s, nil
+	default:
+		return "", ErrInvalid
+	}
+}
+
+// To10 converts a normalized ISBN-13 to its ISBN-10 form. Only ISBNs with
+// the 978 prefix have one.
+func To10(isbn13 string) (string, bool) {
+	if len(isbn13) != 13 || !strings.HasPrefix(isbn13, "978") {
+		return "", false
+	}
+	body := isbn13[3:12]
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return body + "X", true
+	}
+	return body + string(rune('0'+check)), true
+}
+
+// strip removes separators and upper-cases the ISBN-10 check digit.
+func strip(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '-' || r == ' ':
+		case r == 'x':
+			b.WriteRune('X')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func valid10(s string) bool {
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var d int
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			d = int(s[i] - '0')
+		case s[i] == 'X' && i == 9:
+			d = 10
+		default:
+			return false
+		}
+		sum += d * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+func valid13(s string) bool {
+	if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 13; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+		d := int(s[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// to13 converts a valid ISBN-10 to ISBN-13 and recomputes the check digit.
+func to13(isbn10 string) string {
+	body := "978" + isbn10[:9]
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return body + string(rune('0'+(10-sum%10)%10))
+}
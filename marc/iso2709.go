@@ -0,0 +1,193 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+
+	leaderLength   = 24
+	directoryEntry = 12
+	maxRecordSize  = 99999
+	maxFieldSize   = 9999
+)
+
+// ErrMalformed wraps the errors of a record that is not valid ISO 2709.
+// The reader skips such a record and can go on with the next one.
+var ErrMalformed = errors.New("malformed MARC record")
+
+// ErrTooLarge wraps the error of a record that does not fit the lengths of
+// ISO 2709. Nothing of such a record is written.
+var ErrTooLarge = errors.New("record too large for ISO 2709")
+
+// Reader reads ISO 2709 records one at a time.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF after the last one.
+func (rd *Reader) Read() (Record, error) {
+	// Some files put line breaks between records
+	for {
+		b, err := rd.r.Peek(1)
+		if err != nil {
+			return Record{}, err
+		}
+		if b[0] != '\n' && b[0] != '\r' {
+			break
+		}
+		rd.r.Discard(1)
+	}
+
+	head, err := rd.r.Peek(5)
+	if err == io.EOF {
+		return Record{}, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	length, err := strconv.Atoi(string(head))
+	if err != nil || length < leaderLength+2 {
+		// Without a length there is no telling where the next record starts
+		return Record{}, fmt.Errorf("record length %q: %w", head, io.ErrUnexpectedEOF)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(rd.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Record{}, err
+	}
+	return parseRecord(data)
+}
+
+func parseRecord(data []byte) (Record, error) {
+	if data[len(data)-1] != recordTerminator {
+		return Record{}, fmt.Errorf("%w: missing record terminator", ErrMalformed)
+	}
+	leader := string(data[:leaderLength])
+	base, err := strconv.Atoi(leader[12:17])
+	if err != nil || base <= leaderLength || base > len(data) {
+		return Record{}, fmt.Errorf("%w: base address %q", ErrMalformed, leader[12:17])
+	}
+
+	directory := data[leaderLength : base-1]
+	if len(directory)%directoryEntry != 0 || data[base-1] != fieldTerminator {
+		return Record{}, fmt.Errorf("%w: bad directory", ErrMalformed)
+	}
+
+	record := Record{Leader: leader}
+	for i := 0; i < len(directory); i += directoryEntry {
+		entry := directory[i : i+directoryEntry]
+		tag := string(entry[:3])
+		length, err1 := strconv.Atoi(string(entry[3:7]))
+		start, err2 := strconv.Atoi(string(entry[7:12]))
+		if err1 != nil || err2 != nil || length < 1 || start < 0 || base+start+length > len(data) {
+			return Record{}, fmt.Errorf("%w: bad directory entry for %s", ErrMalformed, tag)
+		}
+		if data[base+start+length-1] != fieldTerminator {
+			return Record{}, fmt.Errorf("%w: field %s has no terminator", ErrMalformed, tag)
+		}
+
+		// Drop the field terminator
+		raw := data[base+start : base+start+length-1]
+		field := Field{Tag: tag}
+		if field.IsControl() {
+			field.Value = string(raw)
+		} else {
+			if len(raw) < 2 {
+				return Record{}, fmt.Errorf("%w: field %s has no indicators", ErrMalformed, tag)
+			}
+			field.Ind1, field.Ind2 = raw[0], raw[1]
+			for _, sf := range bytes.Split(raw[2:], []byte{subfieldDelimiter}) {
+				if len(sf) == 0 {
+					continue
+				}
+				field.Subfields = append(field.Subfields, Subfield{Code: sf[0], Value: string(sf[1:])})
+			}
+		}
+		record.Fields = append(record.Fields, field)
+	}
+	return record, nil
+}
+
+// Writer writes ISO 2709 records.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write encodes one record. The record length and base address of the
+// leader are computed.
+func (wr *Writer) Write(r Record) error {
+	var directory, body bytes.Buffer
+	for _, f := range r.Fields {
+		start := body.Len()
+		if f.IsControl() {
+			body.WriteString(f.Value)
+		} else {
+			body.WriteByte(indicator(f.Ind1))
+			body.WriteByte(indicator(f.Ind2))
+			for _, sf := range f.Subfields {
+				body.WriteByte(subfieldDelimiter)
+				body.WriteByte(sf.Code)
+				body.WriteString(sf.Value)
+			}
+		}
+		body.WriteByte(fieldTerminator)
+
+		length := body.Len() - start
+		if length > maxFieldSize {
+			return fmt.Errorf("%w: field %s is %d bytes", ErrTooLarge, f.Tag, length)
+		}
+		fmt.Fprintf(&directory, "%-3.3s%04d%05d", f.Tag, length, start)
+	}
+	directory.WriteByte(fieldTerminator)
+	body.WriteByte(recordTerminator)
+
+	base := leaderLength + directory.Len()
+	total := base + body.Len()
+	if total > maxRecordSize {
+		return fmt.Errorf("%w: record is %d bytes", ErrTooLarge, total)
+	}
+
+	leader := []byte(r.Leader)
+	if len(leader) != leaderLength {
+		leader = []byte(defaultLeader)
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", total))
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+
+	for _, part := range [][]byte{leader, directory.Bytes(), body.Bytes()} {
+		if _, err := wr.w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indicator maps an unset indicator to a blank.
+func indicator(b byte) byte {
+	if b == 0 {
+		return ' '
+	}
+	return b
+}
@@ -0,0 +1,288 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// rawRecord assembles an ISO 2709 record from tag and content pairs without
+// any of the checks of Writer. Each content gets a field terminator.
+func rawRecord(fields ...string) []byte {
+	var directory, body bytes.Buffer
+	for i := 0; i+1 < len(fields); i += 2 {
+		start := body.Len()
+		body.WriteString(fields[i+1])
+		body.WriteByte(fieldTerminator)
+		fmt.Fprintf(&directory, "%-3.3s%04d%05d", fields[i], body.Len()-start, start)
+	}
+	directory.WriteByte(fieldTerminator)
+	body.WriteByte(recordTerminator)
+
+	base := leaderLength + directory.Len()
+	leader := []byte(defaultLeader)
+	copy(leader[0:5], fmt.Sprintf("%05d", base+body.Len()))
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+	return append(append(leader, directory.Bytes()...), body.Bytes()...)
+}
+
+func TestParseRecordMalformed(t *testing.T) {
+	title := "10" + string(rune(subfieldDelimiter)) + "aTitle"
+
+	tests := []struct {
+		name   string
+		data   func() []byte
+		reason string
+	}{
+		{
+			name: "missing record terminator",
+			data: func() []byte {
+				data := rawRecord("001", "1", "245", title)
+				data[len(data)-1] = fieldTerminator
+				return data
+			},
+			reason: "missing record terminator",
+		},
+		{
+			name: "base address not a number",
+			data: func() []byte {
+				data := rawRecord("001", "1")
+				copy(data[12:17], "0003x")
+				return data
+			},
+			reason: "base address",
+		},
+		{
+			name: "base address inside the leader",
+			data: func() []byte {
+				data := rawRecord("001", "1")
+				copy(data[12:17], "00024")
+				return data
+			},
+			reason: "base address",
+		},
+		{
+			name: "base address past the record",
+			data: func() []byte {
+				data := rawRecord("001", "1")
+				copy(data[12:17], "99999")
+				return data
+			},
+			reason: "base address",
+		},
+		{
+			name: "directory cut short",
+			data: func() []byte {
+				data := rawRecord("001", "1")
+				copy(data[12:17], "00036")
+				return data
+			},
+			reason: "bad directory",
+		},
+		{
+			name: "directory without terminator",
+			data: func() []byte {
+				data := rawRecord("001", "1")
+				data[leaderLength+directoryEntry] = ' '
+				return data
+			},
+			reason: "bad directory",
+		},
+		{
+			name: "entry length not a number",
+			data: func() []byte {
+				data := rawRecord("001", "1", "245", title)
+				copy(data[leaderLength+3:leaderLength+7], "00x2")
+				return data
+			},
+			reason: "bad directory entry for 001",
+		},
+		{
+			name: "entry of zero length",
+			data: func() []byte {
+				data := rawRecord("001", "1", "245", title)
+				copy(data[leaderLength+3:leaderLength+7], "0000")
+				return data
+			},
+			reason: "bad directory entry for 001",
+		},
+		{
+			name: "entry past the record",
+			data: func() []byte {
+				data := rawRecord("001", "1", "245", title)
+				entry := leaderLength + directoryEntry
+				copy(data[entry+7:entry+12], "09999")
+				return data
+			},
+			reason: "bad directory entry for 245",
+		},
+		{
+			name: "field without terminator",
+			data: func() []byte {
+				data := rawRecord("001", "12", "245", title)
+				base := leaderLength + 2*directoryEntry + 1
+				data[base+2] = '3'
+				return data
+			},
+			reason: "field 001 has no terminator",
+		},
+		{
+			name: "data field without indicators",
+			data: func() []byte {
+				return rawRecord("001", "1", "245", "")
+			},
+			reason: "field 245 has no indicators",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRecord(tt.data())
+			if !errors.Is(err, ErrMalformed) {
+				t.Fatalf("parseRecord() error = %v, want ErrMalformed", err)
+			}
+			if !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("parseRecord() error = %q, want it to mention %q", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestReaderRecordLength(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "not a number", data: "00x42nam a2200000 i 4500"},
+		{name: "shorter than a leader", data: "00020nam a2200000 i 4500"},
+		{name: "cut off", data: string(rawRecord("001", "1"))[:30]},
+		{name: "cut off in the length", data: "004"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(strings.NewReader(tt.data)).Read()
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("Read() error = %v, want io.ErrUnexpectedEOF", err)
+			}
+		})
+	}
+}
+
+func TestReaderSkipsLineBreaks(t *testing.T) {
+	data := "\r\n" + string(rawRecord("001", "1")) + "\n" + string(rawRecord("001", "2")) + "\n"
+	rd := NewReader(strings.NewReader(data))
+
+	for _, want := range []string{"1", "2"} {
+		r, err := rd.Read()
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if len(r.Fields) != 1 || r.Fields[0].Value != want {
+			t.Errorf("Read() fields = %+v, want 001 %q", r.Fields, want)
+		}
+	}
+	if _, err := rd.Read(); err != io.EOF {
+		t.Errorf("Read() after the last record error = %v, want io.EOF", err)
+	}
+}
+
+func TestWriterTooLarge(t *testing.T) {
+	// Each author field fits, twelve of them do not
+	authors := make([]string, 12)
+	for i := range authors {
+		authors[i] = strings.Repeat("x", 9000)
+	}
+
+	tests := []struct {
+		name   string
+		record Record
+		reason string
+	}{
+		{
+			name:   "field",
+			record: NewRecord(Book{Title: "Title", Description: strings.Repeat("x", maxFieldSize)}),
+			reason: "field 520",
+		},
+		{
+			name:   "record",
+			record: NewRecord(Book{Title: "Title", Authors: authors}),
+			reason: "record is",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := NewWriter(&buf).Write(tt.record)
+			if !errors.Is(err, ErrTooLarge) {
+				t.Fatalf("Write() error = %v, want ErrTooLarge", err)
+			}
+			if !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("Write() error = %q, want it to mention %q", err, tt.reason)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("Write() wrote %d bytes of a record too large", buf.Len())
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	book := Book{
+		ID:            42,
+		Title:         "Charlotte's Web",
+		Description:   "A pig is saved by a spider.",
+		ISBN:          "9780064400558",
+		Edition:       "1st ed.",
+		Publisher:     "Harper & Brothers",
+		PublishedYear: 1952,
+		Authors:       []string{"White, E. B.", "Williams, Garth"},
+	}
+	// Control numbers are not read back
+	want := book
+	want.ID = 0
+
+	tests := []struct {
+		name  string
+		write func(io.Writer, Record) error
+		read  func(io.Reader) (Record, error)
+	}{
+		{
+			name:  "ISO 2709",
+			write: func(w io.Writer, r Record) error { return NewWriter(w).Write(r) },
+			read:  func(r io.Reader) (Record, error) { return NewReader(r).Read() },
+		},
+		{
+			name: "MARCXML",
+			write: func(w io.Writer, r Record) error {
+				xw := NewXMLWriter(w)
+				if err := xw.Write(r); err != nil {
+					return err
+				}
+				return xw.Close()
+			},
+			read: func(r io.Reader) (Record, error) { return NewXMLReader(r).Read() },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.write(&buf, NewRecord(book)); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			r, err := tt.read(&buf)
+			if err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if got := r.Book(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Book() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package marc
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Namespace is the MARCXML namespace.
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// XMLReader reads the records of a MARCXML collection one at a time.
+type XMLReader struct {
+	d *xml.Decoder
+}
+
+// NewXMLReader returns an XMLReader reading from r.
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{d: xml.NewDecoder(r)}
+}
+
+// Read returns the next record, or io.EOF after the last one. A record
+// that is not valid MARC is reported with ErrMalformed and skipped. XML
+// that is not well-formed ends the reading, as no record after it can be
+// found.
+func (rd *XMLReader) Read() (Record, error) {
+	for {
+		tok, err := rd.d.Token()
+		if err != nil {
+			return Record{}, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		var x xmlRecord
+		if err := rd.d.DecodeElement(&x, &start); err != nil {
+			// The next Read looks for the next record element
+			var unmarshal xml.UnmarshalError
+			if errors.As(err, &unmarshal) {
+				return Record{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+			}
+			return Record{}, err
+		}
+		return x.record()
+	}
+}
+
+func (x xmlRecord) record() (Record, error) {
+	r := Record{Leader: x.Leader}
+	// MARCXML keeps control fields before data fields, as ISO 2709 does
+	for _, cf := range x.ControlFields {
+		r.Fields = append(r.Fields, Field{Tag: cf.Tag, Value: cf.Value})
+	}
+	for _, df := range x.DataFields {
+		if len(df.Tag) != 3 {
+			return Record{}, fmt.Errorf("%w: datafield tag %q", ErrMalformed, df.Tag)
+		}
+		f := Field{Tag: df.Tag, Ind1: firstByte(df.Ind1), Ind2: firstByte(df.Ind2)}
+		for _, sf := range df.Subfields {
+			if len(sf.Code) != 1 {
+				return Record{}, fmt.Errorf("%w: subfield code %q in %s", ErrMalformed, sf.Code, df.Tag)
+			}
+			f.Subfields = append(f.Subfields, Subfield{Code: sf.Code[0], Value: sf.Value})
+		}
+		r.Fields = append(r.Fields, f)
+	}
+	return r, nil
+}
+
+func firstByte(s string) byte {
+	if s == "" {
+		return ' '
+	}
+	return s[0]
+}
+
+// XMLWriter writes records as a MARCXML collection. Close must be called
+// to end the collection.
+type XMLWriter struct {
+	w       io.Writer
+	e       *xml.Encoder
+	started bool
+}
+
+// NewXMLWriter returns an XMLWriter writing to w.
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	return &XMLWriter{w: w, e: xml.NewEncoder(w)}
+}
+
+func (wr *XMLWriter) start() error {
+	if wr.started {
+		return nil
+	}
+	wr.started = true
+	_, err := fmt.Fprintf(wr.w, "%s<collection xmlns=%q>\n", xml.Header, Namespace)
+	return err
+}
+
+// Write encodes one record.
+func (wr *XMLWriter) Write(r Record) error {
+	if err := wr.start(); err != nil {
+		return err
+	}
+
+	x := xmlRecord{Leader: r.Leader}
+	for _, f := range r.Fields {
+		if f.IsControl() {
+			x.ControlFields = append(x.ControlFields, xmlControlField{Tag: f.Tag, Value: f.Value})
+			continue
+		}
+		df := xmlDataField{Tag: f.Tag, Ind1: string(indicator(f.Ind1)), Ind2: string(indicator(f.Ind2))}
+		for _, sf := range f.Subfields {
+			df.Subfields = append(df.Subfields, xmlSubfield{Code: string(sf.Code), Value: sf.Value})
+		}
+		x.DataFields = append(x.DataFields, df)
+	}
+
+	if err := wr.e.Encode(x); err != nil {
+		return err
+	}
+	_, err := io.WriteString(wr.w, "\n")
+	return err
+}
+
+// Close ends the collection. It writes an empty collection when no record
+// was written.
+func (wr *XMLWriter) Close() error {
+	if err := wr.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(wr.w, "</collection>\n")
+	return err
+}
@@ -0,0 +1,253 @@
+// Package marc reads and writes MARC21 bibliographic records, both in the
+// ISO 2709 exchange format (.mrc) and as MARCXML, and maps them onto books.
+//
+// Only the fields the catalog keeps are mapped: 020 ISBN, 100 and 700
+// personal names, 245 title, 250 edition, 264 (or 260) publisher and date of
+// publication, and 520 summary. Records are expected to be
+// Unicode (leader position 09 = "a"); MARC-8 data is read as is.
+package marc
+
+import (
+	"app/isbn"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Record is a MARC record: a 24 character leader followed by its fields in
+// file order.
+type Record struct {
+	Leader string
+	Fields []Field
+}
+
+// Field is a control field (tag 001-009, Value only) or a data field with
+// two indicators and a list of subfields.
+type Field struct {
+	Tag       string
+	Value     string
+	Ind1      byte
+	Ind2      byte
+	Subfields []Subfield
+}
+
+// Subfield is one coded piece of a data field, such as $a.
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// IsControl reports whether the field is a control field.
+func (f Field) IsControl() bool {
+	return strings.HasPrefix(f.Tag, "00")
+}
+
+// Subfield returns the first subfield with the given code.
+func (f Field) Subfield(code byte) (string, bool) {
+	for _, sf := range f.Subfields {
+		if sf.Code == code {
+			return sf.Value, true
+		}
+	}
+	return "", false
+}
+
+// FieldsByTag returns every field with the given tag.
+func (r Record) FieldsByTag(tag string) []Field {
+	var fields []Field
+	for _, f := range r.Fields {
+		if f.Tag == tag {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Book is the part of a bibliographic record the catalog stores.
+type Book struct {
+	// ID is written as the 001 control number. It is not read back: control
+	// numbers of other catalogs mean nothing here.
+	ID          int32
+	Title       string
+	Description string
+	ISBN        string
+	Edition     string
+	Publisher   string
+	// PublishedYear is 0 when unknown.
+	PublishedYear int
+	// Authors in record order: the 100 main entry first, then the 700s.
+	Authors []string
+}
+
+// defaultLeader is the leader of exported records: new, language material,
+// monograph, Unicode. The length and base address are filled in on write.
+const defaultLeader = "00000nam a2200000 i 4500"
+
+// NewRecord builds the MARC record of a book. The book ID becomes the 001
+// control number.
+func NewRecord(b Book) Record {
+	r := Record{Leader: defaultLeader}
+	if b.ID != 0 {
+		r.Fields = append(r.Fields, Field{Tag: "001", Value: fmt.Sprint(b.ID)})
+	}
+	if b.ISBN != "" {
+		r.Fields = append(r.Fields, dataField("020", ' ', ' ', 'a', b.ISBN))
+	}
+
+	// 245 first indicator: 1 when there is a 1XX main entry
+	titleInd1 := byte('0')
+	if len(b.Authors) > 0 {
+		r.Fields = append(r.Fields, dataField("100", '1', ' ', 'a', b.Authors[0]))
+		titleInd1 = '1'
+	}
+	r.Fields = append(r.Fields, dataField("245", titleInd1, '0', 'a', b.Title))
+	if b.Edition != "" {
+		r.Fields = append(r.Fields, dataField("250", ' ', ' ', 'a', b.Edition))
+	}
+	if b.Publisher != "" || b.PublishedYear != 0 {
+		// 264 second indicator 1: publication
+		f := Field{Tag: "264", Ind1: ' ', Ind2: '1'}
+		if b.Publisher != "" {
+			f.Subfields = append(f.Subfields, Subfield{Code: 'b', Value: b.Publisher})
+		}
+		if b.PublishedYear != 0 {
+			f.Subfields = append(f.Subfields, Subfield{Code: 'c', Value: fmt.Sprint(b.PublishedYear)})
+		}
+		r.Fields = append(r.Fields, f)
+	}
+	if b.Description != "" {
+		r.Fields = append(r.Fields, dataField("520", ' ', ' ', 'a', b.Description))
+	}
+	if len(b.Authors) > 1 {
+		for _, author := range b.Authors[1:] {
+			r.Fields = append(r.Fields, dataField("700", '1', ' ', 'a', author))
+		}
+	}
+	return r
+}
+
+func dataField(tag string, ind1, ind2 byte, code byte, value string) Field {
+	return Field{Tag: tag, Ind1: ind1, Ind2: ind2, Subfields: []Subfield{{Code: code, Value: value}}}
+}
+
+// Book maps the record onto a book. ISBD punctuation at the end of titles
+// and names is dropped.
+func (r Record) Book() Book {
+	var b Book
+
+	for _, f := range r.FieldsByTag("020") {
+		value, ok := f.Subfield('a')
+		if !ok {
+			continue
+		}
+		// "0306406152 (pbk.)": the number comes first
+		number := strings.Fields(value)
+		if len(number) == 0 {
+			continue
+		}
+		if b.ISBN == "" {
+			b.ISBN = number[0]
+		}
+		if _, err := isbn.Normalize(number[0]); err == nil {
+			b.ISBN = number[0]
+			break
+		}
+	}
+
+	for _, f := range r.FieldsByTag("245") {
+		title, _ := f.Subfield('a')
+		title = trimISBD(title)
+		if subtitle, ok := f.Subfield('b'); ok && trimISBD(subtitle) != "" {
+			title += ": " + trimISBD(subtitle)
+		}
+		b.Title = title
+		break
+	}
+
+	for _, f := range r.FieldsByTag("250") {
+		if edition, ok := f.Subfield('a'); ok {
+			// Edition statements end in abbreviations, "2nd ed."
+			b.Edition = strings.TrimRight(strings.TrimSpace(edition), " /:;,=")
+			break
+		}
+	}
+
+	// Older records carry the imprint in 260 rather than 264
+	imprints := append(r.FieldsByTag("264"), r.FieldsByTag("260")...)
+	for _, f := range imprints {
+		if f.Tag == "264" && f.Ind2 != '1' {
+			continue
+		}
+		if publisher, ok := f.Subfield('b'); ok {
+			b.Publisher = trimISBD(publisher)
+		}
+		if date, ok := f.Subfield('c'); ok {
+			b.PublishedYear = year(date)
+		}
+		break
+	}
+
+	for _, f := range r.FieldsByTag("520") {
+		if summary, ok := f.Subfield('a'); ok {
+			b.Description = strings.TrimSpace(summary)
+			break
+		}
+	}
+
+	for _, tag := range []string{"100", "700"} {
+		for _, f := range r.FieldsByTag(tag) {
+			if name, ok := f.Subfield('a'); ok && trimISBD(name) != "" {
+				b.Authors = append(b.Authors, trimISBD(name))
+			}
+		}
+	}
+
+	return b
+}
+
+// year returns the first four digit number of a date of publication such as
+// "c1998." or "[2004?]", or 0 when there is none.
+func year(date string) int {
+	for i := 0; i+4 <= len(date); i++ {
+		if i > 0 && isDigit(date[i-1]) {
+			continue
+		}
+		digits := date[i : i+4]
+		if strings.IndexFunc(digits, func(c rune) bool { return c < '0' || c > '9' }) >= 0 {
+			continue
+		}
+		if i+4 < len(date) && isDigit(date[i+4]) {
+			continue
+		}
+		n, _ := strconv.Atoi(digits)
+		return n
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// trimISBD removes the trailing punctuation that separates MARC subfields,
+// e.g. "Twain, Mark," or "Adventures of Huckleberry Finn /".
+func trimISBD(s string) string {
+	s = strings.TrimSpace(s)
+	for len(s) > 0 {
+		last := s[len(s)-1]
+		if !strings.ContainsRune(" /:;,=", rune(last)) && !(last == '.' && !abbreviation(s)) {
+			break
+		}
+		s = strings.TrimSpace(s[:len(s)-1])
+	}
+	return s
+}
+
+// abbreviation reports whether a trailing period belongs to an initial,
+// as in "White, E. B.", rather than being punctuation.
+func abbreviation(s string) bool {
+	if len(s) < 3 {
+		return false
+	}
+	return s[len(s)-3] == ' ' || s[len(s)-3] == '.'
+}
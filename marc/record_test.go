@@ -0,0 +1,121 @@
+package marc
+
+import "testing"
+
+func TestTrimISBD(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "", want: ""},
+		{in: "Twain, Mark,", want: "Twain, Mark"},
+		{in: "Adventures of Huckleberry Finn /", want: "Adventures of Huckleberry Finn"},
+		{in: "  New York : ", want: "New York"},
+		{in: "Knopf ;", want: "Knopf"},
+		{in: "Title =", want: "Title"},
+		{in: "Penguin Books.", want: "Penguin Books"},
+		{in: "Penguin Books, .", want: "Penguin Books"},
+		// Periods of initials stay
+		{in: "White, E. B.", want: "White, E. B."},
+		{in: "Tolkien, J.R.R.", want: "Tolkien, J.R.R."},
+		{in: "Smith, J.,", want: "Smith, J."},
+		{in: "A.", want: "A"},
+	}
+
+	for _, tt := range tests {
+		if got := trimISBD(tt.in); got != tt.want {
+			t.Errorf("trimISBD(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestYear(t *testing.T) {
+	tests := []struct {
+		date string
+		want int
+	}{
+		{date: "1998", want: 1998},
+		{date: "c1998.", want: 1998},
+		{date: "[2004?]", want: 2004},
+		{date: "p1987, c1990.", want: 1987},
+		{date: "1999-2001.", want: 1999},
+		{date: "©2015", want: 2015},
+		{date: "", want: 0},
+		{date: "n.d.", want: 0},
+		{date: "[19--]", want: 0},
+		{date: "199", want: 0},
+		{date: "12345", want: 0},
+		{date: "12345 2010", want: 2010},
+	}
+
+	for _, tt := range tests {
+		if got := year(tt.date); got != tt.want {
+			t.Errorf("year(%q) = %d, want %d", tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestBookImprint(t *testing.T) {
+	imprint := func(tag string, ind2 byte, publisher, date string) Field {
+		return Field{Tag: tag, Ind1: ' ', Ind2: ind2, Subfields: []Subfield{
+			{Code: 'a', Value: "New York :"},
+			{Code: 'b', Value: publisher},
+			{Code: 'c', Value: date},
+		}}
+	}
+
+	tests := []struct {
+		name          string
+		fields        []Field
+		wantPublisher string
+		wantYear      int
+	}{
+		{
+			name:          "264 publication",
+			fields:        []Field{imprint("264", '1', "Knopf,", "2015.")},
+			wantPublisher: "Knopf",
+			wantYear:      2015,
+		},
+		{
+			name:          "260 only",
+			fields:        []Field{imprint("260", ' ', "Harper,", "c1952.")},
+			wantPublisher: "Harper",
+			wantYear:      1952,
+		},
+		{
+			name: "264 before 260",
+			fields: []Field{
+				imprint("260", ' ', "Harper,", "1952."),
+				imprint("264", '1', "Knopf,", "2015."),
+			},
+			wantPublisher: "Knopf",
+			wantYear:      2015,
+		},
+		{
+			name: "264 other than publication falls back to 260",
+			fields: []Field{
+				imprint("264", '4', "", "©2016"),
+				imprint("260", ' ', "Harper,", "1952."),
+			},
+			wantPublisher: "Harper",
+			wantYear:      1952,
+		},
+		{
+			name:   "264 other than publication only",
+			fields: []Field{imprint("264", '3', "Printer,", "2016.")},
+		},
+		{
+			name: "no imprint",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Record{Leader: defaultLeader, Fields: tt.fields}.Book()
+			if b.Publisher != tt.wantPublisher || b.PublishedYear != tt.wantYear {
+				t.Errorf("Book() publisher, year = %q, %d, want %q, %d",
+					b.Publisher, b.PublishedYear, tt.wantPublisher, tt.wantYear)
+			}
+		})
+	}
+}
@@ -1,12 +1,23 @@
 package test
 
 import (
+	"app/database/adaptor"
 	"app/database/db"
+	"app/handler"
+	"app/importer"
+	"app/isbn"
+	"app/marc"
+	"bufio"
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"strings"
 	"testing"
@@ -169,114 +180,1372 @@ func (suite *APITestSuite) TestAddNewBookAsAdminAPI() {
 	defer resp.Body.Close()
 }
 
-// Borrow and return books API tests
-// 1. Get book copy count before borowing
-// 2. Borrow book 3 times
-// 3. Now the book count is cntBeforeBrrow - 3
-// 4. Return book 3 times
-// 5. Now the book count is cntBeforeBrrow
-func (suite *APITestSuite) TestBorrowReturnBookAPIs() {
-	// === Test Borrowing Books APIs
-	// Get available book count
-	book := suite.getBooksByID(2)
-	cntBeforeBrrow := book.NumCopy
-	suite.T().Log("cntBeforeBrrow = ", cntBeforeBrrow)
+// Create a book with an existing and a new author, then drop one of them.
+func (suite *APITestSuite) TestMultiAuthorBookAPI() {
+	reqBody := []byte(`{
+		"title": "The Elements of Style",
+		"description": "A style guide",
+		"copies": 2,
+		"authors": [{"id": 5}, {"name": "E. B. White", "bio": "American writer"}]
+	}`)
+	req, err := http.NewRequest("POST", "http://localhost:8080/admin/books", bytes.NewBuffer(reqBody))
+	suite.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
 
-	// // Borrow book 3 times
-	for i := 0; i < 3; i++ {
-		// To avoid too many requests rate limiting
+	var bookID int
+	_, err = fmt.Sscanf(resp.Header.Get("Location"), "/books/%d", &bookID)
+	suite.NoError(err)
+
+	book := suite.getBooksByID(bookID)
+	suite.Equal(2, len(book.Authors))
+
+	// Remove the existing author (Mark Twain) again
+	req, err = http.NewRequest("DELETE", fmt.Sprintf("http://localhost:8080/admin/books/%d/authors/5", bookID), nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err = suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	book = suite.getBooksByID(bookID)
+	suite.Equal(1, len(book.Authors))
+	suite.Equal("E. B. White", book.Authors[0].Name)
+}
+
+// A book added with an ISBN-10 can be found by both its ISBN-10 and ISBN-13,
+// and the same ISBN cannot be added twice.
+func (suite *APITestSuite) TestBookISBNAPI() {
+	isbn10 := suite.newISBN10()
+	addBook := func(isbn string) *http.Response {
+		reqBody := []byte(fmt.Sprintf(`{"title": "ISBN test", "copies": 1, "authors": [{"id": 5}], "isbn": "%s"}`, isbn))
+		req, err := http.NewRequest("POST", "http://localhost:8080/admin/books", bytes.NewBuffer(reqBody))
+		suite.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+suite.adminToken)
 		time.Sleep(1 * time.Second)
-		// UserID = 1, BookID = 2
-		req, err := http.NewRequest("POST", "http://localhost:8080/books/borrow/1/2", nil)
+		resp, err := suite.client.Do(req)
 		suite.NoError(err)
+		resp.Body.Close()
+		return resp
+	}
 
-		req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	resp := addBook(isbn10)
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+	var bookID int32
+	_, err := fmt.Sscanf(resp.Header.Get("Location"), "/books/%d", &bookID)
+	suite.NoError(err)
+
+	// Same ISBN again, written as ISBN-13
+	isbn13, err := isbn.Normalize(isbn10)
+	suite.NoError(err)
+	suite.Equal(http.StatusConflict, addBook(isbn13).StatusCode)
+
+	// Wrong check digit
+	bad := isbn13[:12] + string(rune('0'+(isbn13[12]-'0'+1)%10))
+	suite.Equal(http.StatusBadRequest, addBook(bad).StatusCode)
+
+	for _, value := range []string{isbn10, isbn13} {
+		book := suite.getBookByISBN(value)
+		suite.Equal(bookID, book.ID)
+		suite.Equal(isbn13, book.Isbn.String)
+		suite.Equal(isbn10, book.Isbn10)
+	}
+}
+
+// newISBN10 makes an ISBN-10 that is not in the catalog yet.
+func (suite *APITestSuite) newISBN10() string {
+	body := fmt.Sprintf("%09d", time.Now().UnixNano()%1000000000)
+	for _, check := range "0123456789X" {
+		if _, err := isbn.Normalize(body + string(check)); err == nil {
+			return body + string(check)
+		}
+	}
+	suite.FailNow("no valid check digit")
+	return ""
+}
+
+// Importing the same NDJSON file twice creates the books once, and bad rows
+// are reported with their line number.
+func (suite *APITestSuite) TestImportBooksAPI() {
+	isbn10 := suite.newISBN10()
+	body := fmt.Sprintf(`{"title": "Imported book", "isbn": "%s", "copies": 2, "authors": ["Mark Twain"]}
+{"title": "", "authors": ["Mark Twain"]}
+not json
+`, isbn10)
+
+	importBooks := func() importer.Report {
+		req, err := http.NewRequest("POST", "http://localhost:8080/admin/books/import", strings.NewReader(body))
+		suite.NoError(err)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+		time.Sleep(1 * time.Second)
 		resp, err := suite.client.Do(req)
 		suite.NoError(err)
+		defer resp.Body.Close()
 		suite.Equal(http.StatusOK, resp.StatusCode)
+
+		var report importer.Report
+		suite.NoError(json.NewDecoder(resp.Body).Decode(&report))
+		return report
 	}
 
-	// Get available book count after borrowing
-	book = suite.getBooksByID(2)
-	cntAfterBorrow := book.NumCopy
-	suite.Equal(cntBeforeBrrow-3, cntAfterBorrow)
+	report := importBooks()
+	suite.Equal(1, report.Created)
+	suite.Equal(2, report.Failed)
+	suite.Equal(2, report.Errors[0].Line)
+	suite.Equal(3, report.Errors[1].Line)
 
-	// Check User's borrowed book count
-	req, err := http.NewRequest("GET", "http://localhost:8080/users/1/books", nil)
+	report = importBooks()
+	suite.Equal(0, report.Created)
+	suite.Equal(1, report.Updated)
+
+	book := suite.getBookByISBN(isbn10)
+	suite.Equal(int32(2), book.TotalCopies)
+
+	// A row matching an archived book fails and leaves the book alone
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("http://localhost:8080/admin/books/%d", book.ID), nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	req.Header.Set("If-Match", "*")
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
 	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
 
-	req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	body = fmt.Sprintf(`{"title": "Imported book, archived", "isbn": "%s", "authors": ["Mark Twain"]}
+`, isbn10)
+	report = importBooks()
+	suite.Equal(0, report.Created)
+	suite.Equal(0, report.Updated)
+	suite.Equal(1, report.Failed)
+	suite.Equal(1, report.Errors[0].Line)
+}
+
+// A MARCXML record is imported through the import endpoint and comes back
+// from the MARC export with the same fields.
+func (suite *APITestSuite) TestMARCImportExportAPI() {
+	isbn10 := suite.newISBN10()
+	var in bytes.Buffer
+	xw := marc.NewXMLWriter(&in)
+	suite.NoError(xw.Write(marc.NewRecord(marc.Book{
+		Title:       "MARC test",
+		Description: "Imported from MARCXML",
+		ISBN:        isbn10,
+		Authors:     []string{"Mark Twain", "E. B. White"},
+	})))
+	suite.NoError(xw.Close())
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/admin/books/import?format=marcxml", &in)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	var report importer.Report
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&report))
+	resp.Body.Close()
+	suite.Equal(1, report.Created+report.Updated)
+	suite.Equal(0, report.Failed)
+
+	book := suite.getBookByISBN(isbn10)
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("http://localhost:8080/admin/export/marc?ids=%d", book.ID), nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err = suite.client.Do(req)
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	record, err := marc.NewReader(resp.Body).Read()
+	suite.NoError(err)
+	exported := record.Book()
+	suite.Equal("MARC test", exported.Title)
+	suite.Equal(book.Isbn.String, exported.ISBN)
+	suite.ElementsMatch([]string{"Mark Twain", "E. B. White"}, exported.Authors)
+}
+
+// A book filed under a child subject is listed when filtering by the parent,
+// and a subject cannot be moved under its own child.
+func (suite *APITestSuite) TestSubjectsAPI() {
+	suffix := time.Now().UnixNano()
+	parent := suite.createSubject(fmt.Sprintf("Fiction %d", suffix), 0)
+	child := suite.createSubject("Science Fiction", parent.ID)
+
+	reqBody := []byte(fmt.Sprintf(`{"subject_ids": [%d]}`, child.ID))
+	req, err := http.NewRequest("POST", "http://localhost:8080/admin/books/4/subjects", bytes.NewBuffer(reqBody))
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
 	resp, err := suite.client.Do(req)
 	suite.NoError(err)
 	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	page := suite.listBooks(fmt.Sprintf("subject_id=%d", parent.ID))
+	suite.Equal(1, len(page.Books))
+	suite.Equal(int32(4), page.Books[0].ID)
+
+	// Fiction under Science Fiction would be a cycle
+	reqBody = []byte(fmt.Sprintf(`{"name": "Fiction %d", "parent_id": %d}`, suffix, child.ID))
+	req, err = http.NewRequest("PUT", fmt.Sprintf("http://localhost:8080/admin/subjects/%d", parent.ID), bytes.NewBuffer(reqBody))
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err = suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	// Subjects with books cannot be deleted
+	req, err = http.NewRequest("DELETE", fmt.Sprintf("http://localhost:8080/admin/subjects/%d", child.ID), nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err = suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func (suite *APITestSuite) createSubject(name string, parentID int32) db.Subject {
+	reqBody := []byte(fmt.Sprintf(`{"name": "%s", "parent_id": %d}`, name, parentID))
+	req, err := http.NewRequest("POST", "http://localhost:8080/admin/subjects", bytes.NewBuffer(reqBody))
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
 	defer resp.Body.Close()
+	suite.Equal(http.StatusCreated, resp.StatusCode)
 
-	var borrowedBooks []db.ListBorrowedBooksRow
-	err = json.NewDecoder(resp.Body).Decode(&borrowedBooks)
+	var subject db.Subject
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&subject))
+	return subject
+}
+
+// Editions of one work share its authors.
+func (suite *APITestSuite) TestWorksEditionsAPI() {
+	first := suite.addBook(`{"title": "Works test", "edition": "1st ed.", "published_year": 1990, "authors": [{"id": 5}]}`)
+	workID := suite.getBooksByID(int(first)).WorkID
+	second := suite.addBook(fmt.Sprintf(`{"title": "Works test", "edition": "2nd ed.", "published_year": 2005, "work_id": %d}`, workID))
+
+	secondBook := suite.getBooksByID(int(second))
+	suite.Equal(workID, secondBook.WorkID)
+	suite.Equal(1, len(secondBook.Authors))
+	suite.Equal(int32(5), secondBook.Authors[0].ID)
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:8080/works/%d", workID), nil)
 	suite.NoError(err)
-	// There are 3 borrowed books
-	suite.Equal(3, len(borrowedBooks))
+	req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
 
-	// === Test Returning Books APIs
-	// Return book 3 times
-	for i := 0; i < 3; i++ {
-		// To avoid too many requests rate limiting
+	var work adaptor.WorkDetail
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&work))
+	suite.Equal(2, len(work.Editions))
+	suite.Equal(first, work.Editions[0].ID)
+	suite.Equal(second, work.Editions[1].ID)
+}
+
+// addBook creates a book from a JSON request body and returns its ID.
+func (suite *APITestSuite) addBook(body string) int32 {
+	req, err := http.NewRequest("POST", "http://localhost:8080/admin/books", bytes.NewBufferString(body))
+	suite.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+
+	var bookID int32
+	_, err = fmt.Sscanf(resp.Header.Get("Location"), "/books/%d", &bookID)
+	suite.NoError(err)
+	return bookID
+}
+
+// Deleted books are archived: hidden and not borrowable until restored.
+func (suite *APITestSuite) TestArchiveRestoreBookAPI() {
+	bookID := suite.addBook(`{"title": "Archive test", "copies": 1, "authors": [{"id": 5}]}`)
+
+	do := func(method, url, token string) int {
+		req, err := http.NewRequest(method, url, nil)
+		suite.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("If-Match", "*")
 		time.Sleep(1 * time.Second)
-		// UserID = 1, BookID = 2
-		req, err := http.NewRequest("POST", "http://localhost:8080/books/return/1/2", nil)
+		resp, err := suite.client.Do(req)
 		suite.NoError(err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	bookURL := fmt.Sprintf("http://localhost:8080/books/%d", bookID)
 
-		req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	suite.Equal(http.StatusOK, do("DELETE", fmt.Sprintf("http://localhost:8080/admin/books/%d", bookID), suite.adminToken))
+	suite.Equal(http.StatusNotFound, do("GET", bookURL, suite.userToken))
+	suite.Equal(http.StatusConflict, do("POST", fmt.Sprintf("http://localhost:8080/books/borrow/1/%d", bookID), suite.userToken))
+
+	// Nor does it take new copies
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:8080/admin/books/%d/copies", bookID), bytes.NewBufferString(`{"condition": "new"}`))
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusNotFound, resp.StatusCode)
+
+	suite.Equal(http.StatusOK, do("POST", fmt.Sprintf("http://localhost:8080/admin/books/%d/restore", bookID), suite.adminToken))
+	suite.Equal(http.StatusOK, do("GET", bookURL, suite.userToken))
+	// Restoring twice finds nothing to restore
+	suite.Equal(http.StatusNotFound, do("POST", fmt.Sprintf("http://localhost:8080/admin/books/%d/restore", bookID), suite.adminToken))
+}
+
+// Edits are recorded field by field and can be reverted.
+func (suite *APITestSuite) TestBookHistoryAPI() {
+	bookID := suite.addBook(`{"title": "History test", "description": "First", "authors": [{"id": 5}]}`)
+
+	send := func(method, url, body string) *http.Response {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		suite.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+		req.Header.Set("If-Match", "*")
+		time.Sleep(1 * time.Second)
 		resp, err := suite.client.Do(req)
 		suite.NoError(err)
+		return resp
+	}
+	history := func() []adaptor.BookRevision {
+		resp := send("GET", fmt.Sprintf("http://localhost:8080/admin/books/%d/history", bookID), "")
+		defer resp.Body.Close()
 		suite.Equal(http.StatusOK, resp.StatusCode)
+		var revisions []adaptor.BookRevision
+		suite.NoError(json.NewDecoder(resp.Body).Decode(&revisions))
+		return revisions
 	}
 
-	time.Sleep(1 * time.Second)
-	// Get available book count after returning
-	book = suite.getBooksByID(2)
-	cntAfterReturn := book.NumCopy
-	suite.Equal(cntAfterBorrow+3, cntAfterReturn)
+	resp := send("PUT", fmt.Sprintf("http://localhost:8080/admin/books/%d", bookID),
+		`{"title": "History test, revised", "description": "First"}`)
+	resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
 
-	// Check User's borrowed book count
-	req, err = http.NewRequest("GET", "http://localhost:8080/users/1/books", nil)
-	suite.NoError(err)
+	revisions := history()
+	suite.Equal(1, len(revisions))
+	suite.Equal("admin@example.com", revisions[0].ChangedBy)
+	suite.Equal(1, len(revisions[0].Changes))
+	suite.JSONEq(`"History test"`, string(revisions[0].Changes["title"].Old))
 
-	req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	revertURL := fmt.Sprintf("http://localhost:8080/admin/books/%d/history/0/revert", bookID)
+	req, err := http.NewRequest("POST", revertURL, nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
 	time.Sleep(1 * time.Second)
 	resp, err = suite.client.Do(req)
 	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusPreconditionRequired, resp.StatusCode)
+
+	resp = send("POST", revertURL, "")
+	resp.Body.Close()
 	suite.Equal(http.StatusOK, resp.StatusCode)
-	defer resp.Body.Close()
+	suite.NotEmpty(resp.Header.Get("ETag"))
+	suite.Equal("History test", suite.getBooksByID(int(bookID)).Title)
+	suite.Equal(int32(2), history()[0].Revision)
+}
 
-	err = json.NewDecoder(resp.Body).Decode(&borrowedBooks)
-	suite.NoError(err)
-	// There are 0 borrowed books
-	suite.Equal(0, len(borrowedBooks))
+// A merge patch changes only the fields it contains.
+func (suite *APITestSuite) TestPatchBookAPI() {
+	bookID := suite.addBook(`{"title": "Patch test", "description": "Before", "edition": "1st ed.", "copies": 2, "authors": [{"id": 5}]}`)
+	url := fmt.Sprintf("http://localhost:8080/admin/books/%d", bookID)
 
-	// After returning all books, the book count should be the original count
-	time.Sleep(1 * time.Second)
-	book = suite.getBooksByID(2)
-	suite.Equal(cntBeforeBrrow, book.NumCopy)
+	patch := func(contentType, body string) int {
+		req, err := http.NewRequest("PATCH", url, bytes.NewBufferString(body))
+		suite.NoError(err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+		req.Header.Set("If-Match", "*")
+		time.Sleep(1 * time.Second)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	suite.Equal(http.StatusOK, patch(handler.MergePatchType, `{"description": "After", "edition": null}`))
+	book := suite.getBooksByID(int(bookID))
+	suite.Equal("Patch test", book.Title)
+	suite.Equal("After", book.Description)
+	suite.Equal("", book.Edition)
+	suite.Equal(int32(2), book.TotalCopies)
+
+	suite.Equal(http.StatusBadRequest, patch(handler.MergePatchType, `{"title": null}`))
+	suite.Equal(http.StatusBadRequest, patch(handler.MergePatchType, `{"published_year": "soon"}`))
+	suite.Equal(http.StatusBadRequest, patch(handler.MergePatchType, `{"num_copy": 0}`))
+	suite.Equal(http.StatusUnsupportedMediaType, patch("text/plain", `{"title": "x"}`))
+	suite.Equal("Patch test", suite.getBooksByID(int(bookID)).Title)
 }
 
-func (suite *APITestSuite) getBooksByID(bookID int) db.GetBookWithAuthorsByIDRow {
-	// Get current borrowed book for bookID
-	url := fmt.Sprintf("http://localhost:8080/books/%d", bookID)
+// Changes to a book must be made against its current ETag.
+func (suite *APITestSuite) TestBookETagAPI() {
+	bookID := suite.addBook(`{"title": "ETag test", "authors": [{"id": 5}]}`)
+	url := fmt.Sprintf("http://localhost:8080/admin/books/%d", bookID)
 
-	req, err := http.NewRequest("GET", url, nil)
+	send := func(method, url, ifMatch, body string) *http.Response {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		suite.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		time.Sleep(1 * time.Second)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := send("GET", fmt.Sprintf("http://localhost:8080/books/%d", bookID), "", "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	suite.NotEmpty(etag)
+
+	resp = send("PUT", url, "", `{"title": "ETag test, revised"}`)
+	suite.Equal(http.StatusPreconditionRequired, resp.StatusCode)
+
+	// If-Match compares strongly
+	resp = send("PUT", url, "W/"+etag, `{"title": "ETag test, revised"}`)
+	suite.Equal(http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp = send("PATCH", url, etag, `{"title": "ETag test, revised"}`)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	newETag := resp.Header.Get("ETag")
+	suite.NotEqual(etag, newETag)
+
+	// The other librarian still holds the old version
+	resp = send("PUT", url, etag, `{"title": "ETag test, overwritten"}`)
+	suite.Equal(http.StatusPreconditionFailed, resp.StatusCode)
+	resp = send("DELETE", url, etag, "")
+	suite.Equal(http.StatusPreconditionFailed, resp.StatusCode)
+	suite.Equal("ETag test, revised", suite.getBooksByID(int(bookID)).Title)
+
+	resp = send("DELETE", url, newETag, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+}
+
+// Uploaded covers are served as thumbnails that clients can revalidate.
+func (suite *APITestSuite) TestBookCoverAPI() {
+	bookID := suite.addBook(`{"title": "Cover test", "authors": [{"id": 5}]}`)
+	coverURL := fmt.Sprintf("http://localhost:8080/books/%d/cover", bookID)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("cover", "cover.png")
 	suite.NoError(err)
-	req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	suite.NoError(png.Encode(part, image.NewRGBA(image.Rect(0, 0, 600, 900))))
+	suite.NoError(form.Close())
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:8080/admin/books/%d/cover", bookID), &body)
+	suite.NoError(err)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
 	time.Sleep(1 * time.Second)
 	resp, err := suite.client.Do(req)
 	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+
+	time.Sleep(1 * time.Second)
+	resp, err = http.Get(coverURL + "?size=small")
+	suite.NoError(err)
 	suite.Equal(http.StatusOK, resp.StatusCode)
-	defer resp.Body.Close()
+	suite.Equal("image/jpeg", resp.Header.Get("Content-Type"))
+	config, err := jpeg.DecodeConfig(resp.Body)
+	resp.Body.Close()
+	suite.NoError(err)
+	suite.Equal(120, config.Height)
+	etag := resp.Header.Get("ETag")
+	suite.NotEmpty(etag)
 
-	var book db.GetBookWithAuthorsByIDRow
-	err = json.NewDecoder(resp.Body).Decode(&book)
+	req, err = http.NewRequest("GET", coverURL+"?size=small", nil)
 	suite.NoError(err)
-	return book
+	req.Header.Set("If-None-Match", etag)
+	time.Sleep(1 * time.Second)
+	resp, err = suite.client.Do(req)
+	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusNotModified, resp.StatusCode)
+}
+
+// Only borrowers can review a book; hidden reviews leave its rating.
+func (suite *APITestSuite) TestBookReviewsAPI() {
+	bookID := suite.addBook(`{"title": "Review test", "copies": 1, "authors": [{"id": 5}]}`)
+
+	send := func(method, url, token, body string) int {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		suite.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		time.Sleep(1 * time.Second)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	reviewsURL := fmt.Sprintf("http://localhost:8080/books/%d/reviews", bookID)
+
+	suite.Equal(http.StatusForbidden, send("POST", reviewsURL, suite.userToken, `{"rating": 4, "text": "Good"}`))
+
+	// UserID = 1 is the regular user
+	suite.Equal(http.StatusOK, send("POST", fmt.Sprintf("http://localhost:8080/books/borrow/1/%d", bookID), suite.userToken, ""))
+	suite.Equal(http.StatusBadRequest, send("POST", reviewsURL, suite.userToken, `{"rating": 6}`))
+	suite.Equal(http.StatusOK, send("POST", reviewsURL, suite.userToken, `{"rating": 4, "text": "Good"}`))
+
+	book := suite.getBooksByID(int(bookID))
+	suite.Equal(int32(1), book.RatingCount)
+	suite.Equal(4.0, book.RatingAverage)
+
+	time.Sleep(1 * time.Second)
+	req, err := http.NewRequest("GET", reviewsURL, nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	var page handler.ReviewPage
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&page))
+	resp.Body.Close()
+	suite.Equal(1, len(page.Reviews))
+
+	suite.Equal(http.StatusOK, send("POST", fmt.Sprintf("http://localhost:8080/admin/reviews/%d/hide", page.Reviews[0].ID),
+		suite.adminToken, `{"reason": "test"}`))
+	suite.Equal(int32(0), suite.getBooksByID(int(bookID)).RatingCount)
+
+	suite.Equal(http.StatusOK, send("POST", fmt.Sprintf("http://localhost:8080/books/return/1/%d", bookID), suite.userToken, ""))
+}
+
+// Recommendations are computed by the recommend job, so only the shape of
+// the responses is checked here.
+func (suite *APITestSuite) TestRecommendationsAPI() {
+	get := func(url, token string) *http.Response {
+		req, err := http.NewRequest("GET", url, nil)
+		suite.NoError(err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		time.Sleep(1 * time.Second)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		return resp
+	}
+
+	resp := get("http://localhost:8080/books/1/recommendations", "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var recommendations []adaptor.Recommendation
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&recommendations))
+	resp.Body.Close()
+	suite.NotNil(recommendations)
+
+	resp = get("http://localhost:8080/books/1/recommendations", suite.userToken)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = get("http://localhost:8080/books/0/recommendations", "")
+	suite.Equal(http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = get("http://localhost:8080/me/recommendations", "")
+	suite.Equal(http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = get("http://localhost:8080/me/recommendations?limit=5", suite.userToken)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&recommendations))
+	resp.Body.Close()
+	suite.LessOrEqual(len(recommendations), 5)
+}
+
+// The book export is the same catalog in every format.
+func (suite *APITestSuite) TestExportBooksAPI() {
+	export := func(accept string) *http.Response {
+		req, err := http.NewRequest("GET", "http://localhost:8080/admin/export/books", nil)
+		suite.NoError(err)
+		req.Header.Set("Accept", accept)
+		req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+		time.Sleep(1 * time.Second)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		suite.Equal(http.StatusOK, resp.StatusCode)
+		return resp
+	}
+
+	resp := export("application/json")
+	var books []db.ExportBooksRow
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&books))
+	resp.Body.Close()
+	suite.NotEmpty(books)
+
+	resp = export("text/csv")
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	suite.NoError(err)
+	suite.Equal("id", records[0][0])
+	suite.Equal(len(books), len(records)-1)
+
+	resp = export("application/x-ndjson")
+	lines := 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var book db.ExportBooksRow
+		suite.NoError(json.Unmarshal(scanner.Bytes(), &book))
+		lines++
+	}
+	resp.Body.Close()
+	suite.Equal(len(books), lines)
+}
+
+func (suite *APITestSuite) getBookByISBN(value string) adaptor.BookDetail {
+	req, err := http.NewRequest("GET", "http://localhost:8080/books/isbn/"+value, nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	var book adaptor.BookDetail
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&book))
+	return book
+}
+
+// Adding a book by an author that already exists under a slightly different
+// spelling reuses the existing author instead of creating a duplicate.
+func (suite *APITestSuite) TestAuthorDeduplicationAPI() {
+	reqBody := []byte(`{
+		"title": "1Q84",
+		"description": "A novel",
+		"copies": 1,
+		"author": "haruki  murakami"
+	}`)
+	req, err := http.NewRequest("POST", "http://localhost:8080/admin/books", bytes.NewBuffer(reqBody))
+	suite.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	var bookID int
+	_, err = fmt.Sscanf(resp.Header.Get("Location"), "/books/%d", &bookID)
+	suite.NoError(err)
+
+	book := suite.getBooksByID(bookID)
+	suite.Equal(1, len(book.Authors))
+	suite.Equal(int32(1), book.Authors[0].ID)
+
+	// Creating the same author through the admin API is a conflict
+	req, err = http.NewRequest("POST", "http://localhost:8080/admin/authors", bytes.NewBufferString(`{"name": "Haruki Murakami"}`))
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err = suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+}
+
+// Borrow and return books API tests
+// 1. Get book copy count before borowing
+// 2. Borrow book 3 times
+// 3. Now the book count is cntBeforeBrrow - 3
+// 4. Return book 3 times
+// 5. Now the book count is cntBeforeBrrow
+func (suite *APITestSuite) TestBorrowReturnBookAPIs() {
+	// === Test Borrowing Books APIs
+	// Get available book count
+	book := suite.getBooksByID(2)
+	cntBeforeBrrow := book.AvailableCopies
+	suite.T().Log("cntBeforeBrrow = ", cntBeforeBrrow)
+
+	// // Borrow book 3 times
+	for i := 0; i < 3; i++ {
+		// To avoid too many requests rate limiting
+		time.Sleep(1 * time.Second)
+		// UserID = 1, BookID = 2
+		req, err := http.NewRequest("POST", "http://localhost:8080/books/borrow/1/2", nil)
+		suite.NoError(err)
+
+		req.Header.Set("Authorization", "Bearer "+suite.userToken)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		suite.Equal(http.StatusOK, resp.StatusCode)
+	}
+
+	// Get available book count after borrowing
+	book = suite.getBooksByID(2)
+	cntAfterBorrow := book.AvailableCopies
+	suite.Equal(cntBeforeBrrow-3, cntAfterBorrow)
+
+	// Check User's borrowed book count
+	req, err := http.NewRequest("GET", "http://localhost:8080/users/1/books", nil)
+	suite.NoError(err)
+
+	req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	defer resp.Body.Close()
+
+	var borrowedBooks []db.ListBorrowedBooksRow
+	err = json.NewDecoder(resp.Body).Decode(&borrowedBooks)
+	suite.NoError(err)
+	// There are 3 borrowed books, each one a different copy
+	suite.Equal(3, len(borrowedBooks))
+	suite.NotEqual(borrowedBooks[0].CopyID, borrowedBooks[1].CopyID)
+	suite.NotEqual(borrowedBooks[1].CopyID, borrowedBooks[2].CopyID)
+
+	// === Test Returning Books APIs
+	// Return book 3 times
+	for i := 0; i < 3; i++ {
+		// To avoid too many requests rate limiting
+		time.Sleep(1 * time.Second)
+		// UserID = 1, BookID = 2
+		req, err := http.NewRequest("POST", "http://localhost:8080/books/return/1/2", nil)
+		suite.NoError(err)
+
+		req.Header.Set("Authorization", "Bearer "+suite.userToken)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		suite.Equal(http.StatusOK, resp.StatusCode)
+	}
+
+	time.Sleep(1 * time.Second)
+	// Get available book count after returning
+	book = suite.getBooksByID(2)
+	cntAfterReturn := book.AvailableCopies
+	suite.Equal(cntAfterBorrow+3, cntAfterReturn)
+
+	// Check User's borrowed book count
+	req, err = http.NewRequest("GET", "http://localhost:8080/users/1/books", nil)
+	suite.NoError(err)
+
+	req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	time.Sleep(1 * time.Second)
+	resp, err = suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&borrowedBooks)
+	suite.NoError(err)
+	// There are 0 borrowed books
+	suite.Equal(0, len(borrowedBooks))
+
+	// After returning all books, the book count should be the original count
+	time.Sleep(1 * time.Second)
+	book = suite.getBooksByID(2)
+	suite.Equal(cntBeforeBrrow, book.AvailableCopies)
+}
+
+func (suite *APITestSuite) getBooksByID(bookID int) adaptor.BookDetail {
+	// Get current borrowed book for bookID
+	url := fmt.Sprintf("http://localhost:8080/books/%d", bookID)
+
+	req, err := http.NewRequest("GET", url, nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	defer resp.Body.Close()
+
+	var book adaptor.BookDetail
+	err = json.NewDecoder(resp.Body).Decode(&book)
+	suite.NoError(err)
+	return book
+}
+
+// List the catalog two books at a time and walk the cursor to the next page.
+func (suite *APITestSuite) TestListBooksAPI() {
+	page := suite.listBooks("limit=2&sort=title")
+	suite.Equal(2, len(page.Books))
+	suite.NotEmpty(page.NextCursor)
+	suite.True(page.Books[0].Title <= page.Books[1].Title)
+
+	next := suite.listBooks("limit=2&sort=title&cursor=" + page.NextCursor)
+	suite.NotEmpty(next.Books)
+	suite.True(page.Books[1].Title <= next.Books[0].Title)
+
+	// Filter by author: Haruki Murakami (author 1) has two books
+	byAuthor := suite.listBooks("author_id=1")
+	suite.Equal(2, len(byAuthor.Books))
+
+	// Title prefix is case-insensitive
+	byTitle := suite.listBooks("title_prefix=norwegian")
+	suite.Equal(1, len(byTitle.Books))
+	suite.Equal("Norwegian Wood", byTitle.Books[0].Title)
+}
+
+func (suite *APITestSuite) listBooks(query string) handler.BookPage {
+	req, err := http.NewRequest("GET", "http://localhost:8080/books?"+query, nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	defer resp.Body.Close()
+
+	var page handler.BookPage
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	suite.NoError(err)
+	return page
+}
+
+// Search by author name and by a word of the title.
+func (suite *APITestSuite) TestSearchBooksAPI() {
+	page := suite.searchBooks("murakami")
+	suite.Equal(2, len(page.Results))
+
+	page = suite.searchBooks("dystopian")
+	suite.Equal(1, len(page.Results))
+	suite.Equal("1984", page.Results[0].Title)
+	suite.Contains(page.Results[0].Snippet, "<mark>")
+}
+
+func (suite *APITestSuite) searchBooks(q string) handler.SearchPage {
+	req, err := http.NewRequest("GET", "http://localhost:8080/books/search?q="+q, nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.userToken)
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	defer resp.Body.Close()
+
+	var page handler.SearchPage
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	suite.NoError(err)
+	return page
+}
+
+// Add a copy with a barcode, check it counts as available, then retire it.
+func (suite *APITestSuite) TestBookCopiesAPI() {
+	before := suite.getBooksByID(3)
+
+	barcode := fmt.Sprintf("TEST-%d", time.Now().UnixNano())
+	reqBody := []byte(fmt.Sprintf(`{"barcode": "%s", "condition": "new", "shelf_location": "A-12"}`, barcode))
+	req, err := http.NewRequest("POST", "http://localhost:8080/admin/books/3/copies", bytes.NewBuffer(reqBody))
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err := suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+
+	var copy db.BookCopy
+	err = json.NewDecoder(resp.Body).Decode(&copy)
+	resp.Body.Close()
+	suite.NoError(err)
+	suite.Equal(barcode, copy.Barcode)
+	suite.Equal("available", copy.Status)
+
+	book := suite.getBooksByID(3)
+	suite.Equal(before.AvailableCopies+1, book.AvailableCopies)
+
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:8080/admin/copies/%d/retire", copy.ID), nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	time.Sleep(1 * time.Second)
+	resp, err = suite.client.Do(req)
+	suite.NoError(err)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	book = suite.getBooksByID(3)
+	suite.Equal(before.AvailableCopies, book.AvailableCopies)
+	suite.Equal(before.TotalCopies, book.TotalCopies)
+}
+
+// A copy sent to another branch is in transit, and cannot be borrowed,
+// until it is received there.
+func (suite *APITestSuite) TestBranchTransferAPI() {
+	send := func(method, url, token, body string) *http.Response {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		suite.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		time.Sleep(1 * time.Second)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		return resp
+	}
+
+	resp := send("POST", "http://localhost:8080/admin/branches", suite.adminToken,
+		fmt.Sprintf(`{"code": "B%d", "name": "Transfer test branch"}`, time.Now().UnixNano()%1e9))
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+	var branch db.Branch
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&branch))
+	resp.Body.Close()
+
+	bookID := suite.addBook(`{"title": "Transfer test", "copies": 1, "authors": [{"id": 5}]}`)
+	resp = send("GET", fmt.Sprintf("http://localhost:8080/admin/books/%d/copies", bookID), suite.adminToken, "")
+	var copies []db.BookCopy
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&copies))
+	resp.Body.Close()
+	suite.Equal(1, len(copies))
+
+	borrowURL := fmt.Sprintf("http://localhost:8080/books/borrow/1/%d?branch_id=%d", bookID, branch.ID)
+	resp = send("POST", borrowURL, suite.userToken, "")
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", "http://localhost:8080/admin/transfers", suite.adminToken,
+		fmt.Sprintf(`{"copy_ids": [%d], "to_branch_id": %d}`, copies[0].ID, branch.ID))
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+	var transfers []db.CopyTransfer
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&transfers))
+	resp.Body.Close()
+	suite.Equal(1, len(transfers))
+	suite.Equal("in_transit", transfers[0].Status)
+
+	resp = send("POST", borrowURL, suite.userToken, "")
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", fmt.Sprintf("http://localhost:8080/admin/transfers/%d/receive", transfers[0].ID), suite.adminToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	page := suite.listBooks(fmt.Sprintf("branch_id=%d&available=true&limit=100", branch.ID))
+	found := false
+	for _, book := range page.Books {
+		found = found || book.ID == bookID
+	}
+	suite.True(found)
+
+	resp = send("POST", borrowURL, suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", fmt.Sprintf("http://localhost:8080/books/return/1/%d", bookID), suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func (suite *APITestSuite) TestLoanDueDatesAPI() {
+	send := func(method, url, token, body string) *http.Response {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		suite.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		time.Sleep(1 * time.Second)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		return resp
+	}
+
+	bookID := suite.addBook(`{"title": "Due date test", "copies": 1, "authors": [{"id": 5}]}`)
+	resp := send("PUT", "http://localhost:8080/admin/loan-policies", suite.adminToken,
+		fmt.Sprintf(`{"role": "user", "book_id": %d, "loan_days": 3}`, bookID))
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var policy db.LoanPolicy
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&policy))
+	resp.Body.Close()
+	suite.Equal(int32(3), policy.LoanDays)
+
+	resp = send("PUT", "http://localhost:8080/admin/loan-policies", suite.adminToken, `{"role": "user", "loan_days": 0}`)
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", fmt.Sprintf("http://localhost:8080/books/borrow/1/%d", bookID), suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var loan db.BorrowedBook
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&loan))
+	resp.Body.Close()
+	suite.Equal(3*24*time.Hour, loan.DueAt.Time.Sub(loan.BorrowedAt.Time).Round(time.Hour))
+
+	resp = send("GET", "http://localhost:8080/admin/loans/overdue?limit=10", suite.adminToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var overdue []db.ListOverdueLoansRow
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&overdue))
+	resp.Body.Close()
+	for _, row := range overdue {
+		suite.NotEqual(loan.ID, row.ID)
+	}
+
+	resp = send("POST", fmt.Sprintf("http://localhost:8080/books/return/1/%d", bookID), suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("DELETE", fmt.Sprintf("http://localhost:8080/admin/loan-policies/%d", policy.ID), suite.adminToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("DELETE", fmt.Sprintf("http://localhost:8080/admin/loan-policies/%d", policy.ID), suite.adminToken, "")
+	suite.Equal(http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func (suite *APITestSuite) TestLoanRenewalAPI() {
+	send := func(method, url, token, body string) *http.Response {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		suite.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		time.Sleep(1 * time.Second)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		return resp
+	}
+
+	bookID := suite.addBook(`{"title": "Renewal test", "copies": 1, "authors": [{"id": 5}]}`)
+	resp := send("PUT", "http://localhost:8080/admin/loan-policies", suite.adminToken,
+		fmt.Sprintf(`{"role": "user", "book_id": %d, "loan_days": 7, "max_renewals": 1}`, bookID))
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var policy db.LoanPolicy
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&policy))
+	resp.Body.Close()
+	suite.Equal(int32(1), policy.MaxRenewals)
+
+	resp = send("POST", fmt.Sprintf("http://localhost:8080/books/borrow/1/%d", bookID), suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var loan db.BorrowedBook
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&loan))
+	resp.Body.Close()
+
+	renewURL := fmt.Sprintf("http://localhost:8080/loans/%d/renew", loan.ID)
+	resp = send("POST", renewURL+"?override=true", suite.userToken, "")
+	suite.Equal(http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	// No renewal while another patron waits for the book
+	resp = send("POST", fmt.Sprintf("http://localhost:8080/books/%d/holds", bookID), suite.adminToken, "")
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+	var hold db.ListHoldsRow
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&hold))
+	resp.Body.Close()
+
+	resp = send("POST", renewURL, suite.userToken, "")
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("DELETE", fmt.Sprintf("http://localhost:8080/holds/%d", hold.ID), suite.adminToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", renewURL, suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var renewed db.BorrowedBook
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&renewed))
+	resp.Body.Close()
+	suite.Equal(int32(1), renewed.Renewals)
+	suite.False(renewed.DueAt.Time.Before(loan.DueAt.Time))
+
+	resp = send("POST", renewURL, suite.userToken, "")
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", "http://localhost:8080/loans/999999/renew", suite.userToken, "")
+	suite.Equal(http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", fmt.Sprintf("http://localhost:8080/books/return/1/%d", bookID), suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", renewURL, suite.userToken, "")
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("DELETE", fmt.Sprintf("http://localhost:8080/admin/loan-policies/%d", policy.ID), suite.adminToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func (suite *APITestSuite) TestHoldsAPI() {
+	send := func(method, url, token, body string) *http.Response {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		suite.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		time.Sleep(1 * time.Second)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		return resp
+	}
+
+	bookID := suite.addBook(`{"title": "Hold test", "copies": 1, "authors": [{"id": 5}]}`)
+	borrowURL := fmt.Sprintf("http://localhost:8080/books/borrow/1/%d", bookID)
+	resp := send("POST", borrowURL, suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var loan db.BorrowedBook
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&loan))
+	resp.Body.Close()
+
+	holdsURL := fmt.Sprintf("http://localhost:8080/books/%d/holds", bookID)
+	resp = send("POST", holdsURL, suite.userToken, "")
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", holdsURL, suite.adminToken, "")
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+	var hold db.ListHoldsRow
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&hold))
+	resp.Body.Close()
+	suite.Equal("waiting", hold.Status)
+	suite.Equal(int32(1), hold.Position)
+
+	resp = send("POST", holdsURL, suite.adminToken, "")
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", fmt.Sprintf("http://localhost:8080/loans/%d/renew", loan.ID), suite.userToken, "")
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", fmt.Sprintf("http://localhost:8080/books/return/1/%d", bookID), suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	holdURL := fmt.Sprintf("http://localhost:8080/holds/%d", hold.ID)
+	resp = send("GET", holdURL, suite.adminToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&hold))
+	resp.Body.Close()
+	suite.Equal("ready", hold.Status)
+	suite.True(hold.CopyID.Valid)
+	suite.True(hold.ExpiresAt.Valid)
+
+	resp = send("GET", holdURL, suite.userToken, "")
+	suite.Equal(http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", borrowURL, suite.userToken, "")
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("GET", fmt.Sprintf("http://localhost:8080/admin/books/%d/holds", bookID), suite.adminToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var queue []db.ListHoldsRow
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&queue))
+	resp.Body.Close()
+	suite.Equal(1, len(queue))
+
+	resp = send("DELETE", holdURL, suite.userToken, "")
+	suite.Equal(http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("DELETE", holdURL, suite.adminToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("GET", "http://localhost:8080/me/holds", suite.adminToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var mine []db.ListHoldsRow
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&mine))
+	resp.Body.Close()
+	for _, open := range mine {
+		suite.NotEqual(hold.ID, open.ID)
+	}
+
+	resp = send("POST", borrowURL, suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", fmt.Sprintf("http://localhost:8080/books/return/1/%d", bookID), suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func (suite *APITestSuite) TestFinesAccountAPI() {
+	send := func(method, url, token, body string) *http.Response {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		suite.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		time.Sleep(1 * time.Second)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		return resp
+	}
+
+	resp := send("GET", "http://localhost:8080/admin/fee-schedules", suite.adminToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var schedules []db.FeeSchedule
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&schedules))
+	resp.Body.Close()
+	suite.NotEmpty(schedules)
+
+	resp = send("PUT", "http://localhost:8080/admin/fee-schedules", suite.adminToken,
+		`{"role": "user", "daily_fine_cents": -1, "grace_days": 0}`)
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("GET", "http://localhost:8080/me/account", suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var account adaptor.Account
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&account))
+	resp.Body.Close()
+	suite.GreaterOrEqual(account.BalanceCents, int32(0))
+
+	accountURL := fmt.Sprintf("http://localhost:8080/admin/users/%d/account", account.UserID)
+	resp = send("GET", accountURL, suite.userToken, "")
+	suite.Equal(http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("GET", accountURL, suite.adminToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var viewed adaptor.Account
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&viewed))
+	resp.Body.Close()
+	suite.Equal(account.BalanceCents, viewed.BalanceCents)
+
+	resp = send("POST", accountURL+"/payments", suite.adminToken,
+		fmt.Sprintf(`{"amount_cents": %d, "memo": "Too much"}`, account.BalanceCents+1))
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", accountURL+"/waivers", suite.adminToken, `{"amount_cents": 0}`)
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", "http://localhost:8080/admin/users/999999/account/waivers", suite.adminToken, `{"amount_cents": 1}`)
+	suite.Equal(http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func (suite *APITestSuite) TestBorrowingLimitsAPI() {
+	send := func(method, url, token, body string) *http.Response {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		suite.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		time.Sleep(1 * time.Second)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		return resp
+	}
+
+	resp := send("GET", "http://localhost:8080/admin/borrowing-limits", suite.adminToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var limits []db.BorrowingLimit
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&limits))
+	resp.Body.Close()
+	var previous db.BorrowingLimit
+	for _, limit := range limits {
+		if limit.Role == "user" {
+			previous = limit
+		}
+	}
+	suite.NotZero(previous.ID)
+
+	resp = send("PUT", "http://localhost:8080/admin/borrowing-limits", suite.adminToken,
+		`{"role": "user", "max_loans": 0, "max_copies_per_title": 1}`)
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("PUT", "http://localhost:8080/admin/borrowing-limits", suite.adminToken,
+		fmt.Sprintf(`{"role": "user", "max_loans": %d, "max_copies_per_title": 1}`, previous.MaxLoans))
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	defer func() {
+		resp := send("PUT", "http://localhost:8080/admin/borrowing-limits", suite.adminToken,
+			fmt.Sprintf(`{"role": "user", "max_loans": %d, "max_copies_per_title": %d}`, previous.MaxLoans, previous.MaxCopiesPerTitle))
+		suite.Equal(http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+	}()
+
+	bookID := suite.addBook(`{"title": "Limit test", "copies": 2, "authors": [{"id": 5}]}`)
+	borrowURL := fmt.Sprintf("http://localhost:8080/books/borrow/1/%d", bookID)
+	resp = send("POST", borrowURL, suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("POST", borrowURL, suite.userToken, "")
+	suite.Equal(http.StatusForbidden, resp.StatusCode)
+	var refused handler.ErrorResponse
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&refused))
+	resp.Body.Close()
+	suite.Equal("title_limit_reached", refused.Code)
+
+	resp = send("POST", fmt.Sprintf("http://localhost:8080/books/return/1/%d", bookID), suite.userToken, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func (suite *APITestSuite) TestLoanHistoryAPI() {
+	send := func(method, url, token string) *http.Response {
+		req, err := http.NewRequest(method, url, nil)
+		suite.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		time.Sleep(1 * time.Second)
+		resp, err := suite.client.Do(req)
+		suite.NoError(err)
+		return resp
+	}
+	listLoans := func(url, token string) handler.LoanPage {
+		resp := send("GET", url, token)
+		defer resp.Body.Close()
+		suite.Equal(http.StatusOK, resp.StatusCode)
+		var page handler.LoanPage
+		suite.NoError(json.NewDecoder(resp.Body).Decode(&page))
+		return page
+	}
+
+	bookID := suite.addBook(`{"title": "History test", "copies": 1, "authors": [{"id": 5}]}`)
+	for i := 0; i < 2; i++ {
+		resp := send("POST", fmt.Sprintf("http://localhost:8080/books/borrow/1/%d", bookID), suite.userToken)
+		suite.Equal(http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+		resp = send("POST", fmt.Sprintf("http://localhost:8080/books/return/1/%d", bookID), suite.userToken)
+		suite.Equal(http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	page := listLoans(fmt.Sprintf("http://localhost:8080/users/1/loans?book_id=%d&status=returned", bookID), suite.userToken)
+	suite.Equal(2, len(page.Loans))
+	suite.True(page.Loans[0].ID > page.Loans[1].ID)
+	suite.True(page.Loans[0].ReturnedAt.Valid)
+	suite.True(page.Loans[0].DueAt.Valid)
+
+	page = listLoans(fmt.Sprintf("http://localhost:8080/users/1/loans?book_id=%d&status=active", bookID), suite.userToken)
+	suite.Equal(0, len(page.Loans))
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(time.DateOnly)
+	page = listLoans(fmt.Sprintf("http://localhost:8080/admin/loans?book_id=%d&from=%s", bookID, tomorrow), suite.adminToken)
+	suite.Equal(0, len(page.Loans))
+
+	page = listLoans(fmt.Sprintf("http://localhost:8080/admin/loans?book_id=%d&limit=1", bookID), suite.adminToken)
+	suite.Equal(1, len(page.Loans))
+	suite.NotEmpty(page.NextCursor)
+	next := listLoans(fmt.Sprintf("http://localhost:8080/admin/loans?book_id=%d&limit=1&cursor=%s", bookID, page.NextCursor), suite.adminToken)
+	suite.Equal(1, len(next.Loans))
+	suite.True(next.Loans[0].ID < page.Loans[0].ID)
+	suite.Empty(next.NextCursor)
+
+	resp := send("GET", "http://localhost:8080/users/1/loans?status=lost", suite.userToken)
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("GET", "http://localhost:8080/users/999999/loans", suite.userToken)
+	suite.Equal(http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = send("GET", "http://localhost:8080/admin/loans", suite.userToken)
+	suite.Equal(http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
 }
 
 func (suite *APITestSuite) TestAdminAccessWithRegularUserToken() {